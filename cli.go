@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kuhlman-labs/repo-ruleset-bot/reporulesetbot"
+	"github.com/pkg/errors"
+)
+
+// runCommand runs a command against the admin API of the running app and returns the exit code.
+func runCommand(name string, args []string) int {
+	switch name {
+	case "rollback":
+		return runRollback(args)
+	case "versions":
+		return runVersions(args)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %s, expected rollback or versions.\n", name)
+		return 2
+	}
+}
+
+// runRollback rolls one or every organization back to an earlier release.
+func runRollback(args []string) int {
+	flags := flag.NewFlagSet("rollback", flag.ExitOnError)
+	configPath := flags.String("config", "config.yml", "The configuration file of the app.")
+	server := flags.String("server", "", "The URL of the running app. Defaults to the server address in the configuration.")
+	release := flags.String("release", "", "The release tag to roll back to.")
+	org := flags.String("org", "", "Only roll back this organization.")
+	reason := flags.String("reason", "", "Why the rollback is needed, recorded in the audit log.")
+	flags.Parse(args)
+
+	if *release == "" {
+		fmt.Fprintln(os.Stderr, "The -release flag is required.")
+		return 2
+	}
+
+	client, err := newAdminClient(*configPath, *server)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return client.call(http.MethodPost, "rollback", reporulesetbot.RollbackRequest{
+		Release: *release,
+		Org:     *org,
+		Reason:  *reason,
+		Actor:   os.Getenv("USER"),
+	})
+}
+
+// runVersions shows the release every organization is on, and which ones lag behind or failed their last sync.
+func runVersions(args []string) int {
+	flags := flag.NewFlagSet("versions", flag.ExitOnError)
+	configPath := flags.String("config", "config.yml", "The configuration file of the app.")
+	server := flags.String("server", "", "The URL of the running app. Defaults to the server address in the configuration.")
+	asJSON := flags.Bool("json", false, "Write the report as JSON.")
+	flags.Parse(args)
+
+	client, err := newAdminClient(*configPath, *server)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *asJSON {
+		return client.call(http.MethodGet, "versions", nil)
+	}
+	return client.call(http.MethodGet, "versions?format=text", nil)
+}
+
+// adminClient calls the admin API of the running app.
+type adminClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// newAdminClient returns a client for the admin API of the app configured in the given file.
+func newAdminClient(configPath, server string) (*adminClient, error) {
+	config, err := reporulesetbot.ReadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if config.Admin.Token == "" {
+		return nil, errors.Errorf("The admin API is disabled, set admin.token in %s", configPath)
+	}
+
+	if server == "" {
+		server = fmt.Sprintf("http://%s:%d", config.Server.Address, config.Server.Port)
+	}
+
+	return &adminClient{
+		baseURL: strings.TrimSuffix(server, "/") + reporulesetbot.AdminRoute,
+		token:   config.Admin.Token,
+		http:    &http.Client{Timeout: time.Hour},
+	}, nil
+}
+
+// call sends a request to the admin API, writes the response to stdout, and returns the exit code.
+func (c *adminClient) call(method, path string, body interface{}) int {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if resp.StatusCode >= 300 {
+		return 1
+	}
+	return 0
+}
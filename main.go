@@ -1,54 +1,116 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"github.com/gregjones/httpcache"
 	"github.com/kuhlman-labs/repo-ruleset-bot/reporulesetbot"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/rcrowley/go-metrics"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	config, err := reporulesetbot.ReadConfig("config.yml")
 	if err != nil {
 		panic(err)
 	}
 
-	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+	logger, err := reporulesetbot.NewLogger(config.Log, os.Stdout)
+	if err != nil {
+		panic(err)
+	}
 	zerolog.DefaultContextLogger = &logger
 
 	metricsRegistry := metrics.DefaultRegistry
 
+	tracerProvider, shutdownTracing, err := reporulesetbot.NewTracerProvider(context.Background(), config.Tracing)
+	if err != nil {
+		panic(err)
+	}
+	otel.SetTracerProvider(tracerProvider)
+
 	cc, err := githubapp.NewDefaultCachingClientCreator(
 		config.Github,
 		githubapp.WithClientUserAgent("repo-ruleset-bot/1.0.0"),
-		githubapp.WithClientTimeout(3*time.Second),
 		githubapp.WithClientCaching(false, func() httpcache.Cache { return httpcache.NewMemoryCache() }),
 		githubapp.WithClientMiddleware(
 			githubapp.ClientMetrics(metricsRegistry),
+			reporulesetbot.TracingMiddleware(tracerProvider),
+			reporulesetbot.RateLimitMiddleware(config.RateLimit, metricsRegistry),
 		),
 	)
 	if err != nil {
 		panic(err)
 	}
 
+	stateStore, err := reporulesetbot.OpenStateStore(config.State.Path)
+	if err != nil {
+		panic(err)
+	}
+
+	notifier := reporulesetbot.NewQueuedNotifier(reporulesetbot.NewNotifier(config.Notifications, cc), config.Notifications.QueueSize, logger)
+
 	repoRulesetHandler := reporulesetbot.RulesetHandler{
-		ClientCreator: cc,
-		Logger:        logger,
+		ClientCreator:  cc,
+		Logger:         logger,
+		Config:         config,
+		State:          stateStore,
+		Audit:          reporulesetbot.NewJSONLAuditSink(config.Audit.Path),
+		Notifier:       notifier,
+		Metrics:        metricsRegistry,
+		TracerProvider: tracerProvider,
 	}
 
-	webhookHandler := githubapp.NewDefaultEventDispatcher(config.Github, &repoRulesetHandler)
+	go repoRulesetHandler.WatchExemptions(context.Background())
+
+	// Send SIGUSR1 to abort the rollout of a release.
+	aborts := make(chan os.Signal, 1)
+	signal.Notify(aborts, syscall.SIGUSR1)
+	go func() {
+		for range aborts {
+			if repoRulesetHandler.AbortRollout("aborted by an operator") {
+				logger.Warn().Msg("Aborting the rollout in progress.")
+			} else {
+				logger.Info().Msg("No rollout in progress to abort.")
+			}
+		}
+	}()
+
+	webhookHandler := githubapp.NewEventDispatcher(
+		[]githubapp.EventHandler{&repoRulesetHandler},
+		config.Github.App.WebhookSecret,
+		githubapp.WithScheduler(config.Queue.Scheduler(metricsRegistry)),
+	)
 
 	http.Handle(githubapp.DefaultWebhookRoute, webhookHandler)
+	http.Handle(reporulesetbot.MetricsRoute, reporulesetbot.NewMetricsHandler(metricsRegistry))
+	http.Handle(reporulesetbot.HealthRoute, reporulesetbot.NewHealthHandler())
+	http.Handle(reporulesetbot.ReadyRoute, reporulesetbot.NewReadinessHandler(&repoRulesetHandler))
+	if config.Admin.Token != "" {
+		http.Handle(reporulesetbot.AdminRoute, reporulesetbot.NewAdminHandler(&repoRulesetHandler, config.Admin))
+	}
+	if config.Dashboard.Token != "" {
+		http.Handle(reporulesetbot.DashboardRoute, reporulesetbot.NewDashboardHandler(&repoRulesetHandler, config.Dashboard))
+	}
 
 	addr := fmt.Sprintf("%s:%d", config.Server.Address, config.Server.Port)
 	logger.Info().Msgf("Starting server on %s...", addr)
 	err = http.ListenAndServe(addr, nil)
+	notifier.Close()
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Error().Err(err).Msg("Failed to flush the traces.")
+	}
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to start server.")
 	}
@@ -0,0 +1,282 @@
+package reporulesetbot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AdminRoute is the path the admin API is served under.
+const AdminRoute = "/api/admin/"
+
+// AdminConfig represents the configuration of the admin API. The API is only served when a token is set.
+type AdminConfig struct {
+	Token string `yaml:"token"`
+}
+
+// adminError represents an error returned by the admin API.
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// syncRequest represents a request to sync an organization. The body is optional.
+type syncRequest struct {
+	Actor string `json:"actor,omitempty"`
+}
+
+// syncResponse represents the response to a sync request.
+type syncResponse struct {
+	Status *OrgStatus `json:"status,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// exemptionStatus represents an exemption and whether it is still active.
+type exemptionStatus struct {
+	Exemption
+	Active bool `json:"active"`
+}
+
+// revokeResponse represents the response to a request to revoke exemptions.
+type revokeResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+// rollbackResponse represents the response to a rollback request.
+type rollbackResponse struct {
+	Report *RolloutReport `json:"report,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// notFoundError is returned when a request refers to a release or organization that doesn't exist, or that the app
+// isn't installed in. The admin API answers it with a 404.
+type notFoundError struct {
+	message string
+}
+
+// Error implements error.
+func (e *notFoundError) Error() string {
+	return e.message
+}
+
+// invalidRequestError is returned when a request is invalid. The admin API answers it with a 400.
+type invalidRequestError struct {
+	message string
+}
+
+// Error implements error.
+func (e *invalidRequestError) Error() string {
+	return e.message
+}
+
+// conflictError is returned when a request can't be carried out in the current state of an organization, such as
+// syncing a suspended installation. The admin API answers it with a 409.
+type conflictError struct {
+	message string
+}
+
+// Error implements error.
+func (e *conflictError) Error() string {
+	return e.message
+}
+
+// errorStatus returns the HTTP status the admin API answers an error with.
+func errorStatus(err error) int {
+	var notFound *notFoundError
+	var invalidRequest *invalidRequestError
+	var conflict *conflictError
+	switch {
+	case errors.As(err, &notFound):
+		return http.StatusNotFound
+	case errors.As(err, &invalidRequest):
+		return http.StatusBadRequest
+	case errors.As(err, &conflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// claimedActor labels the actor named in an admin API request. The API only checks the shared admin token, so the
+// actor is whoever the caller claims to be.
+func claimedActor(actor string) string {
+	if actor == "" {
+		return ""
+	}
+	return actor + " (claimed)"
+}
+
+// NewAdminHandler returns the handler of the admin API. Every request must carry the configured token as a bearer
+// token.
+func NewAdminHandler(h *RulesetHandler, config AdminConfig) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+AdminRoute+"installations", h.serveInstallations)
+	mux.HandleFunc("GET "+AdminRoute+"orgs/{org}", h.serveOrgStatus)
+	mux.HandleFunc("GET "+AdminRoute+"orgs/{org}/plan", h.servePlan)
+	mux.HandleFunc("POST "+AdminRoute+"orgs/{org}/sync", h.serveSync)
+	mux.HandleFunc("POST "+AdminRoute+"rollback", h.serveRollback)
+	mux.HandleFunc("GET "+AdminRoute+"versions", h.serveVersions)
+	mux.HandleFunc("GET "+AdminRoute+"exemptions", h.serveExemptions)
+	mux.HandleFunc("POST "+AdminRoute+"exemptions", h.serveAddExemption)
+	mux.HandleFunc("DELETE "+AdminRoute+"exemptions/{org}/{ruleset}", h.serveRevokeExemptions)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || config.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(config.Token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, adminError{Error: "A valid admin token is required"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// serveInstallations returns every installation of the app and the last sync of its organization.
+func (h *RulesetHandler) serveInstallations(w http.ResponseWriter, r *http.Request) {
+	installations, err := h.ListInstallations(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, adminError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, installations)
+}
+
+// serveOrgStatus returns the managed rulesets of an organization and the result of its last sync.
+func (h *RulesetHandler) serveOrgStatus(w http.ResponseWriter, r *http.Request) {
+	orgName := r.PathValue("org")
+	status, ok, err := h.OrgStatus(orgName)
+	switch {
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, adminError{Error: err.Error()})
+	case !ok:
+		writeJSON(w, http.StatusNotFound, adminError{Error: fmt.Sprintf("The organization %s has no managed rulesets", orgName)})
+	default:
+		writeJSON(w, http.StatusOK, status)
+	}
+}
+
+// servePlan returns the changes a sync of an organization would make, showing whether it drifted from the
+// configuration.
+func (h *RulesetHandler) servePlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := h.PlanOrganization(r.Context(), r.PathValue("org"))
+	if err != nil {
+		writeJSON(w, errorStatus(err), adminError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// serveSync syncs an organization and returns its status.
+func (h *RulesetHandler) serveSync(w http.ResponseWriter, r *http.Request) {
+	var request syncRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, adminError{Error: "Invalid sync request: " + err.Error()})
+		return
+	}
+
+	// The sync finishes even if the client stops waiting for it.
+	status, err := h.SyncOrganization(context.WithoutCancel(r.Context()), r.PathValue("org"), claimedActor(request.Actor))
+	if err != nil {
+		writeJSON(w, errorStatus(err), syncResponse{Status: status, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, syncResponse{Status: status})
+}
+
+// serveRollback rolls one or every organization back to an earlier release and returns the rollout report.
+func (h *RulesetHandler) serveRollback(w http.ResponseWriter, r *http.Request) {
+	var request RollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, adminError{Error: "Invalid rollback request: " + err.Error()})
+		return
+	}
+
+	// The rollback finishes even if the client stops waiting for it.
+	request.Actor = claimedActor(request.Actor)
+	report, err := h.Rollback(context.WithoutCancel(r.Context()), request)
+	if err != nil {
+		writeJSON(w, errorStatus(err), rollbackResponse{Report: report, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, rollbackResponse{Report: report})
+}
+
+// serveVersions returns the release every organization is on. With ?format=text the report is returned as a table.
+func (h *RulesetHandler) serveVersions(w http.ResponseWriter, r *http.Request) {
+	report, err := h.VersionReport()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, adminError{Error: err.Error()})
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := report.WriteText(w); err != nil {
+			h.Logger.Error().Err(err).Msg("Failed to write the version report.")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// serveExemptions returns every exemption in the exemptions file, including the expired ones.
+func (h *RulesetHandler) serveExemptions(w http.ResponseWriter, r *http.Request) {
+	exemptions, err := h.Exemptions()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, adminError{Error: err.Error()})
+		return
+	}
+
+	now := time.Now()
+	statuses := make([]exemptionStatus, 0, len(exemptions))
+	for _, exemption := range exemptions {
+		statuses = append(statuses, exemptionStatus{Exemption: exemption, Active: exemption.activeAt(now)})
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// serveAddExemption adds an exemption to the exemptions file.
+func (h *RulesetHandler) serveAddExemption(w http.ResponseWriter, r *http.Request) {
+	var exemption Exemption
+	if err := json.NewDecoder(r.Body).Decode(&exemption); err != nil {
+		writeJSON(w, http.StatusBadRequest, adminError{Error: "Invalid exemption: " + err.Error()})
+		return
+	}
+
+	if err := exemption.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, adminError{Error: "Invalid exemption: " + err.Error()})
+		return
+	}
+	if !exemption.activeAt(time.Now()) {
+		writeJSON(w, http.StatusBadRequest, adminError{Error: "Invalid exemption: expires is in the past"})
+		return
+	}
+
+	if err := h.AddExemption(exemption); err != nil {
+		writeJSON(w, http.StatusInternalServerError, adminError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, exemptionStatus{Exemption: exemption, Active: true})
+}
+
+// serveRevokeExemptions ends the active exemptions for a ruleset in an organization.
+func (h *RulesetHandler) serveRevokeExemptions(w http.ResponseWriter, r *http.Request) {
+	revoked, err := h.RevokeExemptions(r.PathValue("org"), r.PathValue("ruleset"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, adminError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, revokeResponse{Revoked: revoked})
+}
+
+// writeJSON writes a value as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,114 @@
+package reporulesetbot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// adminRequest sends a request to the admin API and returns the response.
+func adminRequest(t *testing.T, handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, AdminRoute+path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminHandler_Authentication(t *testing.T) {
+	handler := NewAdminHandler(&RulesetHandler{}, AdminConfig{Token: "secret"})
+
+	rec := adminRequest(t, handler, http.MethodPost, "rollback", "", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.JSONEq(t, `{"error": "A valid admin token is required"}`, rec.Body.String())
+
+	rec = adminRequest(t, handler, http.MethodPost, "rollback", "wrong", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// Without a configured token every request is rejected.
+	rec = adminRequest(t, NewAdminHandler(&RulesetHandler{}, AdminConfig{}), http.MethodPost, "rollback", "", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAdminHandler_Rollback(t *testing.T) {
+	handler := NewAdminHandler(&RulesetHandler{}, AdminConfig{Token: "secret"})
+
+	rec := adminRequest(t, handler, http.MethodPost, "rollback", "secret", `not json`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = adminRequest(t, handler, http.MethodPost, "rollback", "secret", `{"org": "test-org"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "A release tag is required"}`, rec.Body.String())
+
+	rec = adminRequest(t, handler, http.MethodPost, "rollback", "secret", `{"release": ".."}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "Invalid release tag \"..\""}`, rec.Body.String())
+
+	rec = adminRequest(t, handler, http.MethodGet, "rollback", "secret", ``)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, errorStatus(errors.Wrap(&notFoundError{message: "Not found"}, "Failed")))
+	assert.Equal(t, http.StatusBadRequest, errorStatus(&invalidRequestError{message: "Invalid"}))
+	assert.Equal(t, http.StatusConflict, errorStatus(&conflictError{message: "Suspended"}))
+	assert.Equal(t, http.StatusInternalServerError, errorStatus(errors.New("Failed")))
+}
+
+func TestClaimedActor(t *testing.T) {
+	assert.Equal(t, "octocat (claimed)", claimedActor("octocat"))
+	assert.Empty(t, claimedActor(""))
+}
+
+func TestAdminHandler_OrgStatus(t *testing.T) {
+	store := newTestStateStore(t)
+	assert.NoError(t, store.TrackRuleset("test-org", ManagedRuleset{ID: 42, Name: "Default Ruleset", File: "Default Ruleset.json"}))
+	assert.NoError(t, store.RecordOrgSync("test-org", 7, "v1.0.0", nil))
+
+	handler := NewAdminHandler(&RulesetHandler{State: store}, AdminConfig{Token: "secret"})
+
+	rec := adminRequest(t, handler, http.MethodGet, "orgs/test-org", "secret", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"installation_id":7`)
+	assert.Contains(t, rec.Body.String(), `"name":"Default Ruleset"`)
+
+	rec = adminRequest(t, handler, http.MethodGet, "orgs/other-org", "secret", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"error": "The organization other-org has no managed rulesets"}`, rec.Body.String())
+}
+
+func TestAdminHandler_Exemptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exemptions.yml")
+	handler := NewAdminHandler(&RulesetHandler{Config: &Config{Exemptions: ExemptionsConfig{Path: path}}}, AdminConfig{Token: "secret"})
+
+	rec := adminRequest(t, handler, http.MethodGet, "exemptions", "secret", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+
+	rec = adminRequest(t, handler, http.MethodPost, "exemptions", "secret", `{"org": "test-org"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = adminRequest(t, handler, http.MethodPost, "exemptions", "secret", `{"org": "test-org", "ruleset": "Default Ruleset", "allow": ["disabled"], "expires": "2020-01-01T00:00:00Z", "reason": "Incident 123", "approver": "octocat"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "Invalid exemption: expires is in the past"}`, rec.Body.String())
+
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rec = adminRequest(t, handler, http.MethodPost, "exemptions", "secret", `{"org": "test-org", "ruleset": "Default Ruleset", "allow": ["disabled"], "expires": "`+expires+`", "reason": "Incident 123", "approver": "octocat"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = adminRequest(t, handler, http.MethodGet, "exemptions", "secret", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"active":true`)
+
+	rec = adminRequest(t, handler, http.MethodDelete, "exemptions/test-org/Default%20Ruleset", "secret", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"revoked": 1}`, rec.Body.String())
+}
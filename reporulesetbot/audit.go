@@ -0,0 +1,215 @@
+package reporulesetbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Constants for the actions recorded in the audit log.
+const (
+	AuditActionCreate   = "create"
+	AuditActionUpdate   = "update"
+	AuditActionRevert   = "revert"
+	AuditActionRecreate = "recreate"
+	AuditActionSkip     = "skip"
+	AuditActionAlert    = "alert"
+	AuditActionConflict = "conflict"
+	AuditActionDelete   = "delete"
+	AuditActionDisable  = "disable"
+	AuditActionRollback = "rollback"
+)
+
+// defaultAuditPath is the file the audit log is written to when not configured.
+const defaultAuditPath = "audit.jsonl"
+
+// AuditConfig represents the configuration of the audit log.
+type AuditConfig struct {
+	Path string `yaml:"path"`
+}
+
+// AuditEntry represents an action taken by the app on an organization ruleset.
+type AuditEntry struct {
+	Time       time.Time     `json:"time"`
+	DeliveryID string        `json:"delivery_id,omitempty"`
+	Event      string        `json:"event,omitempty"`
+	Org        string        `json:"org"`
+	Ruleset    string        `json:"ruleset"`
+	RulesetID  int64         `json:"ruleset_id,omitempty"`
+	Actor      string        `json:"actor,omitempty"`
+	Action     string        `json:"action"`
+	Reason     string        `json:"reason,omitempty"`
+	Diff       []FieldChange `json:"diff,omitempty"`
+}
+
+// AuditSink records audit entries.
+type AuditSink interface {
+	Record(ctx context.Context, entry AuditEntry) error
+}
+
+// JSONLAuditSink is an AuditSink that appends every entry as a line of JSON to a file.
+type JSONLAuditSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewJSONLAuditSink returns an AuditSink that appends entries to the file at the given path.
+func NewJSONLAuditSink(path string) *JSONLAuditSink {
+	if path == "" {
+		path = defaultAuditPath
+	}
+	return &JSONLAuditSink{path: path}
+}
+
+// Record appends the entry to the audit log file.
+func (s *JSONLAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal audit entry")
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open audit log %s", s.path)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return errors.Wrapf(err, "Failed to write to audit log %s", s.path)
+	}
+	return nil
+}
+
+// maxAuditLineSize is the longest audit log line that can be read back.
+const maxAuditLineSize = 1024 * 1024
+
+// auditReadChunkSize is how much of the audit log is read at a time, from the end of the file.
+const auditReadChunkSize = 64 * 1024
+
+// ReadAuditEntries returns the most recent entries of an audit log file with one of the given actions, or with any
+// action when none are given, newest first. The file is read backwards from its end, so only as much of it as the
+// limit needs is read. A missing file means there are no entries.
+func ReadAuditEntries(path string, limit int, actions ...string) ([]AuditEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open audit log %s", path)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read audit log %s", path)
+	}
+
+	var entries []AuditEntry
+	var partial []byte
+	for offset := info.Size(); offset > 0 && (limit <= 0 || len(entries) < limit); {
+		size := min(int64(auditReadChunkSize), offset)
+		offset -= size
+
+		chunk := make([]byte, size, size+int64(len(partial)))
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return nil, errors.Wrapf(err, "Failed to read audit log %s", path)
+		}
+
+		// The first line of the chunk continues in the previous chunk, unless the chunk starts the file.
+		lines := bytes.Split(append(chunk, partial...), []byte("\n"))
+		partial = nil
+		if offset > 0 {
+			partial, lines = lines[0], lines[1:]
+			if len(partial) > maxAuditLineSize {
+				return nil, errors.Errorf("Failed to read audit log %s: line longer than %d bytes", path, maxAuditLineSize)
+			}
+		}
+
+		for i := len(lines) - 1; i >= 0 && (limit <= 0 || len(entries) < limit); i-- {
+			var entry AuditEntry
+			if err := json.Unmarshal(lines[i], &entry); err != nil {
+				continue
+			}
+			if len(actions) > 0 && !slices.Contains(actions, entry.Action) {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// auditPath returns the file the audit log is written to.
+func (h *RulesetHandler) auditPath() string {
+	if h.Config == nil || h.Config.Audit.Path == "" {
+		return defaultAuditPath
+	}
+	return h.Config.Audit.Path
+}
+
+// eventInfoKey is the context key for the event being handled.
+type eventInfoKey struct{}
+
+// eventInfo describes the webhook event being handled.
+type eventInfo struct {
+	DeliveryID string
+	EventType  string
+	Sender     string
+}
+
+// withEventInfo returns a context carrying the event being handled.
+func withEventInfo(ctx context.Context, info eventInfo) context.Context {
+	return context.WithValue(ctx, eventInfoKey{}, info)
+}
+
+// eventInfoFromContext returns the event being handled, if any.
+func eventInfoFromContext(ctx context.Context) eventInfo {
+	info, _ := ctx.Value(eventInfoKey{}).(eventInfo)
+	return info
+}
+
+// withEventSender returns a context carrying the sender of the event being handled.
+func withEventSender(ctx context.Context, sender string) context.Context {
+	info := eventInfoFromContext(ctx)
+	info.Sender = sender
+	return withEventInfo(ctx, info)
+}
+
+// audit records an action in the audit log and counts it in the metrics. The time, delivery ID, event and actor are
+// filled in from the context when they aren't set. Failures are logged and don't fail the event.
+func (h *RulesetHandler) audit(ctx context.Context, entry AuditEntry, logger zerolog.Logger) {
+	h.incCounter(MetricsKeyRulesetActions, "action", entry.Action)
+
+	if h.Audit == nil {
+		return
+	}
+
+	info := eventInfoFromContext(ctx)
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.DeliveryID == "" {
+		entry.DeliveryID = info.DeliveryID
+	}
+	if entry.Event == "" {
+		entry.Event = info.EventType
+	}
+	if entry.Actor == "" {
+		entry.Actor = info.Sender
+	}
+
+	if err := h.Audit.Record(ctx, entry); err != nil {
+		logger.Error().Err(err).Msgf("Failed to record the %s of ruleset %s in the organization %s in the audit log.", entry.Action, entry.Ruleset, entry.Org)
+	}
+}
@@ -0,0 +1,121 @@
+package reporulesetbot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryAuditSink is an AuditSink that keeps the entries in memory.
+type memoryAuditSink struct {
+	entries []AuditEntry
+}
+
+func (s *memoryAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func TestJSONLAuditSink(t *testing.T) {
+	// Create a temporary directory
+	dir, err := os.MkdirTemp("", "audit_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.jsonl")
+	sink := NewJSONLAuditSink(path)
+
+	assert.NoError(t, sink.Record(context.Background(), AuditEntry{Org: "test-org", Ruleset: "Default Ruleset", Action: AuditActionRevert}))
+	assert.NoError(t, sink.Record(context.Background(), AuditEntry{Org: "test-org", Ruleset: "Default Ruleset", Action: AuditActionRecreate}))
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var actions []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{AuditActionRevert, AuditActionRecreate}, actions)
+}
+
+func TestAudit(t *testing.T) {
+	sink := &memoryAuditSink{}
+	handler := &RulesetHandler{Audit: sink}
+
+	ctx := withEventInfo(context.Background(), eventInfo{DeliveryID: "test-delivery-id", EventType: EventTypeRepositoryRuleset})
+	ctx = withEventSender(ctx, "octocat")
+
+	handler.audit(ctx, AuditEntry{Org: "test-org", Ruleset: "Default Ruleset", Action: AuditActionRevert}, zerolog.Nop())
+
+	assert.Len(t, sink.entries, 1)
+	entry := sink.entries[0]
+	assert.Equal(t, "test-delivery-id", entry.DeliveryID)
+	assert.Equal(t, EventTypeRepositoryRuleset, entry.Event)
+	assert.Equal(t, "octocat", entry.Actor)
+	assert.False(t, entry.Time.IsZero())
+
+	// Without an audit sink nothing is recorded
+	handler = &RulesetHandler{}
+	handler.audit(ctx, AuditEntry{Org: "test-org", Action: AuditActionRevert}, zerolog.Nop())
+}
+
+func TestReadAuditEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	entries, err := ReadAuditEntries(path, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	sink := NewJSONLAuditSink(path)
+	for _, action := range []string{AuditActionRevert, AuditActionSkip, AuditActionRecreate, AuditActionRevert} {
+		assert.NoError(t, sink.Record(context.Background(), AuditEntry{Org: "test-org", Ruleset: "Default Ruleset", Action: action}))
+	}
+
+	entries, err = ReadAuditEntries(path, 2, AuditActionRevert, AuditActionRecreate)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, AuditActionRevert, entries[0].Action)
+		assert.Equal(t, AuditActionRecreate, entries[1].Action)
+	}
+
+	entries, err = ReadAuditEntries(path, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestReadAuditEntries_SpansChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink := NewJSONLAuditSink(path)
+
+	// Entries longer than a chunk are split across the chunks the file is read in.
+	reason := strings.Repeat("x", auditReadChunkSize/3*2)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, sink.Record(context.Background(), AuditEntry{Org: "test-org", Ruleset: fmt.Sprintf("Ruleset %d", i), Action: AuditActionRevert, Reason: reason}))
+	}
+
+	entries, err := ReadAuditEntries(path, 3)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, "Ruleset 9", entries[0].Ruleset)
+		assert.Equal(t, "Ruleset 7", entries[2].Ruleset)
+	}
+
+	entries, err = ReadAuditEntries(path, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 10) {
+		assert.Equal(t, "Ruleset 0", entries[9].Ruleset)
+		assert.Equal(t, reason, entries[9].Reason)
+	}
+}
@@ -0,0 +1,365 @@
+package reporulesetbot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+)
+
+// localRulesetDir is the directory the ruleset files are read from when a release has no ruleset assets.
+const localRulesetDir = "rulesets"
+
+// assetDownloadTimeout is the timeout for downloading a release asset from the location GitHub redirects to.
+const assetDownloadTimeout = 30 * time.Second
+
+// defaultSnapshotsPath is the directory the snapshots of the deployed releases are kept in when not configured.
+const defaultSnapshotsPath = "snapshots"
+
+// rulesetBundle represents the ruleset files of a release, keyed by file name.
+type rulesetBundle struct {
+	Tag   string
+	Files map[string][]byte
+}
+
+// names returns the file names of the bundle in order.
+func (b *rulesetBundle) names() []string {
+	names := make([]string, 0, len(b.Files))
+	for name := range b.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hash returns a hash of the names and content of the files in the bundle, used to tell whether a release changed.
+func (b *rulesetBundle) hash() string {
+	sum := sha256.New()
+	for _, name := range b.names() {
+		sum.Write([]byte(name))
+		sum.Write([]byte{0})
+		sum.Write(b.Files[name])
+		sum.Write([]byte{0})
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// readLocalBundle reads the ruleset files in a directory.
+func readLocalBundle(dir string) (*rulesetBundle, error) {
+	files, err := getRulesetFiles(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get ruleset files")
+	}
+
+	bundle := &rulesetBundle{Files: make(map[string][]byte, len(files))}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read ruleset file %s", file)
+		}
+		bundle.Files[filepath.Base(file)] = data
+	}
+	return bundle, nil
+}
+
+// downloadBundle downloads the JSON assets of a release. It returns nil when the release has no JSON assets.
+func downloadBundle(ctx context.Context, client *github.Client, owner, repo string, release *github.RepositoryRelease) (*rulesetBundle, error) {
+	var assets []*github.ReleaseAsset
+	err := paginate(func(opts *github.ListOptions) (*github.Response, error) {
+		page, resp, err := client.Repositories.ListReleaseAssets(ctx, owner, repo, release.GetID(), opts)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, page...)
+		return resp, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list the assets of release %s", release.GetTagName())
+	}
+
+	bundle := &rulesetBundle{Tag: release.GetTagName(), Files: make(map[string][]byte)}
+	for _, asset := range assets {
+		if !strings.HasSuffix(strings.ToLower(asset.GetName()), ".json") {
+			continue
+		}
+
+		data, err := downloadReleaseAsset(ctx, client, owner, repo, asset.GetID())
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to download asset %s of release %s", asset.GetName(), release.GetTagName())
+		}
+		bundle.Files[asset.GetName()] = data
+	}
+
+	if len(bundle.Files) == 0 {
+		return nil, nil
+	}
+	return bundle, nil
+}
+
+// assetDownloadClient follows the redirects of release asset downloads. It isn't the installation client, which would
+// send its credentials to the storage the assets are served from.
+var assetDownloadClient = &http.Client{
+	Timeout:   assetDownloadTimeout,
+	Transport: TracingMiddleware(otel.GetTracerProvider())(http.DefaultTransport),
+}
+
+// downloadReleaseAsset returns the content of a release asset.
+func downloadReleaseAsset(ctx context.Context, client *github.Client, owner, repo string, assetID int64) ([]byte, error) {
+	rc, _, err := client.Repositories.DownloadReleaseAsset(ctx, owner, repo, assetID, assetDownloadClient)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// appRepo returns a client for the repository of the app, along with its owner and name.
+func (h *RulesetHandler) appRepo(ctx context.Context) (*github.Client, string, string, error) {
+	jwtclient, err := newJWTClient()
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "Failed to create JWT client")
+	}
+
+	app, err := getAuthenticatedApp(ctx, jwtclient)
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "Failed to get app")
+	}
+
+	appRepoName, err := getRepoFullNameFromURL(app.GetExternalURL())
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "Failed to get app repo name")
+	}
+	owner, repo, _ := strings.Cut(appRepoName, "/")
+
+	installationID, err := getOrgAppInstallationID(ctx, jwtclient, owner)
+	if err != nil {
+		return nil, "", "", errors.Wrapf(err, "Failed to get installation ID for the org %s", owner)
+	}
+
+	client, err := h.ClientCreator.NewInstallationClient(installationID)
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "Failed to create installation client")
+	}
+	return client, owner, repo, nil
+}
+
+// cachedBundle returns the bundle of a release if it was already loaded.
+func (h *RulesetHandler) cachedBundle(releaseTag string) (*rulesetBundle, bool) {
+	h.bundlesMu.Lock()
+	defer h.bundlesMu.Unlock()
+
+	bundle, ok := h.bundles[releaseTag]
+	return bundle, ok
+}
+
+// cacheBundle keeps the bundle of a release so it doesn't need to be downloaded again, and records its hash in the
+// state store. A nil bundle records that the release has no ruleset assets.
+func (h *RulesetHandler) cacheBundle(releaseTag string, bundle *rulesetBundle, logger zerolog.Logger) {
+	h.bundlesMu.Lock()
+	if h.bundles == nil {
+		h.bundles = make(map[string]*rulesetBundle)
+	}
+	h.bundles[releaseTag] = bundle
+	h.bundlesMu.Unlock()
+
+	if h.State == nil || bundle == nil {
+		return
+	}
+	if err := h.State.SetBundleHash(releaseTag, bundle.hash()); err != nil {
+		logger.Error().Err(err).Msgf("Failed to record the hash of release %s.", releaseTag)
+	}
+}
+
+// loadBundle downloads the bundle of a release from the repository of the app and caches it. When the release has no
+// JSON assets, its snapshot is used if there is one.
+func (h *RulesetHandler) loadBundle(ctx context.Context, client *github.Client, owner, repo string, release *github.RepositoryRelease, logger zerolog.Logger) (*rulesetBundle, error) {
+	bundle, err := downloadBundle(ctx, client, owner, repo, release)
+	if err != nil {
+		return nil, err
+	}
+	if bundle == nil {
+		bundle, err = readSnapshot(h.snapshotsPath(), release.GetTagName())
+		if err != nil {
+			return nil, err
+		}
+	}
+	h.cacheBundle(release.GetTagName(), bundle, logger)
+	return bundle, nil
+}
+
+// rulesetBundle returns the ruleset files of a release. An empty release tag, and releases without JSON assets or a
+// snapshot, use the files in the local rulesets directory.
+func (h *RulesetHandler) rulesetBundle(ctx context.Context, releaseTag string, logger zerolog.Logger) (*rulesetBundle, error) {
+	if releaseTag == "" {
+		return readLocalBundle(localRulesetDir)
+	}
+
+	bundle, ok := h.cachedBundle(releaseTag)
+	if !ok {
+		var err error
+		bundle, err = h.fetchBundle(ctx, releaseTag, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if bundle == nil {
+		return readLocalBundle(localRulesetDir)
+	}
+	return bundle, nil
+}
+
+// fetchBundle downloads the JSON assets of a release and caches them. When the release has no JSON assets or no longer
+// exists, the snapshot of what was deployed for it is used instead.
+func (h *RulesetHandler) fetchBundle(ctx context.Context, releaseTag string, logger zerolog.Logger) (*rulesetBundle, error) {
+	client, owner, repo, err := h.appRepo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle *rulesetBundle
+	release, resp, err := client.Repositories.GetReleaseByTag(ctx, owner, repo, releaseTag)
+	switch {
+	case err == nil:
+		bundle, err = downloadBundle(ctx, client, owner, repo, release)
+		if err != nil {
+			return nil, err
+		}
+	case resp != nil && resp.StatusCode == http.StatusNotFound:
+		logger.Warn().Msgf("Release %s no longer exists, looking for its snapshot.", releaseTag)
+	default:
+		return nil, errors.Wrapf(err, "Failed to get release %s", releaseTag)
+	}
+
+	if bundle == nil {
+		bundle, err = readSnapshot(h.snapshotsPath(), releaseTag)
+		if err != nil {
+			return nil, err
+		}
+		if bundle == nil && release == nil {
+			return nil, &notFoundError{message: fmt.Sprintf("Release %s doesn't exist and has no snapshot", releaseTag)}
+		}
+	}
+
+	h.cacheBundle(releaseTag, bundle, logger)
+	return bundle, nil
+}
+
+// snapshotsPath returns the directory the snapshots of the deployed releases are kept in.
+func (h *RulesetHandler) snapshotsPath() string {
+	if h.Config == nil || h.Config.State.Snapshots == "" {
+		return defaultSnapshotsPath
+	}
+	return h.Config.State.Snapshots
+}
+
+// recordSnapshot keeps a copy of the ruleset files deployed for a release, so it can be rolled back to even after the
+// release was deleted or the local rulesets directory changed. Failures are logged and don't stop the rollout.
+func (h *RulesetHandler) recordSnapshot(ctx context.Context, releaseTag string, logger zerolog.Logger) {
+	if releaseTag == "" {
+		return
+	}
+
+	bundle, err := h.rulesetBundle(ctx, releaseTag, logger)
+	if err == nil {
+		err = saveSnapshot(h.snapshotsPath(), releaseTag, bundle)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to record the snapshot of release %s.", releaseTag)
+	}
+}
+
+// snapshotDir returns the directory of the snapshot of a release. Tags that aren't valid ref names are rejected, so a
+// tag can't point outside of the snapshots directory.
+func snapshotDir(dir, releaseTag string) (string, error) {
+	if err := validateReleaseTag(releaseTag); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, url.PathEscape(releaseTag)), nil
+}
+
+// validateReleaseTag returns an error if a release tag isn't a valid git ref name.
+func validateReleaseTag(releaseTag string) error {
+	invalid := releaseTag == "" || releaseTag == "@" ||
+		strings.HasPrefix(releaseTag, "/") || strings.HasSuffix(releaseTag, "/") || strings.HasSuffix(releaseTag, ".") ||
+		strings.Contains(releaseTag, "..") || strings.Contains(releaseTag, "//") || strings.Contains(releaseTag, "@{") ||
+		strings.ContainsAny(releaseTag, " ~^:?*[\\\x7f")
+	for _, component := range strings.Split(releaseTag, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			invalid = true
+		}
+	}
+	for _, r := range releaseTag {
+		if r < ' ' {
+			invalid = true
+		}
+	}
+	if invalid {
+		return &invalidRequestError{message: fmt.Sprintf("Invalid release tag %q", releaseTag)}
+	}
+	return nil
+}
+
+// saveSnapshot writes the files of a bundle to the snapshot of a release, replacing an earlier snapshot.
+func saveSnapshot(dir, releaseTag string, bundle *rulesetBundle) error {
+	target, err := snapshotDir(dir, releaseTag)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "Failed to create snapshots directory %s", dir)
+	}
+
+	tmp, err := os.MkdirTemp(dir, ".snapshot-*")
+	if err != nil {
+		return errors.Wrap(err, "Failed to create temporary snapshot directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	for name, data := range bundle.Files {
+		if err := os.WriteFile(filepath.Join(tmp, filepath.Base(name)), data, 0644); err != nil {
+			return errors.Wrapf(err, "Failed to write snapshot file %s", name)
+		}
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return errors.Wrapf(err, "Failed to remove the previous snapshot of release %s", releaseTag)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return errors.Wrapf(err, "Failed to write the snapshot of release %s", releaseTag)
+	}
+	return nil
+}
+
+// readSnapshot reads the snapshot of a release. It returns nil when there is no snapshot.
+func readSnapshot(dir, releaseTag string) (*rulesetBundle, error) {
+	target, err := snapshotDir(dir, releaseTag)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	bundle, err := readLocalBundle(target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read the snapshot of release %s", releaseTag)
+	}
+	bundle.Tag = releaseTag
+	return bundle, nil
+}
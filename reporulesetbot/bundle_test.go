@@ -0,0 +1,139 @@
+package reporulesetbot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClient returns a client for the API served by the handler.
+func newTestClient(t *testing.T, handler http.Handler) *github.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	client.BaseURL = baseURL
+	return client
+}
+
+func TestRulesetBundleHash(t *testing.T) {
+	bundle := &rulesetBundle{Files: map[string][]byte{"b.json": []byte(`{}`), "a.json": []byte(`{"name": "a"}`)}}
+	assert.Equal(t, []string{"a.json", "b.json"}, bundle.names())
+
+	same := &rulesetBundle{Tag: "v2", Files: map[string][]byte{"a.json": []byte(`{"name": "a"}`), "b.json": []byte(`{}`)}}
+	assert.Equal(t, bundle.hash(), same.hash())
+
+	changed := &rulesetBundle{Files: map[string][]byte{"a.json": []byte(`{"name": "a"}`), "b.json": []byte(`{"name": "b"}`)}}
+	assert.NotEqual(t, bundle.hash(), changed.hash())
+}
+
+func TestReadLocalBundle(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Default Ruleset.json"), []byte(`{"name": "Default Ruleset"}`), 0644))
+
+	bundle, err := readLocalBundle(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"Default Ruleset.json": []byte(`{"name": "Default Ruleset"}`)}, bundle.Files)
+
+	_, err = readLocalBundle(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestDownloadReleaseAsset_Redirect(t *testing.T) {
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"name": "Default Ruleset"}`))
+	}))
+	defer storage.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo-org/rulesets/releases/assets/10", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, storage.URL+"/asset", http.StatusFound)
+	})
+
+	data, err := downloadReleaseAsset(context.Background(), newTestClient(t, mux), "octo-org", "rulesets", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name": "Default Ruleset"}`, string(data))
+	assert.Equal(t, assetDownloadTimeout, assetDownloadClient.Timeout)
+}
+
+func TestDownloadBundle(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo-org/rulesets/releases/1/assets", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id": 10, "name": "Default Ruleset.json"}, {"id": 11, "name": "README.md"}]`))
+	})
+	mux.HandleFunc("/repos/octo-org/rulesets/releases/assets/10", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/octet-stream", r.Header.Get("Accept"))
+		w.Write([]byte(`{"name": "Default Ruleset"}`))
+	})
+	mux.HandleFunc("/repos/octo-org/rulesets/releases/2/assets", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	client := newTestClient(t, mux)
+
+	bundle, err := downloadBundle(context.Background(), client, "octo-org", "rulesets", &github.RepositoryRelease{ID: github.Int64(1), TagName: github.String("v1.0.0")})
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", bundle.Tag)
+	assert.Equal(t, map[string][]byte{"Default Ruleset.json": []byte(`{"name": "Default Ruleset"}`)}, bundle.Files)
+
+	// A release without JSON assets has no bundle.
+	bundle, err = downloadBundle(context.Background(), client, "octo-org", "rulesets", &github.RepositoryRelease{ID: github.Int64(2), TagName: github.String("v0.9.0")})
+	assert.NoError(t, err)
+	assert.Nil(t, bundle)
+}
+
+func TestRulesetBundle_Cached(t *testing.T) {
+	logger := zerolog.Nop()
+	h := &RulesetHandler{State: newTestStateStore(t)}
+
+	bundle := &rulesetBundle{Tag: "v1.0.0", Files: map[string][]byte{"a.json": []byte(`{}`)}}
+	h.cacheBundle("v1.0.0", bundle, logger)
+
+	cached, err := h.rulesetBundle(context.Background(), "v1.0.0", logger)
+	assert.NoError(t, err)
+	assert.Same(t, bundle, cached)
+	assert.Equal(t, bundle.hash(), h.State.BundleHash("v1.0.0"))
+}
+
+func TestSnapshots(t *testing.T) {
+	dir := t.TempDir()
+
+	bundle, err := readSnapshot(dir, "release/v1.0.0")
+	assert.NoError(t, err)
+	assert.Nil(t, bundle)
+
+	assert.NoError(t, saveSnapshot(dir, "release/v1.0.0", &rulesetBundle{Files: map[string][]byte{"a.json": []byte(`{"name": "a"}`)}}))
+	assert.NoError(t, saveSnapshot(dir, "release/v1.0.0", &rulesetBundle{Files: map[string][]byte{"b.json": []byte(`{"name": "b"}`)}}))
+
+	// A new snapshot of the same release replaces the old one.
+	bundle, err = readSnapshot(dir, "release/v1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "release/v1.0.0", bundle.Tag)
+	assert.Equal(t, map[string][]byte{"b.json": []byte(`{"name": "b"}`)}, bundle.Files)
+
+	// Tags that aren't valid ref names can't point outside of the snapshots directory.
+	for _, tag := range []string{"..", ".", "../v1.0.0", "v1.0.0/..", ".hidden", "v1.0.0.lock", "v1 0", ""} {
+		assert.Error(t, saveSnapshot(dir, tag, &rulesetBundle{}), tag)
+		_, err := readSnapshot(dir, tag)
+		assert.Error(t, err, tag)
+	}
+}
+
+func TestValidateReleaseTag(t *testing.T) {
+	for _, tag := range []string{"v1.0.0", "release/v1.0.0", "v1.0.0-rc.1"} {
+		assert.NoError(t, validateReleaseTag(tag), tag)
+	}
+	for _, tag := range []string{"", "@", ".", "..", "a..b", "/v1", "v1/", "a//b", "v1.", "a@{1}", "v1~1", "v1^", "a:b", "a?b", "a*b", "a[b", "a\\b", "a\tb"} {
+		assert.Error(t, validateReleaseTag(tag), tag)
+	}
+}
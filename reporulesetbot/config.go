@@ -11,8 +11,23 @@ import (
 
 // Config represents the configuration of the application.
 type Config struct {
-	Server HTTPConfig       `yaml:"server"`
-	Github githubapp.Config `yaml:"github"`
+	Server            HTTPConfig               `yaml:"server"`
+	Github            githubapp.Config         `yaml:"github"`
+	RateLimit         RateLimitConfig          `yaml:"rate_limit"`
+	Release           ReleaseConfig            `yaml:"release"`
+	State             StateConfig              `yaml:"state"`
+	Audit             AuditConfig              `yaml:"audit"`
+	Notifications     NotificationsConfig      `yaml:"notifications"`
+	Rulesets          map[string]RulesetPolicy `yaml:"rulesets"`
+	Exemptions        ExemptionsConfig         `yaml:"exemptions"`
+	Conflicts         ConflictsConfig          `yaml:"conflicts"`
+	GarbageCollection GarbageCollectionConfig  `yaml:"garbage_collection"`
+	Admin             AdminConfig              `yaml:"admin"`
+	Dashboard         DashboardConfig          `yaml:"dashboard"`
+	Queue             QueueConfig              `yaml:"queue"`
+	Tracing           TracingConfig            `yaml:"tracing"`
+	Log               LogConfig                `yaml:"log"`
+	Deliveries        DeliveriesConfig         `yaml:"deliveries"`
 }
 
 // HTTPConfig represents the configuration of the HTTP server.
@@ -61,6 +76,32 @@ func validateConfig(config *Config) error {
 		}
 	}
 
+	if err := config.Release.validate(); err != nil {
+		return errors.Wrap(err, "Invalid release configuration")
+	}
+
+	if err := config.Conflicts.validate(); err != nil {
+		return err
+	}
+
+	if err := config.GarbageCollection.validate(); err != nil {
+		return err
+	}
+
+	if err := config.Log.validate(); err != nil {
+		return errors.Wrap(err, "Invalid log configuration")
+	}
+
+	if err := config.Tracing.validate(); err != nil {
+		return errors.Wrap(err, "Invalid tracing configuration")
+	}
+
+	for name, policy := range config.Rulesets {
+		if err := policy.validate(); err != nil {
+			return errors.Wrapf(err, "Invalid policy for ruleset %s", name)
+		}
+	}
+
 	return nil
 }
 
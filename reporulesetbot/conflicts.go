@@ -0,0 +1,246 @@
+package reporulesetbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Constants for what the app does with an unmanaged ruleset that conflicts with a managed one.
+const (
+	// ConflictActionReport only records and notifies about the conflict.
+	ConflictActionReport = "report"
+	// ConflictActionRename renames an unmanaged ruleset that has the name of a managed one.
+	ConflictActionRename = "rename"
+	// ConflictActionDelete deletes an unmanaged ruleset that has the name of a managed one. Rulesets that only overlap
+	// with a managed one are reported, since they are often unrelated rulesets of the organization.
+	ConflictActionDelete = "delete"
+	// ConflictActionAdopt makes an unmanaged ruleset with the name of a managed one the managed ruleset, when the
+	// managed ruleset no longer exists in the organization.
+	ConflictActionAdopt = "adopt"
+)
+
+// Constants for the kinds of conflicts.
+const (
+	ConflictNameCollision = "name_collision"
+	ConflictOverlap       = "overlapping_target"
+)
+
+// renamedRulesetSuffix is appended to the name of an unmanaged ruleset renamed because of a name collision.
+const renamedRulesetSuffix = " (unmanaged)"
+
+// ConflictsConfig represents the configuration of how conflicting unmanaged rulesets are handled.
+type ConflictsConfig struct {
+	Action string `yaml:"action"`
+}
+
+// validate checks that the configuration only uses known values.
+func (c ConflictsConfig) validate() error {
+	switch c.Action {
+	case "", ConflictActionReport, ConflictActionRename, ConflictActionDelete, ConflictActionAdopt:
+		return nil
+	default:
+		return errors.Errorf("Unknown conflict action %s, expected one of %s, %s, %s or %s", c.Action, ConflictActionReport, ConflictActionRename, ConflictActionDelete, ConflictActionAdopt)
+	}
+}
+
+// Conflict represents an unmanaged ruleset that conflicts with a managed one.
+type Conflict struct {
+	Kind    string
+	Ruleset *DesiredRuleset
+	Rules   []string
+}
+
+// String returns a description of the conflict.
+func (c Conflict) String() string {
+	if c.Kind == ConflictNameCollision {
+		return fmt.Sprintf("Ruleset has the same name as the managed ruleset %s", c.Ruleset.Name)
+	}
+	return fmt.Sprintf("Ruleset targets the same refs and repositories as the managed ruleset %s with the rules %s", c.Ruleset.Name, strings.Join(c.Rules, ", "))
+}
+
+// findConflict returns the first managed ruleset the unmanaged ruleset conflicts with, if any. Rulesets with the same
+// name conflict, as do rulesets with the same target, overlapping ref and repository conditions, and a rule type in
+// common.
+func findConflict(unmanaged *github.Ruleset, rulesets []*DesiredRuleset) *Conflict {
+	for _, ruleset := range rulesets {
+		if ruleset.Name == unmanaged.Name {
+			return &Conflict{Kind: ConflictNameCollision, Ruleset: ruleset}
+		}
+	}
+
+	for _, ruleset := range rulesets {
+		if rules := overlappingRules(unmanaged, ruleset.Ruleset); len(rules) > 0 {
+			return &Conflict{Kind: ConflictOverlap, Ruleset: ruleset, Rules: rules}
+		}
+	}
+	return nil
+}
+
+// overlappingRules returns the rule types two rulesets both enforce on the same refs of the same repositories.
+// Conditions that can't be compared, such as repository properties, are not considered overlapping.
+func overlappingRules(a, b *github.Ruleset) []string {
+	if rulesetTarget(a) != rulesetTarget(b) || a.Conditions == nil || b.Conditions == nil {
+		return nil
+	}
+
+	if a.Conditions.RefName == nil || b.Conditions.RefName == nil || !patternsOverlap(a.Conditions.RefName.Include, b.Conditions.RefName.Include) {
+		return nil
+	}
+
+	switch {
+	case a.Conditions.RepositoryName != nil && b.Conditions.RepositoryName != nil:
+		if !patternsOverlap(a.Conditions.RepositoryName.Include, b.Conditions.RepositoryName.Include) {
+			return nil
+		}
+	case a.Conditions.RepositoryID != nil && b.Conditions.RepositoryID != nil:
+		if !idsOverlap(a.Conditions.RepositoryID.RepositoryIDs, b.Conditions.RepositoryID.RepositoryIDs) {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	types := make(map[string]bool)
+	for _, rule := range b.Rules {
+		types[rule.Type] = true
+	}
+
+	var rules []string
+	for _, rule := range a.Rules {
+		if types[rule.Type] {
+			rules = append(rules, rule.Type)
+		}
+	}
+	return rules
+}
+
+// rulesetTarget returns the target of a ruleset, which defaults to branches.
+func rulesetTarget(ruleset *github.Ruleset) string {
+	if ruleset.GetTarget() == "" {
+		return "branch"
+	}
+	return ruleset.GetTarget()
+}
+
+// patternsOverlap returns true when two lists of include patterns have a pattern in common or one of them includes
+// everything.
+func patternsOverlap(a, b []string) bool {
+	for _, pattern := range a {
+		if pattern == "~ALL" {
+			return len(b) > 0
+		}
+		for _, other := range b {
+			if other == "~ALL" || other == pattern {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// idsOverlap returns true when two lists of IDs have an ID in common.
+func idsOverlap(a, b []int64) bool {
+	for _, id := range a {
+		for _, other := range b {
+			if id == other {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// conflictAction returns the configured action for conflicting rulesets.
+func (h *RulesetHandler) conflictAction() string {
+	if h.Config == nil || h.Config.Conflicts.Action == "" {
+		return ConflictActionReport
+	}
+	return h.Config.Conflicts.Action
+}
+
+// resolveConflict applies the configured action to an unmanaged ruleset that conflicts with a managed one, records
+// it in the audit log and notifies about it. Actions that don't apply to the kind of conflict fall back to reporting it.
+func (h *RulesetHandler) resolveConflict(ctx context.Context, client *github.Client, orgName string, unmanaged *github.Ruleset, conflict *Conflict, managed []ManagedRuleset, logger zerolog.Logger) error {
+	rulesetID := unmanaged.GetID()
+	action := h.conflictAction()
+	resolution := "Reported"
+
+	logger.Info().Msgf("Ruleset %s in the organization %s conflicts with the managed ruleset %s: %s.", unmanaged.Name, orgName, conflict.Ruleset.Name, conflict.Kind)
+
+	var err error
+	switch {
+	case action == ConflictActionDelete && conflict.Kind == ConflictNameCollision:
+		err = deleteRuleset(ctx, client, orgName, rulesetID, logger)
+		resolution = "Deleted"
+	case action == ConflictActionRename && conflict.Kind == ConflictNameCollision:
+		var name string
+		name, err = renameUnmanagedRuleset(ctx, client, orgName, rulesetID, unmanaged.Name, logger)
+		resolution = fmt.Sprintf("Renamed to %s", name)
+	case action == ConflictActionAdopt && conflict.Kind == ConflictNameCollision:
+		resolution, err = h.adoptRuleset(ctx, client, orgName, rulesetID, conflict.Ruleset, managed, logger)
+	}
+
+	summary := fmt.Sprintf("%s. %s.", conflict, resolution)
+	if err != nil {
+		h.notifyFailure(ctx, orgName, unmanaged.Name, err, logger)
+		return errors.Wrapf(err, "Failed to resolve the conflict of ruleset %s in organization %s", unmanaged.Name, orgName)
+	}
+
+	h.audit(ctx, AuditEntry{Org: orgName, Ruleset: unmanaged.Name, RulesetID: rulesetID, Action: AuditActionConflict, Reason: summary}, logger)
+	h.notify(ctx, Notification{Kind: NotificationConflict, Org: orgName, Ruleset: unmanaged.Name, Summary: summary}, logger)
+	return nil
+}
+
+// renameUnmanagedRuleset renames an unmanaged ruleset by appending the suffix to its name, numbered when a ruleset with
+// that name already exists in the organization. It returns the new name.
+func renameUnmanagedRuleset(ctx context.Context, client *github.Client, orgName string, rulesetID int64, name string, logger zerolog.Logger) (string, error) {
+	orgRulesets, err := getOrgRulesets(ctx, client, orgName)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get organization rulesets")
+	}
+
+	renamed := unusedRulesetName(orgRulesets, name)
+	if err := renameRuleset(ctx, client, orgName, rulesetID, renamed, logger); err != nil {
+		return "", err
+	}
+	return renamed, nil
+}
+
+// unusedRulesetName returns the name with the suffix for renamed rulesets appended, followed by a number when the name
+// is already used by one of the rulesets.
+func unusedRulesetName(rulesets []*github.Ruleset, name string) string {
+	used := make(map[string]bool, len(rulesets))
+	for _, ruleset := range rulesets {
+		used[ruleset.Name] = true
+	}
+
+	renamed := name + renamedRulesetSuffix
+	for i := 2; used[renamed]; i++ {
+		renamed = fmt.Sprintf("%s (unmanaged %d)", name, i)
+	}
+	return renamed
+}
+
+// adoptRuleset makes an unmanaged ruleset the managed one and brings it in line with the configuration, unless the
+// managed ruleset still exists in the organization. It returns a description of the outcome.
+func (h *RulesetHandler) adoptRuleset(ctx context.Context, client *github.Client, orgName string, rulesetID int64, ruleset *DesiredRuleset, managed []ManagedRuleset, logger zerolog.Logger) (string, error) {
+	if trackedID := trackedRulesetID(managed, ruleset.File); trackedID != 0 {
+		orgRulesets, err := getOrgRulesets(ctx, client, orgName)
+		if err != nil {
+			return "", errors.Wrap(err, "Failed to get organization rulesets")
+		}
+		if hasRulesetID(orgRulesets, trackedID) {
+			return fmt.Sprintf("Not adopted because the managed ruleset with ID %d still exists", trackedID), nil
+		}
+	}
+
+	if err := h.updateOrgRuleset(ctx, client, orgName, rulesetID, ruleset, h.orgRelease(orgName), logger); err != nil {
+		return "", err
+	}
+	return "Adopted as the managed ruleset", nil
+}
@@ -0,0 +1,161 @@
+package reporulesetbot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindConflict(t *testing.T) {
+	managed := []*DesiredRuleset{{
+		Ruleset: newTestRuleset(t, `{
+			"name": "Default Ruleset",
+			"target": "branch",
+			"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"]}, "repository_name": {"include": ["~ALL"]}},
+			"rules": [{"type": "deletion"}, {"type": "non_fast_forward"}]
+		}`),
+		File: "Default Ruleset.json",
+	}}
+
+	t.Run("name collision", func(t *testing.T) {
+		conflict := findConflict(newTestRuleset(t, `{"name": "Default Ruleset"}`), managed)
+		assert.Equal(t, &Conflict{Kind: ConflictNameCollision, Ruleset: managed[0]}, conflict)
+	})
+
+	t.Run("overlapping target", func(t *testing.T) {
+		conflict := findConflict(newTestRuleset(t, `{
+			"name": "Team Ruleset",
+			"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"]}, "repository_name": {"include": ["service-*"]}},
+			"rules": [{"type": "non_fast_forward"}, {"type": "required_signatures"}]
+		}`), managed)
+		assert.Equal(t, &Conflict{Kind: ConflictOverlap, Ruleset: managed[0], Rules: []string{"non_fast_forward"}}, conflict)
+	})
+
+	t.Run("no conflict", func(t *testing.T) {
+		tests := []string{
+			`{"name": "Tag Ruleset", "target": "tag", "conditions": {"ref_name": {"include": ["~ALL"]}, "repository_name": {"include": ["~ALL"]}}, "rules": [{"type": "deletion"}]}`,
+			`{"name": "Release Ruleset", "conditions": {"ref_name": {"include": ["refs/heads/release/*"]}, "repository_name": {"include": ["~ALL"]}}, "rules": [{"type": "deletion"}]}`,
+			`{"name": "Signing Ruleset", "conditions": {"ref_name": {"include": ["~ALL"]}, "repository_name": {"include": ["~ALL"]}}, "rules": [{"type": "required_signatures"}]}`,
+			`{"name": "Property Ruleset", "conditions": {"ref_name": {"include": ["~ALL"]}, "repository_property": {"include": []}}, "rules": [{"type": "deletion"}]}`,
+		}
+		for _, test := range tests {
+			assert.Nil(t, findConflict(newTestRuleset(t, test), managed), test)
+		}
+	})
+}
+
+func TestPatternsOverlap(t *testing.T) {
+	assert.True(t, patternsOverlap([]string{"~ALL"}, []string{"refs/heads/main"}))
+	assert.True(t, patternsOverlap([]string{"refs/heads/main"}, []string{"~ALL"}))
+	assert.True(t, patternsOverlap([]string{"a", "b"}, []string{"c", "b"}))
+	assert.False(t, patternsOverlap([]string{"a"}, []string{"b"}))
+	assert.False(t, patternsOverlap([]string{"~ALL"}, nil))
+}
+
+func TestResolveConflict(t *testing.T) {
+	logger := zerolog.Nop()
+	unmanaged := newTestRuleset(t, `{"id": 42, "name": "Default Ruleset", "enforcement": "disabled"}`)
+	conflict := &Conflict{Kind: ConflictNameCollision, Ruleset: &DesiredRuleset{Ruleset: &github.Ruleset{Name: "Default Ruleset"}}}
+
+	tests := []struct {
+		action     string
+		wantMethod string
+		wantName   string
+		wantReason string
+	}{
+		{ConflictActionReport, "", "", "Ruleset has the same name as the managed ruleset Default Ruleset. Reported."},
+		{ConflictActionDelete, http.MethodDelete, "", "Ruleset has the same name as the managed ruleset Default Ruleset. Deleted."},
+		{ConflictActionRename, http.MethodPut, "Default Ruleset (unmanaged 2)", "Ruleset has the same name as the managed ruleset Default Ruleset. Renamed to Default Ruleset (unmanaged 2)."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			var method, name string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/orgs/test-org/rulesets" {
+					_, _ = w.Write([]byte(`[{"id": 42, "name": "Default Ruleset"}, {"id": 43, "name": "Default Ruleset (unmanaged)"}]`))
+					return
+				}
+				assert.Equal(t, "/orgs/test-org/rulesets/42", r.URL.Path)
+				if r.Method == http.MethodGet {
+					_, _ = w.Write([]byte(`{"id": 42, "name": "Default Ruleset", "enforcement": "disabled"}`))
+					return
+				}
+				method = r.Method
+				if r.Method == http.MethodPut {
+					var body github.Ruleset
+					assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+					name = body.Name
+					assert.Equal(t, "disabled", body.Enforcement)
+					_, _ = w.Write([]byte(`{"id": 42}`))
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			client := github.NewClient(nil)
+			baseURL, err := url.Parse(server.URL + "/")
+			assert.NoError(t, err)
+			client.BaseURL = baseURL
+
+			sink := &memoryAuditSink{}
+			notifier := &recordingNotifier{}
+			h := &RulesetHandler{Config: &Config{Conflicts: ConflictsConfig{Action: tt.action}}, Audit: sink, Notifier: notifier}
+
+			err = h.resolveConflict(context.Background(), client, "test-org", unmanaged, conflict, nil, logger)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMethod, method)
+			assert.Equal(t, tt.wantName, name)
+
+			assert.Len(t, sink.entries, 1)
+			assert.Equal(t, AuditActionConflict, sink.entries[0].Action)
+			assert.Equal(t, tt.wantReason, sink.entries[0].Reason)
+			assert.Len(t, notifier.notifications, 1)
+			assert.Equal(t, NotificationConflict, notifier.notifications[0].Kind)
+		})
+	}
+}
+
+func TestResolveConflict_OverlapIsOnlyReported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	client.BaseURL = baseURL
+
+	unmanaged := newTestRuleset(t, `{"id": 42, "name": "Team Ruleset"}`)
+	conflict := &Conflict{Kind: ConflictOverlap, Ruleset: &DesiredRuleset{Ruleset: &github.Ruleset{Name: "Default Ruleset"}}, Rules: []string{"pull_request"}}
+
+	for _, action := range []string{ConflictActionDelete, ConflictActionRename, ConflictActionAdopt} {
+		sink := &memoryAuditSink{}
+		h := &RulesetHandler{Config: &Config{Conflicts: ConflictsConfig{Action: action}}, Audit: sink, Notifier: &recordingNotifier{}}
+
+		assert.NoError(t, h.resolveConflict(context.Background(), client, "test-org", unmanaged, conflict, nil, zerolog.Nop()))
+		if assert.Len(t, sink.entries, 1) {
+			assert.Contains(t, sink.entries[0].Reason, "Reported.", action)
+		}
+	}
+}
+
+func TestUnusedRulesetName(t *testing.T) {
+	assert.Equal(t, "Default (unmanaged)", unusedRulesetName([]*github.Ruleset{{Name: "Default"}}, "Default"))
+	assert.Equal(t, "Default (unmanaged 3)", unusedRulesetName([]*github.Ruleset{{Name: "Default (unmanaged)"}, {Name: "Default (unmanaged 2)"}}, "Default"))
+}
+
+func TestConflictsConfig_Validate(t *testing.T) {
+	assert.NoError(t, ConflictsConfig{}.validate())
+	assert.NoError(t, ConflictsConfig{Action: ConflictActionAdopt}.validate())
+	assert.Error(t, ConflictsConfig{Action: "ignore"}.validate())
+}
@@ -0,0 +1,264 @@
+package reporulesetbot
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// DashboardRoute is the path the status dashboard is served at.
+const DashboardRoute = "/dashboard"
+
+// Constants for the status of an organization or ruleset on the dashboard, from best to worst.
+const (
+	DashboardStatusCompliant = "compliant"
+	DashboardStatusOutdated  = "outdated"
+	DashboardStatusDrifted   = "drifted"
+	DashboardStatusFailed    = "failed"
+	DashboardStatusSuspended = "suspended"
+)
+
+// dashboardAuditEntries is the number of drift entries read from the audit log for the dashboard.
+const dashboardAuditEntries = 1000
+
+// dashboardReverts is the number of recent reverts shown on the dashboard.
+const dashboardReverts = 25
+
+// dashboardStatusRank orders the statuses, so an organization shows the worst status of its rulesets.
+var dashboardStatusRank = map[string]int{
+	DashboardStatusCompliant: 0,
+	DashboardStatusOutdated:  1,
+	DashboardStatusDrifted:   2,
+	DashboardStatusFailed:    3,
+	DashboardStatusSuspended: 4,
+}
+
+// DashboardConfig represents the configuration of the status dashboard. The dashboard is only served when a token is
+// set.
+type DashboardConfig struct {
+	Token string `yaml:"token"`
+}
+
+// dashboardRuleset represents a managed ruleset on the dashboard.
+type dashboardRuleset struct {
+	ManagedRulesetStatus
+	Status    string
+	LastDrift *AuditEntry
+}
+
+// dashboardOrg represents an organization on the dashboard.
+type dashboardOrg struct {
+	InstallationStatus
+	Status   string
+	Rulesets []dashboardRuleset
+}
+
+// dashboardData represents everything shown on the dashboard.
+type dashboardData struct {
+	GeneratedAt   time.Time
+	LatestRelease string
+	Orgs          []dashboardOrg
+	Reverts       []AuditEntry
+	Progress      *RolloutProgress
+	LastRollout   *RolloutReport
+	Errors        []string
+}
+
+// NewDashboardHandler returns the handler of the read-only status dashboard. The configured token is the password of
+// HTTP basic authentication, so the dashboard can be opened in a browser.
+func NewDashboardHandler(h *RulesetHandler, config DashboardConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, ok := r.BasicAuth()
+		if !ok || config.Token == "" || subtle.ConstantTimeCompare([]byte(password), []byte(config.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="repo-ruleset-bot"`)
+			http.Error(w, "A valid dashboard token is required", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(w, h.dashboardData()); err != nil {
+			h.Logger.Error().Err(err).Msg("Failed to render the dashboard.")
+		}
+	})
+}
+
+// dashboardData collects the status of every organization from the state store, the drift and reverts from the audit
+// log, and the progress of the current rollout. Errors are shown on the dashboard rather than failing it.
+func (h *RulesetHandler) dashboardData() dashboardData {
+	data := dashboardData{
+		GeneratedAt: time.Now().UTC(),
+		Progress:    h.RolloutProgress(),
+		LastRollout: h.LastRolloutReport(),
+	}
+
+	drift, err := ReadAuditEntries(h.auditPath(), dashboardAuditEntries, AuditActionRevert, AuditActionRecreate, AuditActionAlert)
+	if err != nil {
+		data.Errors = append(data.Errors, err.Error())
+	}
+
+	lastDrift := make(map[string]*AuditEntry)
+	for i := range drift {
+		entry := &drift[i]
+		if _, ok := lastDrift[entry.Org+"/"+entry.Ruleset]; !ok {
+			lastDrift[entry.Org+"/"+entry.Ruleset] = entry
+		}
+		if entry.Action != AuditActionAlert && len(data.Reverts) < dashboardReverts {
+			data.Reverts = append(data.Reverts, *entry)
+		}
+	}
+
+	if h.State == nil {
+		data.Errors = append(data.Errors, "The state store is not configured, no organization can be shown")
+		return data
+	}
+	data.LatestRelease = h.State.Release()
+
+	for orgName := range h.State.Orgs() {
+		status, ok, err := h.OrgStatus(orgName)
+		if err != nil {
+			data.Errors = append(data.Errors, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		org := dashboardOrg{InstallationStatus: status.InstallationStatus, Status: DashboardStatusCompliant}
+		for _, ruleset := range status.Rulesets {
+			current := dashboardRuleset{ManagedRulesetStatus: ruleset, LastDrift: lastDrift[orgName+"/"+ruleset.Name]}
+			current.Status = rulesetDashboardStatus(current, data.LatestRelease)
+			org.Status = worseDashboardStatus(org.Status, current.Status)
+			org.Rulesets = append(org.Rulesets, current)
+		}
+
+		switch {
+		case org.Suspended:
+			org.Status = DashboardStatusSuspended
+		case org.LastError != "":
+			org.Status = DashboardStatusFailed
+		case org.Release != data.LatestRelease:
+			org.Status = worseDashboardStatus(org.Status, DashboardStatusOutdated)
+		}
+		data.Orgs = append(data.Orgs, org)
+	}
+	sort.Slice(data.Orgs, func(i, j int) bool { return data.Orgs[i].Org < data.Orgs[j].Org })
+
+	return data
+}
+
+// rulesetDashboardStatus returns the status of a managed ruleset. A ruleset has drifted when a change to it was left in
+// place in alert mode after it was last synced.
+func rulesetDashboardStatus(ruleset dashboardRuleset, latestRelease string) string {
+	switch {
+	case ruleset.LastError != "":
+		return DashboardStatusFailed
+	case ruleset.LastDrift != nil && ruleset.LastDrift.Action == AuditActionAlert && ruleset.LastDrift.Time.After(ruleset.LastSync):
+		return DashboardStatusDrifted
+	case ruleset.Release != latestRelease:
+		return DashboardStatusOutdated
+	default:
+		return DashboardStatusCompliant
+	}
+}
+
+// worseDashboardStatus returns the worse of two statuses.
+func worseDashboardStatus(a, b string) string {
+	if dashboardStatusRank[b] > dashboardStatusRank[a] {
+		return b
+	}
+	return a
+}
+
+// dashboardTemplate renders the dashboard. It has no external assets, so it works without access to the internet.
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"percent": func(done, total int) int {
+		if total == 0 {
+			return 0
+		}
+		return done * 100 / total
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="60">
+<title>Repo Ruleset Bot</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1f2328; }
+h1, h2 { font-weight: 600; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.4em 0.8em; border-bottom: 1px solid #d0d7de; vertical-align: top; }
+th { background: #f6f8fa; }
+.muted { color: #656d76; }
+.status { font-weight: 600; padding: 0.1em 0.5em; border-radius: 1em; white-space: nowrap; }
+.compliant { background: #dafbe1; color: #1a7f37; }
+.outdated { background: #fff8c5; color: #9a6700; }
+.drifted { background: #ffebe9; color: #cf222e; }
+.failed, .suspended { background: #cf222e; color: #ffffff; }
+.errors { background: #ffebe9; padding: 0.5em 1em; }
+.bar { background: #eaeef2; border-radius: 0.3em; height: 1em; width: 30em; }
+.bar div { background: #1f883d; border-radius: 0.3em; height: 1em; }
+</style>
+</head>
+<body>
+<h1>Repo Ruleset Bot</h1>
+<p class="muted">Latest release {{if .LatestRelease}}{{.LatestRelease}}{{else}}none{{end}}. Generated {{time .GeneratedAt}}.</p>
+{{if .Errors}}<div class="errors">{{range .Errors}}<p>{{.}}</p>{{end}}</div>{{end}}
+
+<h2>Rollout</h2>
+{{with .Progress}}
+<p>Rolling out release {{.Release}} since {{time .StartedAt}}{{if .Wave}}, wave {{.Wave}} ({{.WaveIndex}} of {{.Waves}}){{end}}: {{.Done}} of {{.Total}} organization(s) done, {{.Failed}} failed.</p>
+<div class="bar"><div style="width: {{percent .Done .Total}}%"></div></div>
+{{else}}
+<p>No rollout in progress.</p>
+{{end}}
+{{with .LastRollout}}
+<p class="muted">Last rollout: release {{.Release}}, finished {{time .FinishedAt}}, {{.Count "success"}} succeeded, {{.Count "failed"}} failed, {{.Count "skipped"}} skipped.{{if .Aborted}} Stopped: {{.Aborted}}.{{end}}</p>
+{{end}}
+
+<h2>Organizations</h2>
+<table>
+<tr><th>Organization</th><th>Status</th><th>Release</th><th>Last sync</th><th>Managed rulesets</th></tr>
+{{range .Orgs}}
+<tr>
+<td>{{.Org}}</td>
+<td><span class="status {{.Status}}">{{.Status}}</span>{{if .LastError}}<br><span class="muted">{{.LastError}}</span>{{end}}</td>
+<td>{{.Release}}</td>
+<td>{{time .LastSync}}</td>
+<td>
+{{range .Rulesets}}
+<div><span class="status {{.Status}}">{{.Status}}</span> {{.Name}} <span class="muted">{{.Release}}{{with .LastDrift}}, last {{.Action}} {{time .Time}}{{if .Actor}} by {{.Actor}}{{end}}{{end}}{{if .LastError}}, {{.LastError}}{{end}}</span></div>
+{{else}}
+<span class="muted">None</span>
+{{end}}
+</td>
+</tr>
+{{else}}
+<tr><td colspan="5" class="muted">No organizations have been synced yet.</td></tr>
+{{end}}
+</table>
+
+<h2>Recent Reverts</h2>
+<table>
+<tr><th>Time</th><th>Organization</th><th>Ruleset</th><th>Action</th><th>Changed by</th><th>Reason</th></tr>
+{{range .Reverts}}
+<tr><td>{{time .Time}}</td><td>{{.Org}}</td><td>{{.Ruleset}}</td><td>{{.Action}}</td><td>{{.Actor}}</td><td>{{.Reason}}</td></tr>
+{{else}}
+<tr><td colspan="6" class="muted">No reverts in the audit log.</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
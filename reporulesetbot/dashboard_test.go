@@ -0,0 +1,64 @@
+package reporulesetbot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDashboardHandler(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink := NewJSONLAuditSink(auditPath)
+
+	store := newTestStateStore(t)
+	assert.NoError(t, store.SetRelease("v1.1.0"))
+	assert.NoError(t, store.TrackRuleset("org-a", ManagedRuleset{ID: 1, Name: "Default Ruleset", File: "Default Ruleset.json"}))
+	assert.NoError(t, store.RecordRulesetSync("org-a", "Default Ruleset.json", "Default Ruleset", "abc123", "v1.1.0", nil))
+	assert.NoError(t, store.RecordOrgSync("org-a", 1, "v1.1.0", nil))
+	assert.NoError(t, store.TrackRuleset("org-b", ManagedRuleset{ID: 2, Name: "Default Ruleset", File: "Default Ruleset.json"}))
+	assert.NoError(t, store.RecordRulesetSync("org-b", "Default Ruleset.json", "Default Ruleset", "abc123", "v1.0.0", nil))
+	assert.NoError(t, store.RecordOrgSync("org-b", 2, "v1.0.0", nil))
+
+	assert.NoError(t, sink.Record(context.Background(), AuditEntry{Time: time.Now().Add(time.Minute), Org: "org-a", Ruleset: "Default Ruleset", Action: AuditActionAlert, Actor: "octocat"}))
+	assert.NoError(t, sink.Record(context.Background(), AuditEntry{Time: time.Now(), Org: "org-b", Ruleset: "Default Ruleset", Action: AuditActionRevert, Actor: "<hubot>"}))
+
+	h := &RulesetHandler{Config: &Config{Audit: AuditConfig{Path: auditPath}}, State: store}
+	handler := NewDashboardHandler(h, DashboardConfig{Token: "secret"})
+
+	req := httptest.NewRequest(http.MethodGet, DashboardRoute, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+
+	req = httptest.NewRequest(http.MethodGet, DashboardRoute, nil)
+	req.SetBasicAuth("security", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Latest release v1.1.0")
+	assert.Contains(t, rec.Body.String(), "No rollout in progress.")
+	// User content is escaped.
+	assert.Contains(t, rec.Body.String(), "&lt;hubot&gt;")
+
+	data := h.dashboardData()
+	assert.Empty(t, data.Errors)
+	if assert.Len(t, data.Orgs, 2) {
+		assert.Equal(t, DashboardStatusDrifted, data.Orgs[0].Status)
+		assert.Equal(t, DashboardStatusOutdated, data.Orgs[1].Status)
+		assert.Equal(t, AuditActionRevert, data.Orgs[1].Rulesets[0].LastDrift.Action)
+	}
+	if assert.Len(t, data.Reverts, 1) {
+		assert.Equal(t, "org-b", data.Reverts[0].Org)
+	}
+}
+
+func TestWorseDashboardStatus(t *testing.T) {
+	assert.Equal(t, DashboardStatusFailed, worseDashboardStatus(DashboardStatusOutdated, DashboardStatusFailed))
+	assert.Equal(t, DashboardStatusDrifted, worseDashboardStatus(DashboardStatusDrifted, DashboardStatusCompliant))
+}
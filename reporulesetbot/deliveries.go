@@ -0,0 +1,239 @@
+package reporulesetbot
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// defaultDeliveryRetention is how long processed deliveries are remembered when not configured. GitHub only lets the
+// deliveries of the past three days be redelivered.
+const defaultDeliveryRetention = 72 * time.Hour
+
+// defaultMaxDeliveries is how many processed deliveries are remembered when not configured.
+const defaultMaxDeliveries = 10000
+
+// DeliveriesConfig represents the configuration of the de-duplication of webhook deliveries. A negative retention
+// turns it off.
+type DeliveriesConfig struct {
+	Retention  time.Duration `yaml:"retention"`
+	MaxEntries int           `yaml:"max_entries"`
+}
+
+// retention returns the configured retention window, or the default when it isn't set.
+func (c DeliveriesConfig) retention() time.Duration {
+	if c.Retention == 0 {
+		return defaultDeliveryRetention
+	}
+	return c.Retention
+}
+
+// maxEntries returns the configured number of deliveries remembered, or the default when it isn't set.
+func (c DeliveriesConfig) maxEntries() int {
+	if c.MaxEntries <= 0 {
+		return defaultMaxDeliveries
+	}
+	return c.MaxEntries
+}
+
+// DeliveryRecord represents a webhook delivery the app processed, and a hash of the rulesets it applied.
+type DeliveryRecord struct {
+	Event       string    `json:"event"`
+	Action      string    `json:"action,omitempty"`
+	Hash        string    `json:"hash,omitempty"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// deliveryCache remembers the processed deliveries in memory, and forgets the least recently seen ones once it holds
+// its maximum number of entries.
+type deliveryCache struct {
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+	inFlight   map[string]bool
+}
+
+// deliveryEntry is an entry of a deliveryCache.
+type deliveryEntry struct {
+	id     string
+	record DeliveryRecord
+}
+
+// newDeliveryCache returns an empty delivery cache that remembers up to maxEntries deliveries.
+func newDeliveryCache(maxEntries int) *deliveryCache {
+	return &deliveryCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		inFlight:   make(map[string]bool),
+	}
+}
+
+// get returns the record of a delivery processed within the retention window.
+func (c *deliveryCache) get(deliveryID string, retention time.Duration) (DeliveryRecord, bool) {
+	element, ok := c.entries[deliveryID]
+	if !ok {
+		return DeliveryRecord{}, false
+	}
+
+	entry := element.Value.(*deliveryEntry)
+	if time.Since(entry.record.ProcessedAt) > retention {
+		c.order.Remove(element)
+		delete(c.entries, deliveryID)
+		return DeliveryRecord{}, false
+	}
+	c.order.MoveToFront(element)
+	return entry.record, true
+}
+
+// add records a processed delivery, and forgets the least recently seen delivery when the cache is full.
+func (c *deliveryCache) add(deliveryID string, record DeliveryRecord) {
+	if element, ok := c.entries[deliveryID]; ok {
+		element.Value.(*deliveryEntry).record = record
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[deliveryID] = c.order.PushFront(&deliveryEntry{id: deliveryID, record: record})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*deliveryEntry).id)
+	}
+}
+
+// appliedContentKey is the context key for the rulesets applied by the delivery being handled.
+type appliedContentKey struct{}
+
+// appliedContent collects the hashes of the rulesets applied by a delivery, keyed by organization and ruleset file.
+type appliedContent struct {
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+// withAppliedContent returns a context that collects the rulesets applied while handling a delivery.
+func withAppliedContent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, appliedContentKey{}, &appliedContent{hashes: make(map[string]string)})
+}
+
+// addAppliedContent adds a ruleset applied to an organization to the content applied by the delivery being handled,
+// if any.
+func addAppliedContent(ctx context.Context, orgName, file, hash string) {
+	content, ok := ctx.Value(appliedContentKey{}).(*appliedContent)
+	if !ok {
+		return
+	}
+
+	content.mu.Lock()
+	defer content.mu.Unlock()
+	content.hashes[orgName+"/"+file] = hash
+}
+
+// appliedContentHash returns a hash of the rulesets applied by the delivery being handled, or an empty string when it
+// applied none.
+func appliedContentHash(ctx context.Context) string {
+	content, ok := ctx.Value(appliedContentKey{}).(*appliedContent)
+	if !ok {
+		return ""
+	}
+
+	content.mu.Lock()
+	defer content.mu.Unlock()
+	if len(content.hashes) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(content.hashes))
+	for key := range content.hashes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sum := sha256.New()
+	for _, key := range keys {
+		sum.Write([]byte(key + ":" + content.hashes[key] + "\n"))
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// deliveryRetention returns how long processed deliveries are remembered.
+func (h *RulesetHandler) deliveryRetention() time.Duration {
+	if h.Config == nil {
+		return defaultDeliveryRetention
+	}
+	return h.Config.Deliveries.retention()
+}
+
+// deliveryCache returns the cache of processed deliveries. The caller must hold deliveriesMu.
+func (h *RulesetHandler) deliveryCache() *deliveryCache {
+	if h.deliveries == nil {
+		maxEntries := defaultMaxDeliveries
+		if h.Config != nil {
+			maxEntries = h.Config.Deliveries.maxEntries()
+		}
+		h.deliveries = newDeliveryCache(maxEntries)
+	}
+	return h.deliveries
+}
+
+// startDelivery marks a delivery as being processed. It returns false when the delivery is a duplicate, because it is
+// already being processed or was processed within the retention window, along with the record of the earlier
+// processing when there is one. Deliveries are remembered in memory, so they are forgotten when the app restarts.
+func (h *RulesetHandler) startDelivery(deliveryID string) (*DeliveryRecord, bool) {
+	if deliveryID == "" || h.deliveryRetention() < 0 {
+		return nil, true
+	}
+
+	h.deliveriesMu.Lock()
+	defer h.deliveriesMu.Unlock()
+
+	cache := h.deliveryCache()
+	if cache.inFlight[deliveryID] {
+		return nil, false
+	}
+	if record, ok := cache.get(deliveryID, h.deliveryRetention()); ok {
+		return &record, false
+	}
+
+	cache.inFlight[deliveryID] = true
+	return nil, true
+}
+
+// finishDelivery records a delivery that was processed, with a hash of the rulesets it applied. Failed deliveries are
+// not recorded, so they are processed again when they are redelivered.
+func (h *RulesetHandler) finishDelivery(ctx context.Context, deliveryID, eventType, action string, err error) {
+	if deliveryID == "" || h.deliveryRetention() < 0 {
+		return
+	}
+
+	var record DeliveryRecord
+	if err == nil {
+		record = DeliveryRecord{Event: eventType, Action: action, Hash: appliedContentHash(ctx), ProcessedAt: time.Now().UTC()}
+	}
+
+	h.deliveriesMu.Lock()
+	defer h.deliveriesMu.Unlock()
+
+	cache := h.deliveryCache()
+	delete(cache.inFlight, deliveryID)
+	if err == nil {
+		cache.add(deliveryID, record)
+	}
+}
+
+// suppressDelivery logs and counts a duplicate delivery that is skipped.
+func (h *RulesetHandler) suppressDelivery(deliveryID, eventType string, record *DeliveryRecord, logger zerolog.Logger) {
+	h.incCounter(MetricsKeyEventsDuplicates, "type", eventType)
+
+	if record == nil {
+		logger.Info().Msgf("Skipping the delivery %s, which is already being processed.", deliveryID)
+		return
+	}
+	logger.Info().Str("applied_hash", record.Hash).Msgf("Skipping the delivery %s, which was already processed at %s.", deliveryID, record.ProcessedAt.Format(time.RFC3339))
+}
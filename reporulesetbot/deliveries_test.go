@@ -0,0 +1,130 @@
+package reporulesetbot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppliedContentHash(t *testing.T) {
+	assert.Empty(t, appliedContentHash(context.Background()))
+
+	ctx := withAppliedContent(context.Background())
+	assert.Empty(t, appliedContentHash(ctx))
+
+	addAppliedContent(ctx, "org-1", "a.json", "hash-a")
+	addAppliedContent(ctx, "org-2", "b.json", "hash-b")
+	hash := appliedContentHash(ctx)
+	assert.Len(t, hash, 64)
+
+	other := withAppliedContent(context.Background())
+	addAppliedContent(other, "org-2", "b.json", "hash-b")
+	addAppliedContent(other, "org-1", "a.json", "hash-a")
+	assert.Equal(t, hash, appliedContentHash(other))
+
+	addAppliedContent(other, "org-1", "a.json", "hash-c")
+	assert.NotEqual(t, hash, appliedContentHash(other))
+}
+
+func TestDeliveryCache(t *testing.T) {
+	cache := newDeliveryCache(2)
+	now := time.Now()
+
+	cache.add("delivery-1", DeliveryRecord{Event: EventTypeRelease, ProcessedAt: now})
+	cache.add("delivery-2", DeliveryRecord{Event: EventTypeRelease, ProcessedAt: now})
+	_, ok := cache.get("delivery-1", time.Hour)
+	assert.True(t, ok)
+
+	// The least recently seen delivery is forgotten once the cache is full.
+	cache.add("delivery-3", DeliveryRecord{Event: EventTypeRelease, ProcessedAt: now})
+	_, ok = cache.get("delivery-2", time.Hour)
+	assert.False(t, ok)
+	_, ok = cache.get("delivery-1", time.Hour)
+	assert.True(t, ok)
+	_, ok = cache.get("delivery-3", time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, 2, cache.order.Len())
+
+	// Deliveries processed before the retention window are forgotten.
+	cache.add("delivery-4", DeliveryRecord{Event: EventTypeRelease, ProcessedAt: now.Add(-2 * time.Hour)})
+	_, ok = cache.get("delivery-4", time.Hour)
+	assert.False(t, ok)
+	assert.Len(t, cache.entries, 1)
+}
+
+func TestStartDelivery(t *testing.T) {
+	h := &RulesetHandler{}
+
+	_, ok := h.startDelivery("delivery-1")
+	assert.True(t, ok)
+
+	// A delivery that is being processed is a duplicate.
+	record, ok := h.startDelivery("delivery-1")
+	assert.False(t, ok)
+	assert.Nil(t, record)
+
+	ctx := withAppliedContent(context.Background())
+	addAppliedContent(ctx, "org-1", "a.json", "hash-a")
+	h.finishDelivery(ctx, "delivery-1", EventTypeRepositoryRuleset, ActionEdited, nil)
+
+	record, ok = h.startDelivery("delivery-1")
+	assert.False(t, ok)
+	if assert.NotNil(t, record) {
+		assert.Equal(t, EventTypeRepositoryRuleset, record.Event)
+		assert.Equal(t, ActionEdited, record.Action)
+		assert.Equal(t, appliedContentHash(ctx), record.Hash)
+	}
+
+	// A failed delivery is processed again when it is redelivered.
+	_, ok = h.startDelivery("delivery-2")
+	assert.True(t, ok)
+	h.finishDelivery(context.Background(), "delivery-2", EventTypeRelease, ActionReleased, errors.New("Failed"))
+	_, ok = h.startDelivery("delivery-2")
+	assert.True(t, ok)
+
+	// Deliveries without an ID are always processed.
+	_, ok = h.startDelivery("")
+	assert.True(t, ok)
+	_, ok = h.startDelivery("")
+	assert.True(t, ok)
+}
+
+func TestStartDeliveryRetention(t *testing.T) {
+	h := &RulesetHandler{Config: &Config{Deliveries: DeliveriesConfig{Retention: time.Hour}}}
+
+	h.deliveryCache().add("old", DeliveryRecord{Event: EventTypeRelease, ProcessedAt: time.Now().Add(-2 * time.Hour)})
+	h.deliveryCache().add("recent", DeliveryRecord{Event: EventTypeRelease, ProcessedAt: time.Now()})
+
+	_, ok := h.startDelivery("old")
+	assert.True(t, ok)
+	_, ok = h.startDelivery("recent")
+	assert.False(t, ok)
+
+	h.Config.Deliveries.Retention = -1
+	_, ok = h.startDelivery("recent")
+	assert.True(t, ok)
+	_, ok = h.startDelivery("recent")
+	assert.True(t, ok)
+}
+
+func TestHandleSuppressesDuplicateDeliveries(t *testing.T) {
+	registry := metrics.NewRegistry()
+	h := &RulesetHandler{Metrics: registry}
+
+	payload := []byte(`{"action": "created", "release": {"tag_name": "v1.0.0"}, "repository": {"full_name": "octo-org/rulesets"}}`)
+	assert.NoError(t, h.Handle(context.Background(), EventTypeRelease, "delivery-1", payload))
+	assert.NoError(t, h.Handle(context.Background(), EventTypeRelease, "delivery-1", payload))
+	assert.NoError(t, h.Handle(context.Background(), EventTypeRelease, "delivery-2", payload))
+
+	assert.Equal(t, int64(2), registry.Get("events.handled[type:release,action:created]").(metrics.Counter).Count())
+	assert.Equal(t, int64(1), registry.Get("events.duplicates[type:release]").(metrics.Counter).Count())
+
+	record, ok := h.deliveryCache().get("delivery-1", time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, EventTypeRelease, record.Event)
+	assert.Empty(t, record.Hash)
+}
@@ -0,0 +1,183 @@
+package reporulesetbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+)
+
+// FieldChange represents the change of a single field between two versions of a ruleset.
+type FieldChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// String returns a human readable description of the change.
+func (c FieldChange) String() string {
+	switch {
+	case c.From == nil:
+		return fmt.Sprintf("%s: added %s", c.Path, formatValue(c.To))
+	case c.To == nil:
+		return fmt.Sprintf("%s: removed %s", c.Path, formatValue(c.From))
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Path, formatValue(c.From), formatValue(c.To))
+	}
+}
+
+// formatValue formats a JSON value for a change description.
+func formatValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// ignoredRulesetFields are fields that are set by GitHub and don't describe the policy of a ruleset.
+var ignoredRulesetFields = []string{"id", "node_id", "_links", "source", "source_type", "created_at", "updated_at", "current_user_can_bypass"}
+
+// ignoredRuleFields are fields of a rule that describe where it comes from rather than what it enforces.
+var ignoredRuleFields = []string{"ruleset_id", "ruleset_source", "ruleset_source_type"}
+
+// diffRulesets returns the semantic differences between two rulesets, sorted by path.
+// Rules are compared by type and bypass actors by actor, so the order of the lists doesn't matter.
+// A nil ruleset is treated as an empty one.
+func diffRulesets(before, after *github.Ruleset) ([]FieldChange, error) {
+	from, err := normalizeRuleset(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := normalizeRuleset(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FieldChange
+	diffValues("", from, to, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// normalizeRuleset converts a ruleset to a generic JSON value that can be compared field by field.
+func normalizeRuleset(ruleset *github.Ruleset) (map[string]interface{}, error) {
+	normalized := make(map[string]interface{})
+	if ruleset == nil {
+		ruleset = &github.Ruleset{}
+	}
+
+	data, err := json.Marshal(ruleset)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal ruleset")
+	}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal ruleset")
+	}
+
+	for _, field := range ignoredRulesetFields {
+		delete(normalized, field)
+	}
+
+	rules, _ := normalized["rules"].([]interface{})
+	for _, rule := range rules {
+		if rule, ok := rule.(map[string]interface{}); ok {
+			for _, field := range ignoredRuleFields {
+				delete(rule, field)
+			}
+		}
+	}
+	normalized["rules"] = keyBy(rules, func(rule map[string]interface{}) string {
+		return fmt.Sprintf("%v", rule["type"])
+	})
+
+	actors, _ := normalized["bypass_actors"].([]interface{})
+	normalized["bypass_actors"] = keyBy(actors, func(actor map[string]interface{}) string {
+		return fmt.Sprintf("%v:%v", actor["actor_type"], formatValue(actor["actor_id"]))
+	})
+
+	return normalized, nil
+}
+
+// keyBy converts a list of objects to a map keyed by the given function.
+func keyBy(list []interface{}, key func(map[string]interface{}) string) map[string]interface{} {
+	keyed := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		if object, ok := item.(map[string]interface{}); ok {
+			keyed[key(object)] = object
+		}
+	}
+	return keyed
+}
+
+// diffValues appends the differences between two JSON values to changes.
+func diffValues(path string, from, to interface{}, changes *[]FieldChange) {
+	if isEmptyValue(from) && isEmptyValue(to) {
+		return
+	}
+
+	fromMap, fromIsMap := from.(map[string]interface{})
+	toMap, toIsMap := to.(map[string]interface{})
+	if fromIsMap && toIsMap {
+		keys := make(map[string]bool)
+		for k := range fromMap {
+			keys[k] = true
+		}
+		for k := range toMap {
+			keys[k] = true
+		}
+		for k := range keys {
+			diffValues(joinPath(path, k), fromMap[k], toMap[k], changes)
+		}
+		return
+	}
+
+	if reflect.DeepEqual(from, to) {
+		return
+	}
+
+	if isEmptyValue(from) {
+		from = nil
+	}
+	if isEmptyValue(to) {
+		to = nil
+	}
+	*changes = append(*changes, FieldChange{Path: path, From: from, To: to})
+}
+
+// isEmptyValue returns true for JSON values that are equivalent to a missing field.
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// joinPath appends a key to a dotted JSON path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// summarizeChanges returns a one line summary of the changes.
+func summarizeChanges(changes []FieldChange) string {
+	descriptions := make([]string, 0, len(changes))
+	for _, change := range changes {
+		descriptions = append(descriptions, change.String())
+	}
+	return strings.Join(descriptions, "; ")
+}
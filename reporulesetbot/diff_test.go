@@ -0,0 +1,92 @@
+package reporulesetbot
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRuleset returns a ruleset parsed from JSON.
+func newTestRuleset(t *testing.T, data string) *github.Ruleset {
+	var ruleset *github.Ruleset
+	assert.NoError(t, json.Unmarshal([]byte(data), &ruleset))
+	return ruleset
+}
+
+func TestDiffRulesets(t *testing.T) {
+	desired := newTestRuleset(t, `{
+		"id": 1969150,
+		"name": "Default Ruleset",
+		"source": "source-org",
+		"enforcement": "active",
+		"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"], "exclude": []}},
+		"rules": [
+			{"type": "deletion"},
+			{"type": "pull_request", "parameters": {"required_approving_review_count": 2, "dismiss_stale_reviews_on_push": true, "require_code_owner_review": false, "require_last_push_approval": false, "required_review_thread_resolution": false}}
+		],
+		"bypass_actors": []
+	}`)
+
+	t.Run("identical rulesets in another organization", func(t *testing.T) {
+		live := newTestRuleset(t, `{
+			"id": 42,
+			"name": "Default Ruleset",
+			"source": "target-org",
+			"enforcement": "active",
+			"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"], "exclude": []}},
+			"rules": [
+				{"type": "pull_request", "parameters": {"required_approving_review_count": 2, "dismiss_stale_reviews_on_push": true, "require_code_owner_review": false, "require_last_push_approval": false, "required_review_thread_resolution": false}},
+				{"type": "deletion"}
+			]
+		}`)
+
+		changes, err := diffRulesets(live, desired)
+		assert.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("edited fields, rules and bypass actors", func(t *testing.T) {
+		live := newTestRuleset(t, `{
+			"id": 42,
+			"name": "Default Ruleset",
+			"enforcement": "disabled",
+			"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"], "exclude": []}},
+			"rules": [
+				{"type": "pull_request", "parameters": {"required_approving_review_count": 0, "dismiss_stale_reviews_on_push": true, "require_code_owner_review": false, "require_last_push_approval": false, "required_review_thread_resolution": false}},
+				{"type": "non_fast_forward"}
+			],
+			"bypass_actors": [{"actor_id": 7, "actor_type": "Team", "bypass_mode": "always"}]
+		}`)
+
+		changes, err := diffRulesets(live, desired)
+		assert.NoError(t, err)
+
+		var paths []string
+		for _, change := range changes {
+			paths = append(paths, change.Path)
+		}
+		assert.Equal(t, []string{
+			"bypass_actors.Team:7",
+			"enforcement",
+			"rules.deletion",
+			"rules.non_fast_forward",
+			"rules.pull_request.parameters.required_approving_review_count",
+		}, paths)
+
+		assert.Equal(t, "enforcement: \"disabled\" -> \"active\"", changes[1].String())
+		assert.Equal(t, "rules.deletion: added {\"type\":\"deletion\"}", changes[2].String())
+		assert.Equal(t, "rules.non_fast_forward: removed {\"type\":\"non_fast_forward\"}", changes[3].String())
+		assert.Equal(t, "rules.pull_request.parameters.required_approving_review_count: 0 -> 2", changes[4].String())
+	})
+
+	t.Run("new ruleset", func(t *testing.T) {
+		changes, err := diffRulesets(nil, desired)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, changes)
+		for _, change := range changes {
+			assert.Nil(t, change.From)
+		}
+	})
+}
@@ -0,0 +1,383 @@
+package reporulesetbot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+)
+
+// ExemptionAllowDisabled is the allowed change that lets an organization disable a ruleset, or set it to evaluate.
+const ExemptionAllowDisabled = "disabled"
+
+// eventTypeExemptionExpired is recorded in the audit log for the changes made when an exemption expires.
+const eventTypeExemptionExpired = "exemption_expired"
+
+// Defaults for the exemptions configuration.
+const (
+	defaultExemptionsPath          = "exemptions.yml"
+	defaultExemptionsCheckInterval = time.Minute
+)
+
+// ExemptionsConfig represents the configuration of the break-glass exemptions.
+type ExemptionsConfig struct {
+	Path          string        `yaml:"path"`
+	CheckInterval time.Duration `yaml:"check_interval"`
+}
+
+// withDefaults returns the configuration with the defaults filled in.
+func (c ExemptionsConfig) withDefaults() ExemptionsConfig {
+	if c.Path == "" {
+		c.Path = defaultExemptionsPath
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = defaultExemptionsCheckInterval
+	}
+	return c
+}
+
+// Exemption represents a time-boxed permission for an organization to change a managed ruleset. Allow lists the
+// dotted JSON paths, as used in the audit log, that the organization may change, or disabled to let it lower the
+// enforcement of the ruleset.
+type Exemption struct {
+	Org      string    `yaml:"org" json:"org"`
+	Ruleset  string    `yaml:"ruleset" json:"ruleset"`
+	Allow    []string  `yaml:"allow" json:"allow"`
+	Expires  time.Time `yaml:"expires" json:"expires"`
+	Reason   string    `yaml:"reason" json:"reason"`
+	Approver string    `yaml:"approver" json:"approver"`
+}
+
+// exemptionsFile represents the file the exemptions are read from.
+type exemptionsFile struct {
+	Exemptions []Exemption `yaml:"exemptions"`
+}
+
+// ReadExemptions reads the exemptions from a YAML file. A missing file means there are no exemptions.
+func ReadExemptions(path string) ([]Exemption, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read exemptions file: %s", path)
+	}
+
+	var file exemptionsFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse exemptions file: %s", path)
+	}
+
+	for i, exemption := range file.Exemptions {
+		if err := exemption.validate(); err != nil {
+			return nil, errors.Wrapf(err, "Invalid exemption %d in %s", i+1, path)
+		}
+	}
+	return file.Exemptions, nil
+}
+
+// WriteExemptions replaces the exemptions in a YAML file. The file is written to a temporary file in the same directory
+// first, so the app never reads a partial file. The file is rewritten from the exemptions, so comments and formatting
+// in it are not kept.
+func WriteExemptions(path string, exemptions []Exemption) error {
+	data, err := yaml.Marshal(exemptionsFile{Exemptions: exemptions})
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode exemptions")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "Failed to create temporary exemptions file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "Failed to write exemptions file: %s", path)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "Failed to write exemptions file: %s", path)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to write exemptions file: %s", path)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrapf(err, "Failed to write exemptions file: %s", path)
+	}
+	return nil
+}
+
+// validate checks that every field of the exemption is set.
+func (e Exemption) validate() error {
+	requiredFields := map[string]interface{}{
+		"org":      e.Org,
+		"ruleset":  e.Ruleset,
+		"allow":    e.Allow,
+		"reason":   e.Reason,
+		"approver": e.Approver,
+	}
+	for field, value := range requiredFields {
+		if isEmpty(value) {
+			return errors.Errorf("%s is required", field)
+		}
+	}
+	if e.Expires.IsZero() {
+		return errors.New("expires is required")
+	}
+	return nil
+}
+
+// appliesTo returns true when the exemption is for the ruleset in the organization.
+func (e Exemption) appliesTo(orgName, rulesetName string) bool {
+	return strings.EqualFold(e.Org, orgName) && e.Ruleset == rulesetName
+}
+
+// activeAt returns true when the exemption hasn't expired at the given time.
+func (e Exemption) activeAt(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// allows returns true when the change is covered by the exemption.
+func (e Exemption) allows(change FieldChange) bool {
+	for _, allowed := range e.Allow {
+		if allowed == ExemptionAllowDisabled {
+			if change.Path == "enforcement" && enforcementRank[change.From] < enforcementRank["active"] {
+				return true
+			}
+			continue
+		}
+		if change.Path == allowed || strings.HasPrefix(change.Path, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a description of the exemption for the audit log.
+func (e Exemption) String() string {
+	return fmt.Sprintf("Exempted until %s by %s: %s", e.Expires.UTC().Format(time.RFC3339), e.Approver, e.Reason)
+}
+
+// exemptionsConfig returns the exemptions configuration with the defaults filled in.
+func (h *RulesetHandler) exemptionsConfig() ExemptionsConfig {
+	var config ExemptionsConfig
+	if h.Config != nil {
+		config = h.Config.Exemptions
+	}
+	return config.withDefaults()
+}
+
+// readExemptions returns the configured exemptions. The file is read every time so exemptions can be granted without
+// restarting the app. When the file can't be read the error is logged and no exemptions apply.
+func (h *RulesetHandler) readExemptions(logger zerolog.Logger) []Exemption {
+	exemptions, err := ReadExemptions(h.exemptionsConfig().Path)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to read the exemptions, enforcing every ruleset.")
+		return nil
+	}
+	return exemptions
+}
+
+// Exemptions returns every configured exemption, including the expired ones.
+func (h *RulesetHandler) Exemptions() ([]Exemption, error) {
+	return ReadExemptions(h.exemptionsConfig().Path)
+}
+
+// AddExemption adds an exemption to the exemptions file. It applies from the next event or sync of the organization.
+func (h *RulesetHandler) AddExemption(exemption Exemption) error {
+	if err := exemption.validate(); err != nil {
+		return errors.Wrap(err, "Invalid exemption")
+	}
+	if !exemption.activeAt(time.Now()) {
+		return errors.New("Invalid exemption: expires is in the past")
+	}
+
+	h.exemptionsMu.Lock()
+	defer h.exemptionsMu.Unlock()
+
+	path := h.exemptionsConfig().Path
+	exemptions, err := ReadExemptions(path)
+	if err != nil {
+		return err
+	}
+	return WriteExemptions(path, append(exemptions, exemption))
+}
+
+// RevokeExemptions ends the active exemptions for a ruleset in an organization by setting their expiry to now, and
+// returns how many were revoked. They are kept in the file as a record, and the next check of the exemptions restores
+// the ruleset.
+func (h *RulesetHandler) RevokeExemptions(orgName, rulesetName string) (int, error) {
+	h.exemptionsMu.Lock()
+	defer h.exemptionsMu.Unlock()
+
+	path := h.exemptionsConfig().Path
+	exemptions, err := ReadExemptions(path)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	revoked := 0
+	for i, exemption := range exemptions {
+		if exemption.appliesTo(orgName, rulesetName) && exemption.activeAt(now) {
+			exemptions[i].Expires = now
+			revoked++
+		}
+	}
+
+	if revoked == 0 {
+		return 0, nil
+	}
+	return revoked, WriteExemptions(path, exemptions)
+}
+
+// applyExemptions leaves out the changes covered by the active exemptions for a ruleset, so the organization's
+// exempted changes are kept. It returns the ruleset to apply, the remaining changes, and the exemptions that were
+// applied.
+func (h *RulesetHandler) applyExemptions(orgName, rulesetName string, live, target *github.Ruleset, changes []FieldChange, logger zerolog.Logger) (*github.Ruleset, []FieldChange, []Exemption, error) {
+	now := time.Now()
+	var active []Exemption
+	for _, exemption := range h.readExemptions(logger) {
+		if exemption.appliesTo(orgName, rulesetName) && exemption.activeAt(now) {
+			active = append(active, exemption)
+		}
+	}
+	if len(active) == 0 {
+		return target, changes, nil, nil
+	}
+
+	used := make([]bool, len(active))
+	var remaining []FieldChange
+	for _, change := range changes {
+		exempted := false
+		for i, exemption := range active {
+			if exemption.allows(change) {
+				used[i] = true
+				exempted = true
+				break
+			}
+		}
+		if !exempted {
+			remaining = append(remaining, change)
+		}
+	}
+	if len(remaining) == len(changes) {
+		return target, changes, nil, nil
+	}
+
+	var applied []Exemption
+	for i, exemption := range active {
+		if used[i] {
+			logger.Info().Msgf("Ruleset %s in the organization %s is exempted until %s by %s: %s.", rulesetName, orgName, exemption.Expires.UTC().Format(time.RFC3339), exemption.Approver, exemption.Reason)
+			applied = append(applied, exemption)
+		}
+	}
+
+	if len(remaining) == 0 {
+		return target, nil, applied, nil
+	}
+
+	target, err := applyChanges(live, remaining)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return target, remaining, applied, nil
+}
+
+// describeExemptions returns a description of the exemptions for the audit log.
+func describeExemptions(exemptions []Exemption) string {
+	descriptions := make([]string, 0, len(exemptions))
+	for _, exemption := range exemptions {
+		descriptions = append(descriptions, exemption.String())
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// WatchExemptions restores the managed rulesets of an organization once its exemptions expire. It checks the
+// exemptions at the configured interval until the context is canceled.
+func (h *RulesetHandler) WatchExemptions(ctx context.Context) {
+	ticker := time.NewTicker(h.exemptionsConfig().CheckInterval)
+	defer ticker.Stop()
+
+	restored := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.restoreExpiredExemptions(ctx, now, restored, h.Logger)
+		}
+	}
+}
+
+// restoreExpiredExemptions syncs the organizations whose exemptions have expired since they were last synced.
+// restored keeps track of the latest expiry that was restored for each organization.
+func (h *RulesetHandler) restoreExpiredExemptions(ctx context.Context, now time.Time, restored map[string]time.Time, logger zerolog.Logger) {
+	exemptions := h.readExemptions(logger)
+	if h.State != nil {
+		for i := range exemptions {
+			exemptions[i].Org = h.State.OrgName(exemptions[i].Org)
+		}
+	}
+
+	for orgName, expires := range expiredExemptions(exemptions, now) {
+		if !restored[orgName].Before(expires) || h.isOrgSuspended(orgName) {
+			continue
+		}
+		if h.State != nil {
+			if org, ok := h.State.Org(orgName); ok && !org.LastSync.Before(expires) {
+				restored[orgName] = expires
+				continue
+			}
+		}
+
+		logger.Info().Msgf("An exemption for the organization %s expired, restoring its rulesets.", orgName)
+		if err := h.restoreOrganization(ctx, orgName, logger); err != nil {
+			logger.Error().Err(err).Msgf("Failed to restore the rulesets in the organization %s after an exemption expired.", orgName)
+			continue
+		}
+		restored[orgName] = expires
+	}
+}
+
+// expiredExemptions returns the latest expiry of the expired exemptions of each organization. Organization names are
+// matched case-insensitively and keyed by their first spelling.
+func expiredExemptions(exemptions []Exemption, now time.Time) map[string]time.Time {
+	expired := make(map[string]time.Time)
+	for _, exemption := range exemptions {
+		if exemption.activeAt(now) {
+			continue
+		}
+		orgName := exemption.Org
+		for name := range expired {
+			if strings.EqualFold(name, orgName) {
+				orgName = name
+				break
+			}
+		}
+		if exemption.Expires.After(expired[orgName]) {
+			expired[orgName] = exemption.Expires
+		}
+	}
+	return expired
+}
+
+// restoreOrganization syncs the rulesets of an organization outside of a webhook event.
+func (h *RulesetHandler) restoreOrganization(ctx context.Context, orgName string, logger zerolog.Logger) error {
+	installationID, err := h.orgInstallationID(ctx, orgName)
+	if err != nil {
+		return err
+	}
+
+	logger = orgLogger(logger, orgName, installationID).With().Str(LogFieldEventType, eventTypeExemptionExpired).Logger()
+	ctx = withEventInfo(ctx, eventInfo{EventType: eventTypeExemptionExpired})
+	return h.syncOrganization(ctx, installationID, orgName, h.orgRelease(orgName), logger)
+}
@@ -0,0 +1,222 @@
+package reporulesetbot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestExemptions writes an exemptions file and returns its path.
+func writeTestExemptions(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "exemptions.yml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestReadExemptions(t *testing.T) {
+	path := writeTestExemptions(t, `
+exemptions:
+  - org: test-org
+    ruleset: Default Ruleset
+    allow: [disabled]
+    expires: 2024-10-01T18:00:00Z
+    reason: Incident 123
+    approver: octocat
+`)
+
+	exemptions, err := ReadExemptions(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []Exemption{{
+		Org:      "test-org",
+		Ruleset:  "Default Ruleset",
+		Allow:    []string{ExemptionAllowDisabled},
+		Expires:  time.Date(2024, 10, 1, 18, 0, 0, 0, time.UTC),
+		Reason:   "Incident 123",
+		Approver: "octocat",
+	}}, exemptions)
+
+	exemptions, err = ReadExemptions(filepath.Join(t.TempDir(), "missing.yml"))
+	assert.NoError(t, err)
+	assert.Empty(t, exemptions)
+
+	_, err = ReadExemptions(writeTestExemptions(t, `
+exemptions:
+  - org: test-org
+    ruleset: Default Ruleset
+    allow: [disabled]
+    expires: 2024-10-01T18:00:00Z
+`))
+	assert.Error(t, err)
+}
+
+func TestWriteExemptions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "exemptions.yml")
+	exemption := Exemption{Org: "test-org", Ruleset: "Default Ruleset", Allow: []string{ExemptionAllowDisabled}, Expires: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), Reason: "Incident", Approver: "octocat"}
+
+	assert.NoError(t, WriteExemptions(path, []Exemption{exemption}))
+	exemptions, err := ReadExemptions(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []Exemption{exemption}, exemptions)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// The temporary file is renamed over the exemptions file.
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestExemptionAllows(t *testing.T) {
+	exemption := Exemption{Allow: []string{ExemptionAllowDisabled, "conditions.ref_name.exclude"}}
+
+	assert.True(t, exemption.allows(FieldChange{Path: "enforcement", From: "disabled", To: "active"}))
+	assert.True(t, exemption.allows(FieldChange{Path: "enforcement", From: "evaluate", To: "active"}))
+	assert.False(t, exemption.allows(FieldChange{Path: "enforcement", From: "active", To: "evaluate"}))
+	assert.True(t, exemption.allows(FieldChange{Path: "conditions.ref_name.exclude", From: []interface{}{"refs/heads/hotfix"}}))
+	assert.False(t, exemption.allows(FieldChange{Path: "conditions.ref_name.include", From: []interface{}{"~ALL"}}))
+	assert.False(t, exemption.allows(FieldChange{Path: "rules.deletion", To: map[string]interface{}{"type": "deletion"}}))
+}
+
+func TestApplyExemptions(t *testing.T) {
+	logger := zerolog.Nop()
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	path := writeTestExemptions(t, `
+exemptions:
+  - org: Test-Org
+    ruleset: Default Ruleset
+    allow: [disabled]
+    expires: `+expires+`
+    reason: Incident 123
+    approver: octocat
+  - org: test-org
+    ruleset: Default Ruleset
+    allow: [rules]
+    expires: 2024-10-01T18:00:00Z
+    reason: Expired
+    approver: octocat
+`)
+	h := &RulesetHandler{Config: &Config{Exemptions: ExemptionsConfig{Path: path}}}
+
+	desired := newTestRuleset(t, `{"name": "Default Ruleset", "enforcement": "active", "rules": [{"type": "deletion"}]}`)
+	live := newTestRuleset(t, `{"id": 42, "name": "Default Ruleset", "enforcement": "disabled", "rules": []}`)
+	changes, err := diffRulesets(live, desired)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+
+	target, remaining, applied, err := h.applyExemptions("test-org", "Default Ruleset", live, desired, changes, logger)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, "Incident 123", applied[0].Reason)
+	assert.Equal(t, []string{"rules.deletion"}, []string{remaining[0].Path})
+	assert.Equal(t, "disabled", target.Enforcement)
+	assert.Len(t, target.Rules, 1)
+
+	target, remaining, applied, err = h.applyExemptions("other-org", "Default Ruleset", live, desired, changes, logger)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.Equal(t, changes, remaining)
+	assert.Same(t, desired, target)
+}
+
+func TestExpiredExemptions(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	expired := expiredExemptions([]Exemption{
+		{Org: "test-org", Expires: now.Add(-2 * time.Hour)},
+		{Org: "test-org", Expires: now.Add(-time.Hour)},
+		{Org: "test-org", Expires: now.Add(time.Hour)},
+		{Org: "other-org", Expires: now.Add(time.Hour)},
+		{Org: "Test-Org", Expires: now.Add(-30 * time.Minute)},
+	}, now)
+
+	assert.Equal(t, map[string]time.Time{"test-org": now.Add(-30 * time.Minute)}, expired)
+}
+
+func TestRestoreExpiredExemptions_AlreadySynced(t *testing.T) {
+	logger := zerolog.Nop()
+	path := writeTestExemptions(t, `
+exemptions:
+  - org: test-org
+    ruleset: Default Ruleset
+    allow: [disabled]
+    expires: 2024-10-01T18:00:00Z
+    reason: Incident 123
+    approver: octocat
+`)
+	store, err := OpenStateStore(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, store.RecordOrgSync("test-org", 1, "", nil))
+
+	h := &RulesetHandler{Config: &Config{Exemptions: ExemptionsConfig{Path: path}}, State: store}
+	restored := make(map[string]time.Time)
+	h.restoreExpiredExemptions(context.Background(), time.Now(), restored, logger)
+
+	// The organization was synced after the exemption expired, so there is nothing to restore.
+	assert.Equal(t, time.Date(2024, 10, 1, 18, 0, 0, 0, time.UTC), restored["test-org"])
+}
+
+func TestRestoreExpiredExemptions_OrgCase(t *testing.T) {
+	logger := zerolog.Nop()
+	path := writeTestExemptions(t, `
+exemptions:
+  - org: Test-Org
+    ruleset: Default Ruleset
+    allow: [disabled]
+    expires: 2024-10-01T18:00:00Z
+    reason: Incident 123
+    approver: octocat
+`)
+	store, err := OpenStateStore(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, store.RecordOrgSync("test-org", 1, "", nil))
+
+	h := &RulesetHandler{Config: &Config{Exemptions: ExemptionsConfig{Path: path}}, State: store}
+	restored := make(map[string]time.Time)
+	h.restoreExpiredExemptions(context.Background(), time.Now(), restored, logger)
+
+	// The exemption is matched to the organization in the state, whatever its spelling.
+	assert.Equal(t, map[string]time.Time{"test-org": time.Date(2024, 10, 1, 18, 0, 0, 0, time.UTC)}, restored)
+	assert.Len(t, store.Orgs(), 1)
+}
+
+func TestAddAndRevokeExemptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exemptions.yml")
+	h := &RulesetHandler{Config: &Config{Exemptions: ExemptionsConfig{Path: path}}}
+
+	exemption := Exemption{
+		Org:      "test-org",
+		Ruleset:  "Default Ruleset",
+		Allow:    []string{ExemptionAllowDisabled},
+		Expires:  time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+		Reason:   "Incident 123",
+		Approver: "octocat",
+	}
+	assert.Error(t, h.AddExemption(Exemption{Org: "test-org"}))
+	assert.NoError(t, h.AddExemption(exemption))
+
+	exemptions, err := h.Exemptions()
+	assert.NoError(t, err)
+	assert.Equal(t, []Exemption{exemption}, exemptions)
+
+	revoked, err := h.RevokeExemptions("test-org", "Other Ruleset")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, revoked)
+
+	revoked, err = h.RevokeExemptions("test-org", "Default Ruleset")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, revoked)
+
+	// The revoked exemption is kept as a record, but no longer active.
+	exemptions, err = h.Exemptions()
+	assert.NoError(t, err)
+	if assert.Len(t, exemptions, 1) {
+		assert.False(t, exemptions[0].activeAt(time.Now().Add(time.Second)))
+	}
+}
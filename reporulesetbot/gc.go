@@ -0,0 +1,96 @@
+package reporulesetbot
+
+import (
+	"context"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// removedRulesetReason is the reason recorded for rulesets that were removed from the configuration.
+const removedRulesetReason = "Ruleset was removed from the configuration"
+
+// GarbageCollectionConfig represents the configuration of how managed rulesets that were removed from the
+// configuration are cleaned up. Enabled is the safety switch: until it is set, removals are only planned.
+type GarbageCollectionConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Action  string `yaml:"action"`
+}
+
+// validate checks that the configuration only uses known values.
+func (c GarbageCollectionConfig) validate() error {
+	switch c.Action {
+	case "", AuditActionDelete, AuditActionDisable:
+		return nil
+	default:
+		return errors.Errorf("Unknown garbage collection action %s, expected %s or %s", c.Action, AuditActionDelete, AuditActionDisable)
+	}
+}
+
+// garbageCollection returns the garbage collection configuration with the defaults filled in.
+func (h *RulesetHandler) garbageCollection() GarbageCollectionConfig {
+	var config GarbageCollectionConfig
+	if h.Config != nil {
+		config = h.Config.GarbageCollection
+	}
+	if config.Action == "" {
+		config.Action = AuditActionDisable
+	}
+	return config
+}
+
+// planRemovals returns the removal of the managed rulesets in the organization that are no longer configured. An empty
+// configuration never removes anything, since it is more likely to be a mistake than a request to remove every ruleset.
+func (h *RulesetHandler) planRemovals(orgName string, rulesets []*DesiredRuleset, managed []ManagedRuleset, logger zerolog.Logger) []PlannedChange {
+	if len(rulesets) == 0 {
+		if len(managed) > 0 {
+			logger.Warn().Msgf("No rulesets are configured, not removing the %d managed rulesets in the organization %s.", len(managed), orgName)
+		}
+		return nil
+	}
+
+	action := h.garbageCollection().Action
+
+	var removals []PlannedChange
+	for _, tracked := range managed {
+		if desiredRulesetFor(tracked, rulesets) == nil {
+			removals = append(removals, PlannedChange{Action: action, Ruleset: tracked.Name, RulesetID: tracked.ID, Reason: removedRulesetReason})
+		}
+	}
+	return removals
+}
+
+// removeRuleset deletes or disables a managed ruleset that was removed from the configuration, removes it from the
+// state store and stops tracking it.
+// When garbage collection isn't enabled the removal is only logged and recorded as skipped.
+func (h *RulesetHandler) removeRuleset(ctx context.Context, client *github.Client, orgName string, change PlannedChange, logger zerolog.Logger) error {
+	if !h.garbageCollection().Enabled {
+		logger.Warn().Msgf("Ruleset %s with ID %d in the organization %s was removed from the configuration, but garbage collection is disabled.", change.Ruleset, change.RulesetID, orgName)
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: change.Ruleset, RulesetID: change.RulesetID, Action: AuditActionSkip, Reason: removedRulesetReason + ", but garbage collection is disabled"}, logger)
+		return nil
+	}
+
+	var err error
+	switch change.Action {
+	case AuditActionDelete:
+		err = deleteRuleset(ctx, client, orgName, change.RulesetID, logger)
+	case AuditActionDisable:
+		err = disableRuleset(ctx, client, orgName, change.RulesetID, logger)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to %s ruleset %s in organization %s", change.Action, change.Ruleset, orgName)
+	}
+
+	h.audit(ctx, AuditEntry{Org: orgName, Ruleset: change.Ruleset, RulesetID: change.RulesetID, Action: change.Action, Reason: change.Reason}, logger)
+
+	if h.State != nil {
+		if err := h.State.ForgetRuleset(orgName, change.RulesetID); err != nil {
+			return errors.Wrapf(err, "Failed to forget ruleset %s in organization %s", change.Ruleset, orgName)
+		}
+	}
+	if err := h.tracker().UntrackRuleset(orgName, change.RulesetID); err != nil {
+		return errors.Wrapf(err, "Failed to untrack ruleset %s in organization %s", change.Ruleset, orgName)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package reporulesetbot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanRemovals(t *testing.T) {
+	logger := zerolog.Nop()
+	rulesets := []*DesiredRuleset{{Ruleset: &github.Ruleset{Name: "Default Ruleset"}, File: "Default Ruleset.json"}}
+	managed := []ManagedRuleset{
+		{ID: 1, Name: "Default Ruleset", File: "Default Ruleset.json"},
+		{ID: 2, Name: "Old Ruleset", File: "Old Ruleset.json"},
+	}
+
+	h := &RulesetHandler{}
+	assert.Equal(t, []PlannedChange{
+		{Action: AuditActionDisable, Ruleset: "Old Ruleset", RulesetID: 2, Reason: removedRulesetReason},
+	}, h.planRemovals("test-org", rulesets, managed, logger))
+
+	h.Config = &Config{GarbageCollection: GarbageCollectionConfig{Action: AuditActionDelete}}
+	assert.Equal(t, AuditActionDelete, h.planRemovals("test-org", rulesets, managed, logger)[0].Action)
+
+	// An empty configuration never removes rulesets.
+	assert.Empty(t, h.planRemovals("test-org", nil, managed, logger))
+}
+
+func TestRemoveRuleset(t *testing.T) {
+	logger := zerolog.Nop()
+	change := PlannedChange{Action: AuditActionDelete, Ruleset: "Old Ruleset", RulesetID: 2, Reason: removedRulesetReason}
+
+	var deleted bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, "/orgs/test-org/rulesets/2", r.URL.Path)
+		deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	client.BaseURL = baseURL
+
+	tracker := NewMemoryRulesetTracker()
+	assert.NoError(t, tracker.TrackRuleset("test-org", ManagedRuleset{ID: 2, Name: "Old Ruleset", File: "Old Ruleset.json"}))
+
+	t.Run("safety switch off", func(t *testing.T) {
+		sink := &memoryAuditSink{}
+		h := &RulesetHandler{Config: &Config{GarbageCollection: GarbageCollectionConfig{Action: AuditActionDelete}}, Tracker: tracker, Audit: sink}
+
+		assert.NoError(t, h.removeRuleset(context.Background(), client, "test-org", change, logger))
+		assert.False(t, deleted)
+		assert.Equal(t, AuditActionSkip, sink.entries[0].Action)
+
+		managed, err := tracker.ManagedRulesets("test-org")
+		assert.NoError(t, err)
+		assert.Len(t, managed, 1)
+	})
+
+	t.Run("safety switch on", func(t *testing.T) {
+		sink := &memoryAuditSink{}
+		h := &RulesetHandler{Config: &Config{GarbageCollection: GarbageCollectionConfig{Enabled: true, Action: AuditActionDelete}}, Tracker: tracker, Audit: sink}
+
+		assert.NoError(t, h.removeRuleset(context.Background(), client, "test-org", change, logger))
+		assert.True(t, deleted)
+		assert.Equal(t, AuditActionDelete, sink.entries[0].Action)
+		assert.Equal(t, removedRulesetReason, sink.entries[0].Reason)
+
+		managed, err := tracker.ManagedRulesets("test-org")
+		assert.NoError(t, err)
+		assert.Empty(t, managed)
+	})
+}
+
+func TestGarbageCollectionConfig_Validate(t *testing.T) {
+	assert.NoError(t, GarbageCollectionConfig{}.validate())
+	assert.NoError(t, GarbageCollectionConfig{Action: AuditActionDelete}.validate())
+	assert.Error(t, GarbageCollectionConfig{Action: AuditActionUpdate}.validate())
+}
@@ -3,28 +3,62 @@ package reporulesetbot
 import (
 	"context"
 	"encoding/json"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/v65/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // RulesetHandler handles ruleset events.
 type RulesetHandler struct {
 	githubapp.ClientCreator
 	zerolog.Logger
+	Config   *Config
+	Tracker  RulesetTracker
+	State    *StateStore
+	Audit    AuditSink
+	Notifier Notifier
+	Metrics  metrics.Registry
+
+	// TracerProvider records the spans of the handler. The global provider is used when it is nil.
+	TracerProvider trace.TracerProvider
+
+	trackerOnce   sync.Once
+	rolloutMu     sync.Mutex
+	lastRollout   *RolloutReport
+	activeRollout *activeRollout
+	bundlesMu     sync.Mutex
+	bundles       map[string]*rulesetBundle
+	exemptionsMu  sync.Mutex
+	readyMu       sync.Mutex
+	appCheckedAt  time.Time
+	appCheckErr   error
+	deliveriesMu  sync.Mutex
+	deliveries    *deliveryCache
 }
 
 // Constants for action and event types
 const (
-	ActionCreated              = "created"
-	ActionEdited               = "edited"
-	ActionDeleted              = "deleted"
-	ActionReleased             = "released"
-	EventTypeRepositoryRuleset = "repository_ruleset"
-	EventTypeInstallation      = "installation"
-	EventTypeRelease           = "release"
+	ActionCreated               = "created"
+	ActionEdited                = "edited"
+	ActionDeleted               = "deleted"
+	ActionReleased              = "released"
+	ActionPrereleased           = "prereleased"
+	ActionUnpublished           = "unpublished"
+	ActionSuspend               = "suspend"
+	ActionUnsuspend             = "unsuspend"
+	ActionNewPermissions        = "new_permissions_accepted"
+	ActionRenamed               = "renamed"
+	EventTypeRepositoryRuleset  = "repository_ruleset"
+	EventTypeInstallation       = "installation"
+	EventTypeInstallationTarget = "installation_target"
+	EventTypeRelease            = "release"
 )
 
 // RulesetEvent represents a GitHub ruleset event.
@@ -41,19 +75,48 @@ type RulesetEvent struct {
 
 // Handles returns the list of event types handled by the RulesetHandler.
 func (h *RulesetHandler) Handles() []string {
-	return []string{"repository_ruleset", "installation", "release"}
+	return []string{"repository_ruleset", "installation", "installation_target", "release"}
 }
 
 // Handle processes the event payload based on the event type.
 func (h *RulesetHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	start := time.Now()
 
-	logger := h.Logger
+	action := eventAction(payload)
+	ctx, span := h.startSpan(ctx, "webhook "+eventType,
+		AttributeDeliveryID.String(deliveryID),
+		AttributeEventType.String(eventType),
+		AttributeEventAction.String(action),
+	)
 
+	logger := eventLogger(ctx, h.Logger, deliveryID, eventType, action)
+
+	if record, ok := h.startDelivery(deliveryID); !ok {
+		h.suppressDelivery(deliveryID, eventType, record, logger)
+		span.SetAttributes(AttributeDuplicate.Bool(true))
+		span.End()
+		return nil
+	}
+
+	ctx = withEventInfo(ctx, eventInfo{DeliveryID: deliveryID, EventType: eventType})
+	ctx = withAppliedContent(ctx)
+
+	err := h.handleEvent(ctx, eventType, payload, logger)
+	h.finishDelivery(ctx, deliveryID, eventType, action, err)
+	endSpan(span, err)
+	h.recordEvent(eventType, action, time.Since(start), err)
+	return err
+}
+
+// handleEvent dispatches the event payload to the handler of its event type.
+func (h *RulesetHandler) handleEvent(ctx context.Context, eventType string, payload []byte, logger zerolog.Logger) error {
 	switch eventType {
 	case EventTypeRepositoryRuleset:
 		return h.handleRepositoryRulesetEvent(ctx, payload, logger)
 	case EventTypeInstallation:
 		return h.handleInstallationEvent(ctx, payload, logger)
+	case EventTypeInstallationTarget:
+		return h.handleInstallationTargetEvent(ctx, payload, logger)
 	case EventTypeRelease:
 		return h.handleReleaseEvent(ctx, payload, logger)
 	default:
@@ -70,7 +133,13 @@ func (h *RulesetHandler) handleRepositoryRulesetEvent(ctx context.Context, paylo
 		return errors.Wrap(err, "Failed to parse repository ruleset event payload")
 	}
 
+	logger = orgLogger(logger, event.Organization.GetLogin(), event.Installation.GetID())
+	if event.Ruleset != nil {
+		logger = rulesetLogger(logger, event.Ruleset.Name)
+	}
+
 	logger.Info().Msgf("Repository ruleset event received for the organization %s: %s.", event.Organization.GetLogin(), event.Action)
+	ctx = withEventSender(ctx, event.Sender.GetLogin())
 	return h.handleRepositoryRuleset(ctx, event, logger)
 }
 
@@ -82,10 +151,28 @@ func (h *RulesetHandler) handleInstallationEvent(ctx context.Context, payload []
 		return errors.Wrap(err, "Failed to parse installation event payload")
 	}
 
+	logger = orgLogger(logger, event.GetInstallation().GetAccount().GetLogin(), event.GetInstallation().GetID())
+
 	logger.Info().Msgf("Installation event received for the organization %s: %s.", event.Installation.Account.GetLogin(), event.GetAction())
+	ctx = withEventSender(ctx, event.GetSender().GetLogin())
 	return h.handleInstallation(ctx, event, logger)
 }
 
+// handleInstallationTargetEvent handles installation target events.
+func (h *RulesetHandler) handleInstallationTargetEvent(ctx context.Context, payload []byte, logger zerolog.Logger) error {
+	var event *github.InstallationTargetEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		logger.Error().Err(err).Msg("Failed to parse installation target event payload.")
+		return errors.Wrap(err, "Failed to parse installation target event payload")
+	}
+
+	logger = orgLogger(logger, event.GetAccount().GetLogin(), event.GetInstallation().GetID())
+
+	logger.Info().Msgf("Installation target event received for the organization %s: %s.", event.GetAccount().GetLogin(), event.GetAction())
+	ctx = withEventSender(ctx, event.GetSender().GetLogin())
+	return h.handleInstallationTarget(ctx, event, logger)
+}
+
 // handleReleaseEvent handles release events.
 func (h *RulesetHandler) handleReleaseEvent(ctx context.Context, payload []byte, logger zerolog.Logger) error {
 	var event *github.ReleaseEvent
@@ -94,15 +181,28 @@ func (h *RulesetHandler) handleReleaseEvent(ctx context.Context, payload []byte,
 		return errors.Wrap(err, "Failed to parse release event payload")
 	}
 
+	logger = logger.With().Str(LogFieldRelease, event.GetRelease().GetTagName()).Logger()
+
 	logger.Info().Msgf("Release event received for the repository %s: %s.", event.GetRepo().GetFullName(), event.GetAction())
+	ctx = withEventSender(ctx, event.GetSender().GetLogin())
 	return h.handleRelease(ctx, event, logger)
 }
 
 // handleRepositoryRuleset processes organization ruleset events.
-func (h *RulesetHandler) handleRepositoryRuleset(ctx context.Context, event *RulesetEvent, logger zerolog.Logger) error {
+func (h *RulesetHandler) handleRepositoryRuleset(ctx context.Context, event *RulesetEvent, logger zerolog.Logger) (err error) {
+	attributes := []attribute.KeyValue{
+		AttributeOrg.String(event.Organization.GetLogin()),
+		AttributeInstallationID.Int64(event.Installation.GetID()),
+	}
+	if event.Ruleset != nil {
+		attributes = append(attributes, AttributeRuleset.String(event.Ruleset.Name))
+	}
+	ctx, span := h.startSpan(ctx, "handle ruleset "+event.Action, attributes...)
+	defer func() { endSpan(span, err) }()
+
 	switch event.Action {
 	case ActionCreated:
-		return h.handleRulesetCreated(event, logger)
+		return h.handleRulesetCreated(ctx, event, logger)
 	case ActionEdited:
 		return h.handleRulesetEdited(ctx, event, logger)
 	case ActionDeleted:
@@ -114,9 +214,58 @@ func (h *RulesetHandler) handleRepositoryRuleset(ctx context.Context, event *Rul
 }
 
 // handleRulesetCreated handles the "created" action for repository ruleset events.
-func (h *RulesetHandler) handleRulesetCreated(event *RulesetEvent, logger zerolog.Logger) error {
-	logger.Info().Msgf("Ruleset %s has been created in the organization %s by %s.", event.Ruleset.Name, event.Organization.GetLogin(), event.Sender.GetLogin())
-	return nil
+func (h *RulesetHandler) handleRulesetCreated(ctx context.Context, event *RulesetEvent, logger zerolog.Logger) error {
+	orgName := event.Organization.GetLogin()
+	eventSender := event.Sender.GetLogin()
+	rulesetID := event.Ruleset.GetID()
+	eventRulesetName := event.Ruleset.Name
+
+	logger.Info().Msgf("Ruleset %s has been created in the organization %s by %s.", eventRulesetName, orgName, eventSender)
+
+	// Only organization rulesets can conflict with the managed rulesets.
+	if event.Ruleset.GetSourceType() != "Organization" {
+		return nil
+	}
+
+	jwtclient, err := newJWTClient()
+	if err != nil {
+		return errors.Wrap(err, "Failed to create JWT client")
+	}
+
+	app, err := getAuthenticatedApp(ctx, jwtclient)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get authenticated app")
+	}
+
+	if eventSender == app.GetSlug()+"[bot]" {
+		return nil
+	}
+
+	client, err := h.ClientCreator.NewInstallationClient(event.Installation.GetID())
+	if err != nil {
+		return errors.Wrap(err, "Failed to create installation client")
+	}
+
+	managed, err := h.tracker().ManagedRulesets(orgName)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get managed rulesets for organization %s", orgName)
+	}
+
+	if isTrackedRulesetID(managed, rulesetID) {
+		return nil
+	}
+
+	rulesets, err := h.getRulesets(ctx, client, orgName, h.orgRelease(orgName), logger)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read rulesets from file")
+	}
+
+	conflict := findConflict(event.Ruleset, rulesets)
+	if conflict == nil {
+		return nil
+	}
+
+	return h.resolveConflict(ctx, client, orgName, event.Ruleset, conflict, managed, logger)
 }
 
 // handleRulesetEditedhandles the "edited" action for repository ruleset events.
@@ -149,109 +298,206 @@ func (h *RulesetHandler) handleRulesetEdited(ctx context.Context, event *Ruleset
 		return nil
 	}
 
+	if h.isOrgSuspended(orgName) {
+		logger.Info().Msgf("Enforcement in the organization %s is paused while the installation is suspended.", orgName)
+		return nil
+	}
+
 	logger.Info().Msgf("Ruleset %s in the organization %s was edited by the user %s.", eventRulesetName, orgName, eventSender)
 
-	rulesets, err := h.getRulesets(ctx, client, orgName, logger)
+	rulesets, err := h.getRulesets(ctx, client, orgName, h.orgRelease(orgName), logger)
 	if err != nil {
 		return errors.Wrap(err, "Failed to read rulesets from file")
 	}
 
-	for _, ruleset := range rulesets {
+	ruleset, err := h.findManagedRuleset(orgName, rulesetID, rulesets, func(r *github.Ruleset) bool {
+		return isManagedRuleset(event, r, logger)
+	}, logger)
+	if err != nil {
+		return err
+	}
 
-		if !isManagedRuleset(event, ruleset, logger) {
-			continue
-		}
+	if ruleset == nil {
+		logger.Info().Msgf("Ruleset %s in the organization %s is not managed by this App.", eventRulesetName, orgName)
+		return nil
+	}
 
-		if len(ruleset.BypassActors) == 0 {
-			logger.Info().Msgf("Ruleset %s in the organization %s does not have any bypass actors.", ruleset.Name, orgName)
-			if err := removeBypassActors(client, orgName, rulesetID); err != nil {
-				return errors.Wrapf(err, "Failed to remove bypass actors from ruleset %s in organization %s", eventRulesetName, orgName)
-			}
-		}
+	policy := h.rulesetPolicy(ruleset.Name)
+	if policy.Mode == ModeIgnore {
+		logger.Info().Msgf("Ruleset %s in the organization %s is in %s mode, leaving the edit in place.", ruleset.Name, orgName, policy.Mode)
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: ruleset.Name, RulesetID: rulesetID, Action: AuditActionSkip, Reason: "Ruleset is in ignore mode"}, logger)
+		return nil
+	}
+
+	target, changes, err := reconcileRuleset(policy, event.Ruleset, ruleset)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to compare ruleset %s in organization %s", eventRulesetName, orgName)
+	}
+
+	target, changes, exemptions, err := h.applyExemptions(orgName, ruleset.Name, event.Ruleset, target, changes, logger)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to apply the exemptions for ruleset %s in organization %s", eventRulesetName, orgName)
+	}
+
+	if len(changes) == 0 && len(exemptions) > 0 {
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: ruleset.Name, RulesetID: rulesetID, Action: AuditActionSkip, Reason: describeExemptions(exemptions)}, logger)
+		return nil
+	}
 
-		if err := editRuleset(ctx, client, orgName, rulesetID, ruleset, logger); err != nil {
-			return errors.Wrapf(err, "Failed to edit ruleset %s in organization %s", eventRulesetName, orgName)
+	if len(changes) == 0 {
+		logger.Info().Msgf("Ruleset %s in the organization %s already matches the configuration.", eventRulesetName, orgName)
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: ruleset.Name, RulesetID: rulesetID, Action: AuditActionSkip, Reason: "Ruleset already matches the configuration"}, logger)
+		return nil
+	}
+
+	if policy.Mode == ModeAlert {
+		logger.Info().Msgf("Ruleset %s in the organization %s is in %s mode, reporting the edit without reverting it.", ruleset.Name, orgName, policy.Mode)
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: ruleset.Name, RulesetID: rulesetID, Action: AuditActionAlert, Reason: "Ruleset is in alert mode", Diff: changes}, logger)
+		h.notify(ctx, Notification{Kind: NotificationAlert, Org: orgName, Ruleset: ruleset.Name, Changes: invertChanges(changes)}, logger)
+		return nil
+	}
+
+	if len(target.BypassActors) == 0 {
+		logger.Info().Msgf("Ruleset %s in the organization %s does not have any bypass actors.", ruleset.Name, orgName)
+		if err := removeBypassActors(ctx, client, orgName, rulesetID); err != nil {
+			h.notifyFailure(ctx, orgName, ruleset.Name, err, logger)
+			return errors.Wrapf(err, "Failed to remove bypass actors from ruleset %s in organization %s", eventRulesetName, orgName)
 		}
 	}
+
+	err = editRuleset(ctx, client, orgName, rulesetID, target, logger)
+	h.recordRulesetSync(ctx, orgName, ruleset, h.orgRelease(orgName), err, logger)
+	if err != nil {
+		h.notifyFailure(ctx, orgName, ruleset.Name, err, logger)
+		return errors.Wrapf(err, "Failed to edit ruleset %s in organization %s", eventRulesetName, orgName)
+	}
+
+	h.audit(ctx, AuditEntry{Org: orgName, Ruleset: ruleset.Name, RulesetID: rulesetID, Action: AuditActionRevert, Diff: changes}, logger)
+	h.notify(ctx, Notification{Kind: NotificationRevert, Org: orgName, Ruleset: ruleset.Name, Changes: invertChanges(changes)}, logger)
 	return nil
 }
 
 // handleRulesetDeleted handles the "deleted" action for repository ruleset events.
 func (h *RulesetHandler) handleRulesetDeleted(ctx context.Context, event *RulesetEvent, logger zerolog.Logger) error {
 	eventRulesetName := event.Ruleset.Name
+	rulesetID := event.Ruleset.GetID()
 	orgName := event.Organization.GetLogin()
 	logger.Info().Msgf("Ruleset %s has been deleted in the organization %s by %s.", eventRulesetName, orgName, event.Sender.GetLogin())
 
+	if h.isOrgSuspended(orgName) {
+		logger.Info().Msgf("Enforcement in the organization %s is paused while the installation is suspended.", orgName)
+		return nil
+	}
+
 	client, err := h.ClientCreator.NewInstallationClient(event.Installation.GetID())
 	if err != nil {
 		return errors.Wrap(err, "Failed to create installation client")
 	}
 
-	rulesets, err := h.getRulesets(ctx, client, orgName, logger)
+	rulesets, err := h.getRulesets(ctx, client, orgName, h.orgRelease(orgName), logger)
 	if err != nil {
 		return errors.Wrap(err, "Failed to read rulesets from file")
 	}
 
-	for _, ruleset := range rulesets {
-		if ruleset.Name == eventRulesetName {
-
-			rulesetName := ruleset.Name
+	ruleset, err := h.findManagedRuleset(orgName, rulesetID, rulesets, func(r *github.Ruleset) bool {
+		return r.Name == eventRulesetName
+	}, logger)
+	if err != nil {
+		return err
+	}
 
-			logger.Info().Msgf("Recreating ruleset %s in organization %s.", rulesetName, orgName)
+	if ruleset == nil {
+		logger.Info().Msgf("Ruleset %s in the organization %s is not managed by this App.", eventRulesetName, orgName)
+		return nil
+	}
 
-			if err := createRuleset(ctx, client, orgName, ruleset, logger); err != nil {
-				return errors.Wrapf(err, "Failed to create ruleset %s in organization %s", rulesetName, orgName)
-			}
-			break
-		}
+	if err := h.tracker().UntrackRuleset(orgName, rulesetID); err != nil {
+		return errors.Wrapf(err, "Failed to untrack ruleset %s in organization %s", eventRulesetName, orgName)
 	}
 
-	return nil
-}
+	rulesetName := ruleset.Name
 
-// handleInstallation processes installation events.
-func (h *RulesetHandler) handleInstallation(ctx context.Context, event *github.InstallationEvent, logger zerolog.Logger) error {
-	installationID := event.GetInstallation().GetID()
-	orgName := event.Installation.Account.GetLogin()
-	action := event.GetAction()
-	appName := event.GetInstallation().GetAppSlug()
+	switch mode := h.rulesetPolicy(rulesetName).Mode; mode {
+	case ModeIgnore:
+		logger.Info().Msgf("Ruleset %s in the organization %s is in %s mode, not recreating it.", rulesetName, orgName, mode)
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: rulesetName, RulesetID: rulesetID, Action: AuditActionSkip, Reason: "Ruleset is in ignore mode"}, logger)
+		return nil
+	case ModeAlert:
+		logger.Info().Msgf("Ruleset %s in the organization %s is in %s mode, reporting the deletion without recreating it.", rulesetName, orgName, mode)
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: rulesetName, RulesetID: rulesetID, Action: AuditActionAlert, Reason: "Ruleset is in alert mode"}, logger)
+		h.notify(ctx, Notification{Kind: NotificationAlert, Org: orgName, Ruleset: rulesetName, Summary: "The ruleset was deleted."}, logger)
+		return nil
+	}
 
-	logger.Info().Msgf("Application %s was installed in the organization %s.", appName, orgName)
+	logger.Info().Msgf("Recreating ruleset %s in organization %s.", rulesetName, orgName)
 
-	if action != ActionCreated {
-		return nil
+	recreated, err := ruleset.withLocalModifications(event.Ruleset)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to merge the local modifications of ruleset %s in organization %s", rulesetName, orgName)
 	}
 
-	client, err := h.ClientCreator.NewInstallationClient(installationID)
+	changes, err := diffRulesets(event.Ruleset, recreated)
 	if err != nil {
-		return errors.Wrap(err, "Failed to create installation client")
+		return errors.Wrapf(err, "Failed to compare ruleset %s in organization %s", rulesetName, orgName)
 	}
 
-	rulesets, err := h.getRulesets(ctx, client, orgName, logger)
+	created, err := createRuleset(ctx, client, orgName, recreated, logger)
+	h.recordRulesetSync(ctx, orgName, ruleset, h.orgRelease(orgName), err, logger)
 	if err != nil {
-		return errors.Wrap(err, "Failed to read rulesets from file")
+		h.notifyFailure(ctx, orgName, rulesetName, err, logger)
+		return errors.Wrapf(err, "Failed to create ruleset %s in organization %s", rulesetName, orgName)
 	}
 
-	logger.Info().Msgf("Found %d rulesets configured.", len(rulesets))
+	h.audit(ctx, AuditEntry{Org: orgName, Ruleset: rulesetName, RulesetID: created.GetID(), Action: AuditActionRecreate, Diff: changes}, logger)
+	h.notify(ctx, Notification{Kind: NotificationRecreate, Org: orgName, Ruleset: rulesetName, Summary: "The ruleset was deleted."}, logger)
+	return h.trackRuleset(orgName, created.GetID(), ruleset)
+}
+
+// handleInstallation processes installation events.
+func (h *RulesetHandler) handleInstallation(ctx context.Context, event *github.InstallationEvent, logger zerolog.Logger) (err error) {
+	installationID := event.GetInstallation().GetID()
+	orgName := event.Installation.Account.GetLogin()
+	action := event.GetAction()
+	appName := event.GetInstallation().GetAppSlug()
 
-	for _, ruleset := range rulesets {
-		logger.Info().Msgf("Creating ruleset %s in organization %s.", ruleset.Name, orgName)
-		if err := createRuleset(ctx, client, orgName, ruleset, logger); err != nil {
-			return err
-		}
-	}
+	ctx, span := h.startSpan(ctx, "handle installation "+action, AttributeOrg.String(orgName), AttributeInstallationID.Int64(installationID))
+	defer func() { endSpan(span, err) }()
 
-	return nil
+	switch action {
+	case ActionCreated:
+		logger.Info().Msgf("Application %s was installed in the organization %s.", appName, orgName)
+		return h.syncOrganization(ctx, installationID, orgName, h.currentRelease(), logger)
+	case ActionDeleted:
+		logger.Info().Msgf("Application %s was uninstalled from the organization %s.", appName, orgName)
+		return h.handleInstallationDeleted(ctx, orgName, logger)
+	case ActionSuspend:
+		logger.Info().Msgf("Application %s was suspended in the organization %s.", appName, orgName)
+		return h.handleInstallationSuspended(ctx, installationID, orgName, true, logger)
+	case ActionUnsuspend:
+		logger.Info().Msgf("Application %s was unsuspended in the organization %s.", appName, orgName)
+		return h.handleInstallationSuspended(ctx, installationID, orgName, false, logger)
+	case ActionNewPermissions:
+		logger.Info().Msgf("New permissions for application %s were accepted in the organization %s.", appName, orgName)
+		return h.handleNewPermissionsAccepted(ctx, installationID, orgName, logger)
+	default:
+		logger.Info().Msgf("Unhandled installation action for the organization %s: %s.", orgName, action)
+		return nil
+	}
 }
 
-// handleRelease processes release events.
-func (h *RulesetHandler) handleRelease(ctx context.Context, event *github.ReleaseEvent, logger zerolog.Logger) error {
+// handleRelease processes release events of the repository of the app.
+func (h *RulesetHandler) handleRelease(ctx context.Context, event *github.ReleaseEvent, logger zerolog.Logger) (err error) {
 	repoName := event.GetRepo().GetFullName()
 	action := event.GetAction()
-	tagName := event.GetRelease().GetTagName()
-	actionType := event.GetAction()
+	release := event.GetRelease()
+	tagName := release.GetTagName()
 
-	if actionType != ActionReleased {
+	ctx, span := h.startSpan(ctx, "handle release "+action, AttributeRelease.String(tagName))
+	defer func() { endSpan(span, err) }()
+
+	switch action {
+	case ActionReleased, ActionPrereleased, ActionEdited, ActionDeleted, ActionUnpublished:
+	default:
 		return nil
 	}
 
@@ -277,51 +523,28 @@ func (h *RulesetHandler) handleRelease(ctx context.Context, event *github.Releas
 	}
 
 	logger.Info().Msgf("Release %s was %s for the repository %s.", tagName, action, repoName)
-	logger.Info().Msgf("Updating the rulesets...")
 
-	installations, err := getOrgInstallations(ctx, jwtclient)
+	installations, err := getInstallationsForAuthenticatedApp(ctx, jwtclient)
 	if err != nil {
 		return errors.Wrap(err, "Failed to get installations for authenticated app")
 	}
 
-	for orgName, installation := range installations {
-		client, err := h.ClientCreator.NewInstallationClient(installation)
-		if err != nil {
-			return errors.Wrap(err, "Failed to create installation client")
-		}
+	client, err := h.ClientCreator.NewInstallationClient(event.GetInstallation().GetID())
+	if err != nil {
+		return errors.Wrap(err, "Failed to create installation client")
+	}
 
-		rulesets, err := h.getRulesets(ctx, client, orgName, logger)
-		if err != nil {
-			return errors.Wrap(err, "Failed to read rulesets from file")
-		}
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
 
-		for _, ruleset := range rulesets {
-			rulesetName := ruleset.Name
-
-			orgRulesets, err := getOrgRulesets(ctx, client, orgName)
-			if err != nil {
-				return errors.Wrap(err, "Failed to get ruleset ID")
-			}
-
-			found := false
-			for _, orgRuleset := range orgRulesets {
-				if orgRuleset.Name == rulesetName {
-					found = true
-					rulesetID := orgRuleset.GetID()
-					if err := editRuleset(ctx, client, orgName, rulesetID, ruleset, logger); err != nil {
-						return err
-					}
-					break
-				}
-			}
-
-			if !found {
-				if err := createRuleset(ctx, client, orgName, ruleset, logger); err != nil {
-					return err
-				}
-			}
-		}
+	switch action {
+	case ActionReleased:
+		return h.publishRelease(ctx, client, owner, repo, release, installations, logger)
+	case ActionPrereleased:
+		return h.publishPrerelease(ctx, client, owner, repo, release, installations, logger)
+	case ActionEdited:
+		return h.handleReleaseEdited(ctx, client, owner, repo, release, installations, logger)
+	default:
+		return h.withdrawRelease(ctx, client, owner, repo, tagName, installations, logger)
 	}
-
-	return nil
 }
@@ -23,7 +23,7 @@ func (m *MockClient) NewInstallationClient(installationID int64) (*github.Client
 
 func TestHandles(t *testing.T) {
 	handler := &RulesetHandler{}
-	expected := []string{"repository_ruleset", "installation", "release"}
+	expected := []string{"repository_ruleset", "installation", "installation_target", "release"}
 	assert.Equal(t, expected, handler.Handles())
 }
 
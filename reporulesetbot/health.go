@@ -0,0 +1,208 @@
+package reporulesetbot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Routes of the health and readiness probes.
+const (
+	HealthRoute = "/healthz"
+	ReadyRoute  = "/readyz"
+)
+
+// Names of the readiness checks.
+const (
+	ReadyCheckConfig    = "config"
+	ReadyCheckRulesets  = "rulesets"
+	ReadyCheckGitHubApp = "github_app"
+	ReadyCheckQueue     = "queue"
+)
+
+// defaultQueueWorkers is the number of workers handling queued events when not configured.
+const defaultQueueWorkers = 4
+
+// queueSaturation is the share of the event queue that can be used before the app reports it is not ready.
+const queueSaturation = 0.9
+
+// appCheckInterval is how long the result of authenticating as the app is reused by the readiness check, so probes
+// don't use up the rate limit of the app.
+const appCheckInterval = time.Minute
+
+// QueueConfig represents the configuration of the queue of webhook events. Without a size, events are handled
+// before the webhook is acknowledged.
+type QueueConfig struct {
+	Size    int `yaml:"size"`
+	Workers int `yaml:"workers"`
+}
+
+// Scheduler returns the scheduler of the webhook events: a queue with a pool of workers when a size is configured,
+// or the synchronous default scheduler. The queue reports its length and dropped events in the registry.
+func (c QueueConfig) Scheduler(registry metrics.Registry) githubapp.Scheduler {
+	if c.Size <= 0 {
+		return githubapp.DefaultScheduler()
+	}
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = defaultQueueWorkers
+	}
+	return githubapp.QueueAsyncScheduler(c.Size, workers,
+		githubapp.WithSchedulingMetrics(registry),
+		githubapp.WithAsyncErrorCallback(githubapp.MetricsAsyncErrorCallback(registry)),
+	)
+}
+
+// ReadinessCheck represents the outcome of one of the readiness checks.
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadinessReport represents the outcome of every readiness check.
+type ReadinessReport struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// authenticateApp authenticates as the app with its JSON Web Token.
+var authenticateApp = func(ctx context.Context) error {
+	jwtclient, err := newJWTClient()
+	if err != nil {
+		return errors.Wrap(err, "Failed to create JWT client")
+	}
+	_, err = getAuthenticatedApp(ctx, jwtclient)
+	return err
+}
+
+// NewHealthHandler returns the handler of the liveness probe, which succeeds as long as the process serves requests.
+func NewHealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// NewReadinessHandler returns the handler of the readiness probe. It responds with 503 and the failed checks when the
+// app is not ready to handle events.
+func NewReadinessHandler(h *RulesetHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Readiness(r.Context())
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+// Readiness checks that the configuration and the ruleset files of the current release are valid, that the app can
+// authenticate with GitHub, and that the event queue is not saturated.
+func (h *RulesetHandler) Readiness(ctx context.Context) ReadinessReport {
+	report := ReadinessReport{Ready: true}
+	for _, check := range []ReadinessCheck{
+		h.checkConfig(),
+		h.checkRulesets(ctx),
+		h.checkGitHubApp(ctx),
+		h.checkQueue(),
+	} {
+		report.Ready = report.Ready && check.OK
+		report.Checks = append(report.Checks, check)
+	}
+	return report
+}
+
+// checkConfig checks that the configuration was loaded and is valid.
+func (h *RulesetHandler) checkConfig() ReadinessCheck {
+	check := ReadinessCheck{Name: ReadyCheckConfig}
+	if h.Config == nil {
+		check.Error = "The configuration is not loaded"
+		return check
+	}
+	if err := validateConfig(h.Config); err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+// checkRulesets checks that the ruleset files of the current release can be read and parsed.
+func (h *RulesetHandler) checkRulesets(ctx context.Context) ReadinessCheck {
+	check := ReadinessCheck{Name: ReadyCheckRulesets}
+
+	releaseTag := h.currentRelease()
+	bundle, err := h.rulesetBundle(ctx, releaseTag, h.Logger)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	if len(bundle.Files) == 0 {
+		check.Error = "There are no ruleset files"
+		return check
+	}
+
+	for _, file := range bundle.names() {
+		if _, _, err := parseRulesetFile(file, bundle.Files[file]); err != nil {
+			check.Error = errors.Wrapf(err, "Invalid ruleset file %s", file).Error()
+			return check
+		}
+	}
+
+	check.OK = true
+	check.Detail = fmt.Sprintf("%d ruleset file(s)", len(bundle.Files))
+	if releaseTag != "" {
+		check.Detail += " in release " + releaseTag
+	}
+	return check
+}
+
+// checkGitHubApp checks that the app can authenticate with GitHub. The outcome is reused for a minute.
+func (h *RulesetHandler) checkGitHubApp(ctx context.Context) ReadinessCheck {
+	h.readyMu.Lock()
+	defer h.readyMu.Unlock()
+
+	if h.appCheckedAt.IsZero() || time.Since(h.appCheckedAt) >= appCheckInterval {
+		h.appCheckErr = authenticateApp(ctx)
+		h.appCheckedAt = time.Now()
+	}
+
+	check := ReadinessCheck{Name: ReadyCheckGitHubApp, OK: h.appCheckErr == nil}
+	if h.appCheckErr != nil {
+		check.Error = h.appCheckErr.Error()
+	}
+	return check
+}
+
+// checkQueue checks that the event queue has room for more events.
+func (h *RulesetHandler) checkQueue() ReadinessCheck {
+	check := ReadinessCheck{Name: ReadyCheckQueue, OK: true}
+
+	var size int
+	if h.Config != nil {
+		size = h.Config.Queue.Size
+	}
+	if size <= 0 {
+		check.Detail = "Events are handled synchronously"
+		return check
+	}
+
+	var queued int64
+	if gauge, ok := h.metrics().Get(githubapp.MetricsKeyQueueLength).(metrics.Gauge); ok {
+		queued = gauge.Value()
+	}
+
+	check.Detail = fmt.Sprintf("%d of %d queued", queued, size)
+	if float64(queued) >= queueSaturation*float64(size) {
+		check.OK = false
+		check.Error = "The event queue is saturated"
+	}
+	return check
+}
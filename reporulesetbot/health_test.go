@@ -0,0 +1,97 @@
+package reporulesetbot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// newReadyTestHandler returns a handler with a valid configuration and a cached release with one ruleset file.
+func newReadyTestHandler(t *testing.T) *RulesetHandler {
+	config := &Config{Server: HTTPConfig{Address: "127.0.0.1", Port: 8080}}
+	config.Github.App.IntegrationID = 12345
+	config.Github.App.PrivateKey = "some_private_key"
+	config.Github.App.WebhookSecret = "some_webhook_secret"
+	config.Github.V3APIURL = "https://api.github.com"
+
+	h := &RulesetHandler{Config: config, State: newTestStateStore(t), Metrics: metrics.NewRegistry()}
+	assert.NoError(t, h.State.SetRelease("v1.0.0"))
+	h.cacheBundle("v1.0.0", &rulesetBundle{Tag: "v1.0.0", Files: map[string][]byte{
+		"Default Ruleset.json": []byte(`{"name": "Default Ruleset", "target": "branch", "enforcement": "active"}`),
+	}}, h.Logger)
+	return h
+}
+
+// stubAuthenticateApp replaces the authentication of the app for a test.
+func stubAuthenticateApp(t *testing.T, err error) *int {
+	calls := 0
+	original := authenticateApp
+	authenticateApp = func(ctx context.Context) error {
+		calls++
+		return err
+	}
+	t.Cleanup(func() { authenticateApp = original })
+	return &calls
+}
+
+func TestHealthHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, HealthRoute, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, rec.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	calls := stubAuthenticateApp(t, nil)
+	h := newReadyTestHandler(t)
+
+	report := h.Readiness(context.Background())
+	assert.True(t, report.Ready)
+	assert.Equal(t, []ReadinessCheck{
+		{Name: ReadyCheckConfig, OK: true},
+		{Name: ReadyCheckRulesets, OK: true, Detail: "1 ruleset file(s) in release v1.0.0"},
+		{Name: ReadyCheckGitHubApp, OK: true},
+		{Name: ReadyCheckQueue, OK: true, Detail: "Events are handled synchronously"},
+	}, report.Checks)
+
+	// The authentication of the app is reused between probes.
+	h.Readiness(context.Background())
+	assert.Equal(t, 1, *calls)
+}
+
+func TestReadiness_Failures(t *testing.T) {
+	stubAuthenticateApp(t, errors.New("Failed to get app"))
+	h := newReadyTestHandler(t)
+	h.Config.Server.Port = 0
+	h.Config.Queue.Size = 10
+	metrics.NewRegisteredFunctionalGauge(githubapp.MetricsKeyQueueLength, h.Metrics, func() int64 { return 9 })
+	h.cacheBundle("v1.0.0", &rulesetBundle{Tag: "v1.0.0", Files: map[string][]byte{"Broken.json": []byte(`{`)}}, h.Logger)
+
+	rec := httptest.NewRecorder()
+	NewReadinessHandler(h).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ReadyRoute, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var report ReadinessReport
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.False(t, report.Ready)
+	for _, check := range report.Checks {
+		assert.False(t, check.OK, check.Name)
+		assert.NotEmpty(t, check.Error, check.Name)
+	}
+	assert.Equal(t, "9 of 10 queued", report.Checks[3].Detail)
+}
+
+func TestQueueConfigScheduler(t *testing.T) {
+	assert.NotNil(t, QueueConfig{}.Scheduler(metrics.NewRegistry()))
+
+	registry := metrics.NewRegistry()
+	assert.NotNil(t, QueueConfig{Size: 10}.Scheduler(registry))
+	assert.NotNil(t, registry.Get(githubapp.MetricsKeyQueueLength))
+}
@@ -0,0 +1,130 @@
+package reporulesetbot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// uninstalledReason is recorded in the audit log for the managed rulesets left in an organization the app was
+// uninstalled from.
+const uninstalledReason = "App was uninstalled and can no longer manage the ruleset"
+
+// handleInstallationDeleted forgets an organization the app was uninstalled from. GitHub revokes the app's access
+// along with the installation, so the managed rulesets can't be removed and are left in place; they are recorded in the
+// audit log so they can be cleaned up by hand.
+func (h *RulesetHandler) handleInstallationDeleted(ctx context.Context, orgName string, logger zerolog.Logger) error {
+	managed, err := h.tracker().ManagedRulesets(orgName)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get managed rulesets for organization %s", orgName)
+	}
+
+	if len(managed) > 0 {
+		names := make([]string, 0, len(managed))
+		for _, ruleset := range managed {
+			names = append(names, ruleset.Name)
+			h.audit(ctx, AuditEntry{Org: orgName, Ruleset: ruleset.Name, RulesetID: ruleset.ID, Action: AuditActionSkip, Reason: uninstalledReason}, logger)
+		}
+		logger.Warn().Msgf("The app can no longer access the organization %s, leaving its managed rulesets in place: %s.", orgName, strings.Join(names, ", "))
+	}
+
+	return h.forgetOrg(orgName)
+}
+
+// handleInstallationSuspended pauses or resumes the enforcement of the rulesets in an organization. When the
+// installation is unsuspended, the organization is fully synced to catch up on the changes made in the meantime.
+func (h *RulesetHandler) handleInstallationSuspended(ctx context.Context, installationID int64, orgName string, suspended bool, logger zerolog.Logger) error {
+	if h.State != nil {
+		if err := h.State.SetOrgSuspended(orgName, installationID, suspended); err != nil {
+			return errors.Wrapf(err, "Failed to record the suspension of the organization %s", orgName)
+		}
+	}
+
+	if suspended {
+		logger.Info().Msgf("Enforcement of the rulesets in the organization %s is paused.", orgName)
+		return nil
+	}
+
+	logger.Info().Msgf("Enforcement of the rulesets in the organization %s is resumed.", orgName)
+	return h.syncOrganization(ctx, installationID, orgName, h.orgRelease(orgName), logger)
+}
+
+// handleNewPermissionsAccepted retries the sync of an organization that failed, since it may have failed for lack of
+// the permissions that were just accepted.
+func (h *RulesetHandler) handleNewPermissionsAccepted(ctx context.Context, installationID int64, orgName string, logger zerolog.Logger) error {
+	if h.State != nil {
+		if org, ok := h.State.Org(orgName); ok && !org.hasErrors() {
+			logger.Info().Msgf("The last sync of the organization %s succeeded, nothing to retry.", orgName)
+			return nil
+		}
+	}
+
+	logger.Info().Msgf("Retrying the sync of the organization %s with the new permissions.", orgName)
+	return h.syncOrganization(ctx, installationID, orgName, h.orgRelease(orgName), logger)
+}
+
+// handleInstallationTarget processes installation target events, which GitHub sends when an organization is renamed.
+func (h *RulesetHandler) handleInstallationTarget(ctx context.Context, event *github.InstallationTargetEvent, logger zerolog.Logger) (err error) {
+	if event.GetAction() != ActionRenamed {
+		return nil
+	}
+
+	from := event.GetChanges().GetLogin().GetFrom()
+	to := event.GetAccount().GetLogin()
+
+	ctx, span := h.startSpan(ctx, "handle installation target "+event.GetAction(), AttributeOrg.String(to), AttributeInstallationID.Int64(event.GetInstallation().GetID()))
+	defer func() { endSpan(span, err) }()
+	if from == "" || to == "" || from == to {
+		return nil
+	}
+
+	logger.Info().Msgf("The organization %s was renamed to %s.", from, to)
+
+	if err := h.tracker().RenameOrg(from, to); err != nil {
+		return errors.Wrapf(err, "Failed to rename the organization %s to %s", from, to)
+	}
+	if h.State != nil && RulesetTracker(h.State) != h.tracker() {
+		if err := h.State.RenameOrg(from, to); err != nil {
+			return errors.Wrapf(err, "Failed to rename the organization %s to %s", from, to)
+		}
+	}
+	return nil
+}
+
+// forgetOrg removes an organization from the ruleset tracker and the state store.
+func (h *RulesetHandler) forgetOrg(orgName string) error {
+	if err := h.tracker().ForgetOrg(orgName); err != nil {
+		return errors.Wrapf(err, "Failed to forget the organization %s", orgName)
+	}
+	if h.State != nil && RulesetTracker(h.State) != h.tracker() {
+		if err := h.State.ForgetOrg(orgName); err != nil {
+			return errors.Wrapf(err, "Failed to forget the organization %s", orgName)
+		}
+	}
+	return nil
+}
+
+// isOrgSuspended returns true when the installation of the app in an organization is suspended.
+func (h *RulesetHandler) isOrgSuspended(orgName string) bool {
+	if h.State == nil {
+		return false
+	}
+	org, ok := h.State.Org(orgName)
+	return ok && org.Suspended
+}
+
+// hasErrors returns true when the last sync of the organization or of one of its rulesets failed.
+func (o OrgState) hasErrors() bool {
+	if o.LastError != "" {
+		return true
+	}
+	for _, ruleset := range o.Rulesets {
+		if ruleset.LastError != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package reporulesetbot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStateStore(t *testing.T) *StateStore {
+	dir, err := os.MkdirTemp("", "state_test")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	store, err := OpenStateStore(filepath.Join(dir, "state.json"))
+	assert.NoError(t, err)
+	return store
+}
+
+func TestHandleInstallationDeleted(t *testing.T) {
+	logger := zerolog.Nop()
+	store := newTestStateStore(t)
+	assert.NoError(t, store.TrackRuleset("test-org", ManagedRuleset{ID: 10, Name: "Default Ruleset", File: "Default Ruleset.json"}))
+	assert.NoError(t, store.RecordOrgSync("test-org", 42, "", nil))
+
+	sink := &memoryAuditSink{}
+	h := &RulesetHandler{State: store, Audit: sink}
+
+	assert.NoError(t, h.handleInstallationDeleted(context.Background(), "test-org", logger))
+
+	_, ok := store.Org("test-org")
+	assert.False(t, ok)
+
+	// The rulesets left in place are recorded in the audit log.
+	if assert.Len(t, sink.entries, 1) {
+		assert.Equal(t, AuditActionSkip, sink.entries[0].Action)
+		assert.Equal(t, "Default Ruleset", sink.entries[0].Ruleset)
+		assert.Equal(t, uninstalledReason, sink.entries[0].Reason)
+	}
+}
+
+func TestHandleInstallationSuspended(t *testing.T) {
+	logger := zerolog.Nop()
+	store := newTestStateStore(t)
+	h := &RulesetHandler{State: store}
+
+	assert.False(t, h.isOrgSuspended("test-org"))
+	assert.NoError(t, h.handleInstallationSuspended(context.Background(), 42, "test-org", true, logger))
+	assert.True(t, h.isOrgSuspended("test-org"))
+
+	org, _ := store.Org("test-org")
+	assert.Equal(t, int64(42), org.InstallationID)
+
+	// Without a state store there is nowhere to record the suspension.
+	assert.False(t, (&RulesetHandler{}).isOrgSuspended("test-org"))
+}
+
+func TestHandleNewPermissionsAccepted(t *testing.T) {
+	logger := zerolog.Nop()
+	store := newTestStateStore(t)
+	assert.NoError(t, store.RecordOrgSync("test-org", 42, "", nil))
+
+	// A successful last sync is not retried.
+	h := &RulesetHandler{State: store}
+	assert.NoError(t, h.handleNewPermissionsAccepted(context.Background(), 42, "test-org", logger))
+}
+
+func TestOrgStateHasErrors(t *testing.T) {
+	assert.False(t, OrgState{}.hasErrors())
+	assert.True(t, OrgState{LastError: "Failed to get team"}.hasErrors())
+	assert.True(t, OrgState{Rulesets: map[string]*RulesetState{"a.json": {LastError: "Failed to get team"}}}.hasErrors())
+}
+
+func TestHandleInstallationTarget(t *testing.T) {
+	logger := zerolog.Nop()
+	store := newTestStateStore(t)
+	assert.NoError(t, store.TrackRuleset("old-org", ManagedRuleset{ID: 10, Name: "Default Ruleset", File: "Default Ruleset.json"}))
+	assert.NoError(t, store.RecordOrgSync("old-org", 42, "", errors.New("Failed to get team")))
+
+	h := &RulesetHandler{State: store}
+	event := &github.InstallationTargetEvent{
+		Action:  github.String(ActionRenamed),
+		Account: &github.User{Login: github.String("new-org")},
+		Changes: &github.InstallationChanges{Login: &github.InstallationLoginChange{From: github.String("old-org")}},
+	}
+
+	assert.NoError(t, h.handleInstallationTarget(context.Background(), event, logger))
+
+	_, ok := store.Org("old-org")
+	assert.False(t, ok)
+
+	org, ok := store.Org("new-org")
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), org.InstallationID)
+	assert.Equal(t, "Failed to get team", org.LastError)
+
+	managed, err := store.ManagedRulesets("new-org")
+	assert.NoError(t, err)
+	assert.Equal(t, []ManagedRuleset{{ID: 10, Name: "Default Ruleset", File: "Default Ruleset.json"}}, managed)
+
+	// A separate tracker is renamed along with the state store.
+	tracker := NewMemoryRulesetTracker()
+	assert.NoError(t, tracker.TrackRuleset("old-org", ManagedRuleset{ID: 10, Name: "Default Ruleset", File: "Default Ruleset.json"}))
+	h = &RulesetHandler{Tracker: tracker}
+	assert.NoError(t, h.handleInstallationTarget(context.Background(), event, logger))
+
+	managed, err = tracker.ManagedRulesets("new-org")
+	assert.NoError(t, err)
+	assert.Len(t, managed, 1)
+}
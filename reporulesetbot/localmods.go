@@ -0,0 +1,122 @@
+package reporulesetbot
+
+import (
+	"strings"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+)
+
+// Constants for the ways organizations may modify a path of a managed ruleset.
+const (
+	// LocalModificationExtend lets organizations add items to a list or object, but not remove the configured ones.
+	LocalModificationExtend = "extend"
+	// LocalModificationChange lets organizations replace the value altogether.
+	LocalModificationChange = "change"
+)
+
+// LocalModification represents a path of a ruleset that organizations are allowed to modify. Paths are dotted JSON
+// paths into the ruleset, with rules keyed by type and bypass actors by actor type and ID, for example
+// conditions.ref_name.exclude, bypass_actors or rules.required_status_checks.parameters.required_status_checks.
+type LocalModification struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+}
+
+// rulesetFileOptions represents the settings of a ruleset file that aren't part of the ruleset itself.
+type rulesetFileOptions struct {
+	AllowedLocalModifications []LocalModification `json:"allowed_local_modifications"`
+}
+
+// validate checks that the local modification has a path and a known mode.
+func (m LocalModification) validate() error {
+	if m.Path == "" {
+		return errors.New("Allowed local modification is missing a path")
+	}
+	switch m.Mode {
+	case LocalModificationExtend, LocalModificationChange:
+		return nil
+	default:
+		return errors.Errorf("Unknown mode %s for allowed local modification %s, expected %s or %s", m.Mode, m.Path, LocalModificationExtend, LocalModificationChange)
+	}
+}
+
+// withLocalModifications returns the desired ruleset with the live values of the paths organizations are allowed to
+// modify merged into it. The desired ruleset is returned as is when it doesn't allow any local modifications.
+func (d *DesiredRuleset) withLocalModifications(live *github.Ruleset) (*github.Ruleset, error) {
+	if len(d.LocalModifications) == 0 || live == nil {
+		return d.Ruleset, nil
+	}
+
+	desired, err := normalizeRuleset(d.Ruleset)
+	if err != nil {
+		return nil, err
+	}
+	current, err := normalizeRuleset(live)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, modification := range d.LocalModifications {
+		path := strings.Split(modification.Path, ".")
+		liveValue := getPath(current, path)
+		switch modification.Mode {
+		case LocalModificationChange:
+			setPath(desired, path, liveValue)
+		case LocalModificationExtend:
+			setPath(desired, path, extendValue(getPath(desired, path), liveValue))
+		}
+	}
+
+	return denormalizeRuleset(d.Ruleset, desired)
+}
+
+// getPath returns the value at a path of a normalized ruleset, or nil when it isn't set.
+func getPath(object map[string]interface{}, path []string) interface{} {
+	var value interface{} = object
+	for _, key := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// extendValue returns the configured value extended with the live one. Lists get the live items that aren't
+// configured appended, and objects get the live fields that aren't configured added. Other values can't be extended
+// and keep their configured value.
+func extendValue(desired, live interface{}) interface{} {
+	if isEmptyValue(desired) {
+		switch live.(type) {
+		case []interface{}, map[string]interface{}:
+			return live
+		}
+		return desired
+	}
+
+	switch desiredValue := desired.(type) {
+	case []interface{}:
+		liveValue, _ := live.([]interface{})
+		extended := append([]interface{}{}, desiredValue...)
+		for _, item := range liveValue {
+			if !containsAll(desiredValue, []interface{}{item}) {
+				extended = append(extended, item)
+			}
+		}
+		return extended
+	case map[string]interface{}:
+		liveValue, _ := live.(map[string]interface{})
+		extended := make(map[string]interface{}, len(desiredValue)+len(liveValue))
+		for k, v := range liveValue {
+			extended[k] = v
+		}
+		for k, v := range desiredValue {
+			extended[k] = v
+		}
+		return extended
+	default:
+		return desired
+	}
+}
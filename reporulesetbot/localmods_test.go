@@ -0,0 +1,91 @@
+package reporulesetbot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithLocalModifications(t *testing.T) {
+	desired := &DesiredRuleset{
+		Ruleset: newTestRuleset(t, `{
+			"name": "Default Ruleset",
+			"enforcement": "active",
+			"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"], "exclude": ["refs/heads/legacy"]}},
+			"rules": [
+				{"type": "required_status_checks", "parameters": {"strict_required_status_checks_policy": true, "required_status_checks": [{"context": "build"}]}}
+			],
+			"bypass_actors": [{"actor_id": 1, "actor_type": "OrganizationAdmin", "bypass_mode": "always"}]
+		}`),
+		LocalModifications: []LocalModification{
+			{Path: "conditions.ref_name.exclude", Mode: LocalModificationExtend},
+			{Path: "bypass_actors", Mode: LocalModificationExtend},
+			{Path: "rules.required_status_checks.parameters.strict_required_status_checks_policy", Mode: LocalModificationChange},
+		},
+	}
+
+	live := newTestRuleset(t, `{
+		"id": 42,
+		"name": "Default Ruleset",
+		"enforcement": "disabled",
+		"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"], "exclude": ["refs/heads/sandbox"]}},
+		"rules": [
+			{"type": "required_status_checks", "parameters": {"strict_required_status_checks_policy": false, "required_status_checks": []}}
+		],
+		"bypass_actors": [{"actor_id": 7, "actor_type": "Team", "bypass_mode": "always"}]
+	}`)
+
+	merged, err := desired.withLocalModifications(live)
+	assert.NoError(t, err)
+
+	changes, err := diffRulesets(live, merged)
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldChange{
+		{Path: "bypass_actors.OrganizationAdmin:1", To: map[string]interface{}{"actor_id": 1.0, "actor_type": "OrganizationAdmin", "bypass_mode": "always"}},
+		{Path: "conditions.ref_name.exclude", From: []interface{}{"refs/heads/sandbox"}, To: []interface{}{"refs/heads/legacy", "refs/heads/sandbox"}},
+		{Path: "enforcement", From: "disabled", To: "active"},
+		{Path: "rules.required_status_checks.parameters.required_status_checks", To: []interface{}{map[string]interface{}{"context": "build"}}},
+	}, changes)
+	assert.Len(t, merged.BypassActors, 2)
+
+	// The configuration itself is left untouched.
+	assert.Len(t, desired.BypassActors, 1)
+	assert.Equal(t, []string{"refs/heads/legacy"}, desired.Conditions.RefName.Exclude)
+}
+
+func TestWithLocalModifications_None(t *testing.T) {
+	desired := &DesiredRuleset{Ruleset: newTestRuleset(t, `{"name": "Default Ruleset"}`)}
+
+	merged, err := desired.withLocalModifications(newTestRuleset(t, `{"name": "Default Ruleset", "enforcement": "disabled"}`))
+	assert.NoError(t, err)
+	assert.Same(t, desired.Ruleset, merged)
+}
+
+func TestExtendValue(t *testing.T) {
+	assert.Equal(t, []interface{}{"a", "b"}, extendValue([]interface{}{"a"}, []interface{}{"b", "a"}))
+	assert.Equal(t, []interface{}{"b"}, extendValue(nil, []interface{}{"b"}))
+	assert.Equal(t, map[string]interface{}{"a": 1.0, "b": 3.0}, extendValue(map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 2.0, "b": 3.0}))
+	assert.Equal(t, "active", extendValue("active", "disabled"))
+}
+
+func TestProcessRulesetData_AllowedLocalModifications(t *testing.T) {
+	logger := zerolog.Nop()
+	h := &RulesetHandler{}
+
+	ruleset, err := h.processRulesetData("Default Ruleset.json", []byte(`{
+		"name": "Default Ruleset",
+		"enforcement": "active",
+		"allowed_local_modifications": [{"path": "bypass_actors", "mode": "extend"}]
+	}`), context.Background(), nil, "test-org", logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "Default Ruleset.json", ruleset.File)
+	assert.Equal(t, []LocalModification{{Path: "bypass_actors", Mode: LocalModificationExtend}}, ruleset.LocalModifications)
+
+	_, err = h.processRulesetData("Invalid Ruleset.json", []byte(`{
+		"name": "Invalid Ruleset",
+		"allowed_local_modifications": [{"path": "bypass_actors", "mode": "remove"}]
+	}`), context.Background(), nil, "test-org", logger)
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package reporulesetbot
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Constants for the formats of the logs.
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+// Names of the structured fields of the logs, so the logs of an event, organization or ruleset can be filtered.
+const (
+	LogFieldDeliveryID     = "delivery_id"
+	LogFieldEventType      = "event"
+	LogFieldAction         = "action"
+	LogFieldInstallationID = "installation_id"
+	LogFieldOrg            = "org"
+	LogFieldRuleset        = "ruleset"
+	LogFieldRelease        = "release"
+	LogFieldTraceID        = "trace_id"
+)
+
+// LogConfig represents the configuration of the logs.
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// level returns the configured log level, info by default.
+func (c LogConfig) level() (zerolog.Level, error) {
+	if c.Level == "" {
+		return zerolog.InfoLevel, nil
+	}
+	level, err := zerolog.ParseLevel(c.Level)
+	if err != nil {
+		return zerolog.NoLevel, errors.Errorf("Invalid log level %s, expected trace, debug, info, warn, error, fatal, panic or disabled", c.Level)
+	}
+	return level, nil
+}
+
+// validate validates the log configuration.
+func (c LogConfig) validate() error {
+	switch c.Format {
+	case "", LogFormatJSON, LogFormatConsole:
+	default:
+		return errors.Errorf("Invalid log format %s, expected %s or %s", c.Format, LogFormatJSON, LogFormatConsole)
+	}
+	_, err := c.level()
+	return err
+}
+
+// NewLogger returns a logger that writes to w at the configured level and in the configured format, JSON by default.
+func NewLogger(config LogConfig, w io.Writer) (zerolog.Logger, error) {
+	if err := config.validate(); err != nil {
+		return zerolog.Nop(), err
+	}
+	level, _ := config.level()
+
+	if config.Format == LogFormatConsole {
+		w = zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339}
+	}
+	return zerolog.New(w).Level(level).With().Timestamp().Logger(), nil
+}
+
+// eventLogger returns a child logger for a webhook event, with its delivery ID, event type and action, and the ID of
+// its trace when it is traced.
+func eventLogger(ctx context.Context, logger zerolog.Logger, deliveryID, eventType, action string) zerolog.Logger {
+	fields := logger.With().
+		Str(LogFieldDeliveryID, deliveryID).
+		Str(LogFieldEventType, eventType)
+	if action != "" {
+		fields = fields.Str(LogFieldAction, action)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		fields = fields.Str(LogFieldTraceID, spanContext.TraceID().String())
+	}
+	return fields.Logger()
+}
+
+// orgLogger returns a child logger for an organization and the installation of the app in it.
+func orgLogger(logger zerolog.Logger, orgName string, installationID int64) zerolog.Logger {
+	fields := logger.With().Str(LogFieldOrg, orgName)
+	if installationID != 0 {
+		fields = fields.Int64(LogFieldInstallationID, installationID)
+	}
+	return fields.Logger()
+}
+
+// rulesetLogger returns a child logger for a ruleset.
+func rulesetLogger(logger zerolog.Logger, rulesetName string) zerolog.Logger {
+	return logger.With().Str(LogFieldRuleset, rulesetName).Logger()
+}
@@ -0,0 +1,111 @@
+package reporulesetbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// logLines returns the JSON log lines written to a buffer.
+func logLines(t *testing.T, buffer *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var fields map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &fields))
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestLogConfigValidate(t *testing.T) {
+	assert.NoError(t, LogConfig{}.validate())
+	assert.NoError(t, LogConfig{Level: "debug", Format: LogFormatConsole}.validate())
+	assert.NoError(t, LogConfig{Level: "warn", Format: LogFormatJSON}.validate())
+	assert.Error(t, LogConfig{Level: "verbose"}.validate())
+	assert.Error(t, LogConfig{Format: "logfmt"}.validate())
+}
+
+func TestNewLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger, err := NewLogger(LogConfig{}, &buffer)
+	assert.NoError(t, err)
+	logger.Debug().Msg("Hidden.")
+	logger.Info().Str(LogFieldOrg, "octo-org").Msg("Shown.")
+
+	lines := logLines(t, &buffer)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "Shown.", lines[0]["message"])
+		assert.Equal(t, "octo-org", lines[0][LogFieldOrg])
+		assert.NotEmpty(t, lines[0]["time"])
+	}
+
+	buffer.Reset()
+	logger, err = NewLogger(LogConfig{Level: "debug", Format: LogFormatConsole}, &buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, zerolog.DebugLevel, logger.GetLevel())
+	logger.Debug().Str(LogFieldOrg, "octo-org").Msg("Shown.")
+	assert.Contains(t, buffer.String(), "Shown.")
+	assert.Contains(t, buffer.String(), "octo-org")
+	assert.False(t, json.Valid(buffer.Bytes()))
+
+	_, err = NewLogger(LogConfig{Level: "verbose"}, &buffer)
+	assert.Error(t, err)
+}
+
+func TestHandleLogsEventFields(t *testing.T) {
+	var buffer bytes.Buffer
+	provider, _ := newTestTracerProvider(t)
+	h := &RulesetHandler{Logger: zerolog.New(&buffer), TracerProvider: provider}
+
+	payload := []byte(`{"action": "created", "release": {"tag_name": "v1.0.0"}, "repository": {"full_name": "octo-org/rulesets"}, "installation": {"id": 7}}`)
+	assert.NoError(t, h.Handle(context.Background(), EventTypeRelease, "delivery-1", payload))
+
+	lines := logLines(t, &buffer)
+	if assert.NotEmpty(t, lines) {
+		assert.Equal(t, "delivery-1", lines[0][LogFieldDeliveryID])
+		assert.Equal(t, EventTypeRelease, lines[0][LogFieldEventType])
+		assert.Equal(t, "created", lines[0][LogFieldAction])
+		assert.Equal(t, "v1.0.0", lines[0][LogFieldRelease])
+		assert.Len(t, lines[0][LogFieldTraceID], 32)
+	}
+}
+
+func TestHandleRulesetEventLogsOrgFields(t *testing.T) {
+	var buffer bytes.Buffer
+	h := &RulesetHandler{Logger: zerolog.New(&buffer)}
+
+	payload := []byte(`{"action": "archived", "organization": {"login": "octo-org"}, "installation": {"id": 7}, "repository_ruleset": {"name": "Default Ruleset"}}`)
+	assert.NoError(t, h.Handle(context.Background(), EventTypeRepositoryRuleset, "delivery-2", payload))
+
+	lines := logLines(t, &buffer)
+	if assert.Len(t, lines, 2) {
+		for _, line := range lines {
+			assert.Equal(t, "delivery-2", line[LogFieldDeliveryID])
+			assert.Equal(t, "octo-org", line[LogFieldOrg])
+			assert.Equal(t, float64(7), line[LogFieldInstallationID])
+			assert.Equal(t, "Default Ruleset", line[LogFieldRuleset])
+			assert.NotContains(t, line, LogFieldTraceID)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		assert.Equal(t, 1, strings.Count(line, `"org":`))
+	}
+}
+
+func TestOrgLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := rulesetLogger(orgLogger(zerolog.New(&buffer), "octo-org", 0), "Default Ruleset")
+	logger.Info().Msg("Synced.")
+
+	lines := logLines(t, &buffer)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "octo-org", lines[0][LogFieldOrg])
+		assert.Equal(t, "Default Ruleset", lines[0][LogFieldRuleset])
+		assert.NotContains(t, lines[0], LogFieldInstallationID)
+	}
+}
@@ -0,0 +1,226 @@
+package reporulesetbot
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// ManagedRuleset represents an organization ruleset that was deployed by the app.
+type ManagedRuleset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	File string `json:"file"`
+}
+
+// RulesetTracker keeps track of the rulesets the app deployed to each organization.
+type RulesetTracker interface {
+	// ManagedRulesets returns the rulesets the app deployed to an organization.
+	ManagedRulesets(orgName string) ([]ManagedRuleset, error)
+	// TrackRuleset records a ruleset deployed to an organization, replacing any ruleset tracked for the same file.
+	TrackRuleset(orgName string, ruleset ManagedRuleset) error
+	// UntrackRuleset forgets a ruleset that no longer exists in an organization.
+	UntrackRuleset(orgName string, rulesetID int64) error
+	// RenameOrg moves the rulesets tracked for an organization to its new name.
+	RenameOrg(from, to string) error
+	// ForgetOrg forgets every ruleset tracked for an organization.
+	ForgetOrg(orgName string) error
+}
+
+// memoryRulesetTracker is a RulesetTracker that keeps the managed rulesets in memory.
+type memoryRulesetTracker struct {
+	mu   sync.Mutex
+	orgs map[string]map[int64]ManagedRuleset
+}
+
+// NewMemoryRulesetTracker returns a RulesetTracker that keeps the managed rulesets in memory.
+func NewMemoryRulesetTracker() RulesetTracker {
+	return &memoryRulesetTracker{
+		orgs: make(map[string]map[int64]ManagedRuleset),
+	}
+}
+
+// ManagedRulesets returns the rulesets the app deployed to an organization, sorted by ID.
+func (t *memoryRulesetTracker) ManagedRulesets(orgName string) ([]ManagedRuleset, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var rulesets []ManagedRuleset
+	for _, ruleset := range t.orgs[orgName] {
+		rulesets = append(rulesets, ruleset)
+	}
+	sort.Slice(rulesets, func(i, j int) bool { return rulesets[i].ID < rulesets[j].ID })
+	return rulesets, nil
+}
+
+// TrackRuleset records a ruleset deployed to an organization, replacing any ruleset tracked for the same file.
+func (t *memoryRulesetTracker) TrackRuleset(orgName string, ruleset ManagedRuleset) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rulesets, ok := t.orgs[orgName]
+	if !ok {
+		rulesets = make(map[int64]ManagedRuleset)
+		t.orgs[orgName] = rulesets
+	}
+
+	for id, tracked := range rulesets {
+		if tracked.File == ruleset.File {
+			delete(rulesets, id)
+		}
+	}
+	rulesets[ruleset.ID] = ruleset
+	return nil
+}
+
+// UntrackRuleset forgets a ruleset that no longer exists in an organization.
+func (t *memoryRulesetTracker) UntrackRuleset(orgName string, rulesetID int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.orgs[orgName], rulesetID)
+	return nil
+}
+
+// RenameOrg moves the rulesets tracked for an organization to its new name.
+func (t *memoryRulesetTracker) RenameOrg(from, to string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if rulesets, ok := t.orgs[from]; ok {
+		delete(t.orgs, from)
+		t.orgs[to] = rulesets
+	}
+	return nil
+}
+
+// ForgetOrg forgets every ruleset tracked for an organization.
+func (t *memoryRulesetTracker) ForgetOrg(orgName string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.orgs, orgName)
+	return nil
+}
+
+// tracker returns the ruleset tracker of the handler. It defaults to the state store when there is one,
+// and to an in-memory tracker otherwise.
+func (h *RulesetHandler) tracker() RulesetTracker {
+	h.trackerOnce.Do(func() {
+		switch {
+		case h.Tracker != nil:
+		case h.State != nil:
+			h.Tracker = h.State
+		default:
+			h.Tracker = NewMemoryRulesetTracker()
+		}
+	})
+	return h.Tracker
+}
+
+// trackRuleset records that an organization ruleset was deployed from a desired ruleset.
+func (h *RulesetHandler) trackRuleset(orgName string, rulesetID int64, ruleset *DesiredRuleset) error {
+	if err := h.tracker().TrackRuleset(orgName, ManagedRuleset{ID: rulesetID, Name: ruleset.Name, File: ruleset.File}); err != nil {
+		return errors.Wrapf(err, "Failed to track ruleset %s in organization %s", ruleset.Name, orgName)
+	}
+	return nil
+}
+
+// findManagedRuleset returns the desired ruleset an organization ruleset is managed by, or nil if it isn't managed.
+// Rulesets are matched by their tracked ID first. When the ID isn't tracked, a ruleset matching by name is adopted,
+// unless the desired ruleset is already tracked under another ID, which means the ruleset is an unrelated one with
+// the same name.
+func (h *RulesetHandler) findManagedRuleset(orgName string, rulesetID int64, rulesets []*DesiredRuleset, matchName func(*github.Ruleset) bool, logger zerolog.Logger) (*DesiredRuleset, error) {
+	managed, err := h.tracker().ManagedRulesets(orgName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get managed rulesets for organization %s", orgName)
+	}
+
+	for _, tracked := range managed {
+		if tracked.ID != rulesetID {
+			continue
+		}
+		if ruleset := desiredRulesetFor(tracked, rulesets); ruleset != nil {
+			return ruleset, nil
+		}
+		logger.Info().Msgf("Ruleset with ID %d in the organization %s was deployed from %s, which is no longer configured.", rulesetID, orgName, tracked.File)
+		return nil, nil
+	}
+
+	for _, ruleset := range rulesets {
+		if !matchName(ruleset.Ruleset) {
+			continue
+		}
+
+		if trackedID := trackedRulesetID(managed, ruleset.File); trackedID != 0 {
+			logger.Info().Msgf("Ruleset with ID %d in the organization %s has the same name as the managed ruleset %s with ID %d, ignoring it.", rulesetID, orgName, ruleset.Name, trackedID)
+			return nil, nil
+		}
+
+		logger.Info().Msgf("Adopting ruleset with ID %d in the organization %s as the managed ruleset %s.", rulesetID, orgName, ruleset.Name)
+		if err := h.trackRuleset(orgName, rulesetID, ruleset); err != nil {
+			return nil, err
+		}
+		return ruleset, nil
+	}
+
+	return nil, nil
+}
+
+// findOrgRuleset returns the organization ruleset that is managed by a desired ruleset, or nil if there is none.
+// The tracked ID is preferred, and an organization ruleset with the same name is adopted otherwise.
+func findOrgRuleset(ruleset *DesiredRuleset, orgRulesets []*github.Ruleset, managed []ManagedRuleset) *github.Ruleset {
+	if trackedID := trackedRulesetID(managed, ruleset.File); trackedID != 0 {
+		for _, orgRuleset := range orgRulesets {
+			if orgRuleset.GetID() == trackedID {
+				return orgRuleset
+			}
+		}
+	}
+
+	for _, orgRuleset := range orgRulesets {
+		if orgRuleset.Name == ruleset.Name && !isTrackedRulesetID(managed, orgRuleset.GetID()) {
+			return orgRuleset
+		}
+	}
+
+	return nil
+}
+
+// desiredRulesetFor returns the desired ruleset a managed ruleset was deployed from.
+func desiredRulesetFor(tracked ManagedRuleset, rulesets []*DesiredRuleset) *DesiredRuleset {
+	for _, ruleset := range rulesets {
+		if ruleset.File == tracked.File {
+			return ruleset
+		}
+	}
+	for _, ruleset := range rulesets {
+		if ruleset.Name == tracked.Name {
+			return ruleset
+		}
+	}
+	return nil
+}
+
+// trackedRulesetID returns the ID of the managed ruleset deployed from a file, or 0 if there is none.
+func trackedRulesetID(managed []ManagedRuleset, file string) int64 {
+	for _, tracked := range managed {
+		if tracked.File == file {
+			return tracked.ID
+		}
+	}
+	return 0
+}
+
+// isTrackedRulesetID returns true if the ruleset ID belongs to a managed ruleset.
+func isTrackedRulesetID(managed []ManagedRuleset, rulesetID int64) bool {
+	for _, tracked := range managed {
+		if tracked.ID == rulesetID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package reporulesetbot
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRulesetTracker(t *testing.T) {
+	tracker := NewMemoryRulesetTracker()
+
+	assert.NoError(t, tracker.TrackRuleset("test-org", ManagedRuleset{ID: 2, Name: "ruleset-b", File: "b.json"}))
+	assert.NoError(t, tracker.TrackRuleset("test-org", ManagedRuleset{ID: 1, Name: "ruleset-a", File: "a.json"}))
+
+	managed, err := tracker.ManagedRulesets("test-org")
+	assert.NoError(t, err)
+	assert.Equal(t, []ManagedRuleset{
+		{ID: 1, Name: "ruleset-a", File: "a.json"},
+		{ID: 2, Name: "ruleset-b", File: "b.json"},
+	}, managed)
+
+	// Tracking a new ID for the same file replaces the old one.
+	assert.NoError(t, tracker.TrackRuleset("test-org", ManagedRuleset{ID: 3, Name: "ruleset-a", File: "a.json"}))
+	assert.NoError(t, tracker.UntrackRuleset("test-org", 2))
+
+	managed, err = tracker.ManagedRulesets("test-org")
+	assert.NoError(t, err)
+	assert.Equal(t, []ManagedRuleset{{ID: 3, Name: "ruleset-a", File: "a.json"}}, managed)
+
+	managed, err = tracker.ManagedRulesets("other-org")
+	assert.NoError(t, err)
+	assert.Empty(t, managed)
+
+	// Renaming an organization keeps its rulesets, and forgetting it drops them.
+	assert.NoError(t, tracker.RenameOrg("test-org", "renamed-org"))
+	managed, err = tracker.ManagedRulesets("renamed-org")
+	assert.NoError(t, err)
+	assert.Equal(t, []ManagedRuleset{{ID: 3, Name: "ruleset-a", File: "a.json"}}, managed)
+
+	assert.NoError(t, tracker.ForgetOrg("renamed-org"))
+	managed, err = tracker.ManagedRulesets("renamed-org")
+	assert.NoError(t, err)
+	assert.Empty(t, managed)
+}
+
+func TestFindManagedRuleset(t *testing.T) {
+	logger := zerolog.Nop()
+	desired := []*DesiredRuleset{
+		{Ruleset: &github.Ruleset{Name: "Default Ruleset"}, File: "Default Ruleset.json"},
+	}
+	byName := func(name string) func(*github.Ruleset) bool {
+		return func(r *github.Ruleset) bool { return r.Name == name }
+	}
+
+	t.Run("adopts an untracked ruleset with the same name", func(t *testing.T) {
+		handler := &RulesetHandler{}
+
+		ruleset, err := handler.findManagedRuleset("test-org", 10, desired, byName("Default Ruleset"), logger)
+		assert.NoError(t, err)
+		assert.Equal(t, desired[0], ruleset)
+
+		managed, _ := handler.tracker().ManagedRulesets("test-org")
+		assert.Equal(t, []ManagedRuleset{{ID: 10, Name: "Default Ruleset", File: "Default Ruleset.json"}}, managed)
+	})
+
+	t.Run("finds a renamed ruleset by ID", func(t *testing.T) {
+		handler := &RulesetHandler{}
+		assert.NoError(t, handler.trackRuleset("test-org", 10, desired[0]))
+
+		ruleset, err := handler.findManagedRuleset("test-org", 10, desired, byName("Renamed Ruleset"), logger)
+		assert.NoError(t, err)
+		assert.Equal(t, desired[0], ruleset)
+	})
+
+	t.Run("ignores an unrelated ruleset that reuses the managed name", func(t *testing.T) {
+		handler := &RulesetHandler{}
+		assert.NoError(t, handler.trackRuleset("test-org", 10, desired[0]))
+
+		ruleset, err := handler.findManagedRuleset("test-org", 20, desired, byName("Default Ruleset"), logger)
+		assert.NoError(t, err)
+		assert.Nil(t, ruleset)
+	})
+
+	t.Run("ignores a ruleset whose file is no longer configured", func(t *testing.T) {
+		handler := &RulesetHandler{}
+		assert.NoError(t, handler.tracker().TrackRuleset("test-org", ManagedRuleset{ID: 30, Name: "Old Ruleset", File: "Old Ruleset.json"}))
+
+		ruleset, err := handler.findManagedRuleset("test-org", 30, desired, byName("Old Ruleset"), logger)
+		assert.NoError(t, err)
+		assert.Nil(t, ruleset)
+	})
+}
+
+func TestFindOrgRuleset(t *testing.T) {
+	desired := &DesiredRuleset{Ruleset: &github.Ruleset{Name: "Default Ruleset"}, File: "Default Ruleset.json"}
+
+	renamed := &github.Ruleset{ID: github.Int64(10), Name: "Renamed Ruleset"}
+	impostor := &github.Ruleset{ID: github.Int64(20), Name: "Default Ruleset"}
+
+	t.Run("prefers the tracked ID", func(t *testing.T) {
+		managed := []ManagedRuleset{{ID: 10, Name: "Default Ruleset", File: "Default Ruleset.json"}}
+		assert.Equal(t, renamed, findOrgRuleset(desired, []*github.Ruleset{impostor, renamed}, managed))
+	})
+
+	t.Run("falls back to the name when the ruleset isn't tracked", func(t *testing.T) {
+		assert.Equal(t, impostor, findOrgRuleset(desired, []*github.Ruleset{impostor, renamed}, nil))
+	})
+
+	t.Run("does not match rulesets tracked for another file", func(t *testing.T) {
+		managed := []ManagedRuleset{{ID: 20, Name: "Default Ruleset", File: "Other.json"}}
+		assert.Nil(t, findOrgRuleset(desired, []*github.Ruleset{impostor}, managed))
+	})
+}
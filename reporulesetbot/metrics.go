@@ -0,0 +1,292 @@
+package reporulesetbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// MetricsRoute is the path the metrics are served at in the Prometheus text format.
+const MetricsRoute = "/metrics"
+
+// Metric keys for the events handled and the actions taken by the app. Like the keys of go-githubapp, labels are
+// added in brackets, such as events.handled[type:release,action:released].
+const (
+	MetricsKeyEventsHandled      = "events.handled"
+	MetricsKeyEventsFailed       = "events.failed"
+	MetricsKeyEventLatency       = "events.latency.seconds"
+	MetricsKeyEventsDuplicates   = "events.duplicates"
+	MetricsKeyRulesetActions     = "rulesets.actions"
+	MetricsKeyResolutionFailures = "rulesets.resolution.failures"
+	MetricsKeyRolloutResults     = "rollouts.results"
+	MetricsKeyRolloutsAborted    = "rollouts.aborted"
+)
+
+// defaultLatencyBuckets are the upper bounds, in seconds, of the buckets of the event latency histogram.
+var defaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// BucketHistogram counts observations in buckets with fixed upper bounds, so it can be exported as a Prometheus
+// histogram. A go-metrics registry only keeps its own metric types, so it embeds a histogram that records nothing.
+type BucketHistogram struct {
+	metrics.NilHistogram
+
+	mu      sync.Mutex
+	bounds  []float64
+	buckets []int64
+	count   int64
+	sum     float64
+}
+
+// NewBucketHistogram returns a histogram with the given bucket upper bounds, in increasing order.
+func NewBucketHistogram(bounds []float64) *BucketHistogram {
+	return &BucketHistogram{bounds: bounds, buckets: make([]int64, len(bounds))}
+}
+
+// Observe adds an observation to the histogram.
+func (b *BucketHistogram) Observe(value float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, bound := range b.bounds {
+		if value <= bound {
+			b.buckets[i]++
+			break
+		}
+	}
+	b.count++
+	b.sum += value
+}
+
+// snapshot returns the bucket upper bounds, the cumulative count of each bucket, the total count and the sum.
+func (b *BucketHistogram) snapshot() ([]float64, []int64, int64, float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cumulative := make([]int64, len(b.buckets))
+	var total int64
+	for i, count := range b.buckets {
+		total += count
+		cumulative[i] = total
+	}
+	return b.bounds, cumulative, b.count, b.sum
+}
+
+// metricKey returns the key of a metric with labels, given as name and value pairs.
+func metricKey(name string, labels ...string) string {
+	if len(labels) < 2 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+":"+labels[i+1])
+	}
+	return name + "[" + strings.Join(pairs, ",") + "]"
+}
+
+// metrics returns the registry the metrics of the handler are recorded in.
+func (h *RulesetHandler) metrics() metrics.Registry {
+	if h.Metrics == nil {
+		return metrics.DefaultRegistry
+	}
+	return h.Metrics
+}
+
+// incCounter increments a counter with labels, given as name and value pairs.
+func (h *RulesetHandler) incCounter(name string, labels ...string) {
+	metrics.GetOrRegisterCounter(metricKey(name, labels...), h.metrics()).Inc(1)
+}
+
+// recordEvent records that an event was handled, how long it took and whether it failed.
+func (h *RulesetHandler) recordEvent(eventType, action string, latency time.Duration, err error) {
+	labels := []string{"type", eventType, "action", action}
+	h.incCounter(MetricsKeyEventsHandled, labels...)
+	if err != nil {
+		h.incCounter(MetricsKeyEventsFailed, labels...)
+	}
+
+	histogram := h.metrics().GetOrRegister(metricKey(MetricsKeyEventLatency, "type", eventType), func() *BucketHistogram {
+		return NewBucketHistogram(defaultLatencyBuckets)
+	})
+	if histogram, ok := histogram.(*BucketHistogram); ok {
+		histogram.Observe(latency.Seconds())
+	}
+}
+
+// eventAction returns the action of an event payload, or an empty string if it has none.
+func eventAction(payload []byte) string {
+	var event struct {
+		Action string `json:"action"`
+	}
+	_ = json.Unmarshal(payload, &event)
+	return event.Action
+}
+
+// NewMetricsHandler returns a handler that serves the metrics in a registry in the Prometheus text format.
+func NewMetricsHandler(registry metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, registry)
+	})
+}
+
+// metricFamily represents the samples of a Prometheus metric that share a name.
+type metricFamily struct {
+	kind    string
+	samples []string
+}
+
+// WritePrometheus writes the metrics in a registry in the Prometheus text format. Counters and meters are exported as
+// counters, gauges as gauges, histograms and timers as summaries, and bucket histograms as histograms. Timers are
+// exported in seconds.
+func WritePrometheus(w io.Writer, registry metrics.Registry) error {
+	families := make(map[string]*metricFamily)
+	add := func(name, kind, sample string) {
+		family, ok := families[name]
+		if !ok {
+			family = &metricFamily{kind: kind}
+			families[name] = family
+		}
+		family.samples = append(family.samples, sample)
+	}
+
+	registry.Each(func(key string, metric interface{}) {
+		name, labels := parseMetricKey(key)
+
+		switch m := metric.(type) {
+		case metrics.Counter:
+			add(name+"_total", "counter", formatSample(name+"_total", labels, float64(m.Count())))
+		case metrics.Meter:
+			add(name+"_total", "counter", formatSample(name+"_total", labels, float64(m.Count())))
+		case metrics.Gauge:
+			add(name, "gauge", formatSample(name, labels, float64(m.Value())))
+		case metrics.GaugeFloat64:
+			add(name, "gauge", formatSample(name, labels, m.Value()))
+		case *BucketHistogram:
+			bounds, cumulative, count, sum := m.snapshot()
+			for i, bound := range bounds {
+				add(name, "histogram", formatSample(name+"_bucket", withLabel(labels, "le", formatFloat(bound)), float64(cumulative[i])))
+			}
+			add(name, "histogram", formatSample(name+"_bucket", withLabel(labels, "le", "+Inf"), float64(count)))
+			add(name, "histogram", formatSample(name+"_sum", labels, sum))
+			add(name, "histogram", formatSample(name+"_count", labels, float64(count)))
+		case metrics.Histogram:
+			addSummary(add, name, labels, m.Snapshot(), 1)
+		case metrics.Timer:
+			addSummary(add, name, labels, m.Snapshot(), float64(time.Second))
+		}
+	})
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := families[name]
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, family.kind); err != nil {
+			return err
+		}
+		if family.kind == "counter" || family.kind == "gauge" {
+			sort.Strings(family.samples)
+		}
+		for _, sample := range family.samples {
+			if _, err := io.WriteString(w, sample); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// summarySnapshot is the part of a go-metrics histogram or timer snapshot exported as a summary.
+type summarySnapshot interface {
+	Count() int64
+	Sum() int64
+	Percentiles([]float64) []float64
+}
+
+// addSummary adds the quantiles, sum and count of a histogram or timer, divided by scale.
+func addSummary(add func(name, kind, sample string), name string, labels [][2]string, snapshot summarySnapshot, scale float64) {
+	quantiles := []float64{0.5, 0.9, 0.99}
+	for i, value := range snapshot.Percentiles(quantiles) {
+		add(name, "summary", formatSample(name, withLabel(labels, "quantile", formatFloat(quantiles[i])), value/scale))
+	}
+	add(name, "summary", formatSample(name+"_sum", labels, float64(snapshot.Sum())/scale))
+	add(name, "summary", formatSample(name+"_count", labels, float64(snapshot.Count())))
+}
+
+// parseMetricKey returns the Prometheus name and the labels of a metric key such as
+// github.rate.limit[installation:123].
+func parseMetricKey(key string) (string, [][2]string) {
+	name, rest, _ := strings.Cut(key, "[")
+
+	var labels [][2]string
+	for _, pair := range strings.Split(strings.TrimSuffix(rest, "]"), ",") {
+		label, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			continue
+		}
+		labels = append(labels, [2]string{sanitizeMetricName(label), value})
+	}
+	return sanitizeMetricName(name), labels
+}
+
+// sanitizeMetricName replaces the characters that aren't allowed in Prometheus names with underscores.
+func sanitizeMetricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// withLabel returns the labels with another label added.
+func withLabel(labels [][2]string, name, value string) [][2]string {
+	return append(append([][2]string{}, labels...), [2]string{name, value})
+}
+
+// labelValueEscaper escapes label values for the Prometheus text format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatSample returns a line of the Prometheus text format.
+func formatSample(name string, labels [][2]string, value float64) string {
+	var sample strings.Builder
+	sample.WriteString(name)
+	if len(labels) > 0 {
+		sample.WriteString("{")
+		for i, label := range labels {
+			if i > 0 {
+				sample.WriteString(",")
+			}
+			sample.WriteString(label[0] + `="` + labelValueEscaper.Replace(label[1]) + `"`)
+		}
+		sample.WriteString("}")
+	}
+	sample.WriteString(" " + formatFloat(value) + "\n")
+	return sample.String()
+}
+
+// formatFloat formats a value as Prometheus expects it.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,84 @@
+package reporulesetbot
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricKey(t *testing.T) {
+	assert.Equal(t, "events.handled", metricKey("events.handled"))
+	assert.Equal(t, "events.handled[type:release,action:released]", metricKey("events.handled", "type", "release", "action", "released"))
+
+	name, labels := parseMetricKey("github.rate.limit[installation:123]")
+	assert.Equal(t, "github_rate_limit", name)
+	assert.Equal(t, [][2]string{{"installation", "123"}}, labels)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("github.requests", registry).Inc(3)
+	metrics.GetOrRegisterGauge("github.rate.remaining[installation:1]", registry).Update(4999)
+	metrics.GetOrRegisterCounter(`rulesets.actions[action:say "hi"]`, registry).Inc(1)
+
+	histogram := NewBucketHistogram([]float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+	assert.NoError(t, registry.Register("events.latency.seconds[type:release]", histogram))
+
+	var out bytes.Buffer
+	assert.NoError(t, WritePrometheus(&out, registry))
+	assert.Equal(t, `# TYPE events_latency_seconds histogram
+events_latency_seconds_bucket{type="release",le="0.1"} 1
+events_latency_seconds_bucket{type="release",le="1"} 2
+events_latency_seconds_bucket{type="release",le="+Inf"} 3
+events_latency_seconds_sum{type="release"} 5.55
+events_latency_seconds_count{type="release"} 3
+# TYPE github_rate_remaining gauge
+github_rate_remaining{installation="1"} 4999
+# TYPE github_requests_total counter
+github_requests_total 3
+# TYPE rulesets_actions_total counter
+rulesets_actions_total{action="say \"hi\""} 1
+`, out.String())
+}
+
+func TestMetricsHandler(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("github.requests", registry).Inc(1)
+
+	rec := httptest.NewRecorder()
+	NewMetricsHandler(registry).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, MetricsRoute, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), "github_requests_total 1")
+}
+
+func TestRecordEvent(t *testing.T) {
+	registry := metrics.NewRegistry()
+	h := &RulesetHandler{Metrics: registry}
+
+	h.recordEvent(EventTypeRelease, ActionReleased, 2*time.Second, nil)
+	h.recordEvent(EventTypeRelease, ActionReleased, time.Second, errors.New("Failed"))
+	h.audit(context.Background(), AuditEntry{Action: AuditActionRevert}, zerolog.Nop())
+
+	assert.Equal(t, int64(2), registry.Get("events.handled[type:release,action:released]").(metrics.Counter).Count())
+	assert.Equal(t, int64(1), registry.Get("events.failed[type:release,action:released]").(metrics.Counter).Count())
+	assert.Equal(t, int64(1), registry.Get("rulesets.actions[action:revert]").(metrics.Counter).Count())
+
+	_, _, count, sum := registry.Get("events.latency.seconds[type:release]").(*BucketHistogram).snapshot()
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, 3.0, sum)
+
+	assert.Equal(t, "released", eventAction([]byte(`{"action": "released"}`)))
+	assert.Equal(t, "", eventAction([]byte(`not json`)))
+}
@@ -0,0 +1,366 @@
+package reporulesetbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Constants for the kinds of notifications.
+const (
+	NotificationRevert   = "revert"
+	NotificationRecreate = "recreate"
+	NotificationFailure  = "failure"
+	NotificationAlert    = "alert"
+	NotificationConflict = "conflict"
+)
+
+// notificationTimeout is the timeout for delivering a notification to a single channel.
+const notificationTimeout = 10 * time.Second
+
+// defaultNotificationQueueSize is how many notifications can wait to be sent when not configured.
+const defaultNotificationQueueSize = 100
+
+// NotificationsConfig represents the configuration of the notification channels.
+type NotificationsConfig struct {
+	Webhooks  []string                `yaml:"webhooks"`
+	Slack     []string                `yaml:"slack"`
+	Issue     IssueNotificationConfig `yaml:"issue"`
+	QueueSize int                     `yaml:"queue_size"`
+}
+
+// IssueNotificationConfig represents the configuration of notifications opened as issues.
+type IssueNotificationConfig struct {
+	Repository string   `yaml:"repository"`
+	Labels     []string `yaml:"labels"`
+}
+
+// Notification represents something that happened to a managed ruleset that people should know about.
+type Notification struct {
+	Kind       string        `json:"kind"`
+	Time       time.Time     `json:"time"`
+	DeliveryID string        `json:"delivery_id,omitempty"`
+	Org        string        `json:"org"`
+	Ruleset    string        `json:"ruleset,omitempty"`
+	Sender     string        `json:"sender,omitempty"`
+	Summary    string        `json:"summary"`
+	Changes    []FieldChange `json:"changes,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Title returns a one line description of the notification.
+func (n Notification) Title() string {
+	switch n.Kind {
+	case NotificationRevert:
+		return fmt.Sprintf("Ruleset %s in %s was edited by %s and has been reverted", n.Ruleset, n.Org, n.Sender)
+	case NotificationRecreate:
+		return fmt.Sprintf("Ruleset %s in %s was deleted by %s and has been recreated", n.Ruleset, n.Org, n.Sender)
+	case NotificationAlert:
+		return fmt.Sprintf("Ruleset %s in %s was changed by %s and has not been reverted", n.Ruleset, n.Org, n.Sender)
+	case NotificationConflict:
+		return fmt.Sprintf("Ruleset %s created in %s by %s conflicts with a managed ruleset", n.Ruleset, n.Org, n.Sender)
+	default:
+		if n.Ruleset == "" {
+			return fmt.Sprintf("Failed to reconcile the rulesets in %s", n.Org)
+		}
+		return fmt.Sprintf("Failed to reconcile ruleset %s in %s", n.Ruleset, n.Org)
+	}
+}
+
+// Text returns a plain text description of the notification.
+func (n Notification) Text() string {
+	var b strings.Builder
+	b.WriteString(n.Title())
+	b.WriteString(".")
+	if n.Summary != "" {
+		b.WriteString("\n")
+		b.WriteString(n.Summary)
+	}
+	if n.Error != "" {
+		b.WriteString("\nError: ")
+		b.WriteString(n.Error)
+	}
+	return b.String()
+}
+
+// Notifier delivers notifications to a channel.
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// MultiNotifier delivers notifications to every one of its notifiers.
+type MultiNotifier []Notifier
+
+// Notify delivers the notification to every notifier, even when some of them fail.
+func (m MultiNotifier) Notify(ctx context.Context, notification Notification) error {
+	var failed []string
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, notification); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("Failed to deliver notification: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// NewNotifier returns a notifier for every channel in the configuration.
+func NewNotifier(config NotificationsConfig, cc githubapp.ClientCreator) Notifier {
+	var notifiers MultiNotifier
+	for _, url := range config.Webhooks {
+		notifiers = append(notifiers, NewWebhookNotifier(url))
+	}
+	for _, url := range config.Slack {
+		notifiers = append(notifiers, NewSlackNotifier(url))
+	}
+	if config.Issue.Repository != "" {
+		notifiers = append(notifiers, NewIssueNotifier(config.Issue.Repository, config.Issue.Labels, cc))
+	}
+	return notifiers
+}
+
+// QueuedNotifier sends notifications in the background, so handling a webhook event doesn't wait for the notification
+// channels. Notifications that don't fit in its bounded queue are dropped.
+type QueuedNotifier struct {
+	next   Notifier
+	queue  chan queuedNotification
+	done   chan struct{}
+	logger zerolog.Logger
+}
+
+// queuedNotification is a notification waiting in the queue of a QueuedNotifier.
+type queuedNotification struct {
+	ctx          context.Context
+	notification Notification
+}
+
+// NewQueuedNotifier returns a notifier that queues up to size notifications and sends them to next from a single
+// worker, logging the ones that fail. Without a size, the queue holds 100 notifications.
+func NewQueuedNotifier(next Notifier, size int, logger zerolog.Logger) *QueuedNotifier {
+	if size <= 0 {
+		size = defaultNotificationQueueSize
+	}
+
+	q := &QueuedNotifier{
+		next:   next,
+		queue:  make(chan queuedNotification, size),
+		done:   make(chan struct{}),
+		logger: logger,
+	}
+	go q.run()
+	return q
+}
+
+// Notify queues the notification. It returns an error when the queue is full and the notification is dropped.
+func (q *QueuedNotifier) Notify(ctx context.Context, notification Notification) error {
+	select {
+	case q.queue <- queuedNotification{ctx: context.WithoutCancel(ctx), notification: notification}:
+		return nil
+	default:
+		return errors.Errorf("Notification queue is full, dropped the %s notification", notification.Kind)
+	}
+}
+
+// Close sends the notifications left in the queue and stops the worker. Notify must not be called after Close.
+func (q *QueuedNotifier) Close() {
+	close(q.queue)
+	<-q.done
+}
+
+// run sends the queued notifications until the queue is closed.
+func (q *QueuedNotifier) run() {
+	defer close(q.done)
+	for queued := range q.queue {
+		if err := q.next.Notify(queued.ctx, queued.notification); err != nil {
+			q.logger.Error().Err(err).Str(LogFieldOrg, queued.notification.Org).Msgf("Failed to send the %s notification for the organization %s.", queued.notification.Kind, queued.notification.Org)
+		}
+	}
+}
+
+// WebhookNotifier posts notifications as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier that posts notifications as JSON to the URL.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: notificationTimeout}}
+}
+
+// Notify posts the notification as JSON.
+func (w *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	return postJSON(ctx, w.Client, w.URL, notification)
+}
+
+// SlackNotifier posts notifications to a Slack compatible incoming webhook.
+type SlackNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewSlackNotifier returns a notifier that posts notifications to a Slack compatible incoming webhook.
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{URL: url, Client: &http.Client{Timeout: notificationTimeout}}
+}
+
+// Notify posts the notification as a Slack message.
+func (s *SlackNotifier) Notify(ctx context.Context, notification Notification) error {
+	return postJSON(ctx, s.Client, s.URL, map[string]string{"text": notification.Text()})
+}
+
+// postJSON posts a value as JSON to a URL.
+func postJSON(ctx context.Context, client *http.Client, url string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal notification")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "Failed to create notification request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Failed to send notification")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Errorf("Notification endpoint responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// IssueNotifier opens an issue in a repository for every notification.
+type IssueNotifier struct {
+	Repository string
+	Labels     []string
+
+	clientForOrg func(ctx context.Context, orgName string) (*github.Client, error)
+}
+
+// NewIssueNotifier returns a notifier that opens issues in the repository, in the form owner/repo, using the
+// installation of the app in the owner's account.
+func NewIssueNotifier(repository string, labels []string, cc githubapp.ClientCreator) *IssueNotifier {
+	return &IssueNotifier{
+		Repository: repository,
+		Labels:     labels,
+		clientForOrg: func(ctx context.Context, orgName string) (*github.Client, error) {
+			jwtclient, err := newJWTClient()
+			if err != nil {
+				return nil, errors.Wrap(err, "Failed to create JWT client")
+			}
+			installationID, err := getOrgAppInstallationID(ctx, jwtclient, orgName)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to get installation ID for the org %s", orgName)
+			}
+			return cc.NewInstallationClient(installationID)
+		},
+	}
+}
+
+// Notify opens an issue describing the notification.
+func (i *IssueNotifier) Notify(ctx context.Context, notification Notification) error {
+	owner, repo, ok := strings.Cut(i.Repository, "/")
+	if !ok {
+		return errors.Errorf("Invalid notification repository %s, expected owner/repo", i.Repository)
+	}
+
+	client, err := i.clientForOrg(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	issue := &github.IssueRequest{
+		Title: github.String(notification.Title()),
+		Body:  github.String(issueBody(notification)),
+	}
+	if len(i.Labels) > 0 {
+		issue.Labels = &i.Labels
+	}
+
+	if _, _, err := client.Issues.Create(ctx, owner, repo, issue); err != nil {
+		return errors.Wrapf(err, "Failed to open issue in %s", i.Repository)
+	}
+	return nil
+}
+
+// issueBody returns the markdown body of an issue describing the notification.
+func issueBody(notification Notification) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s.\n\n", notification.Title())
+	fmt.Fprintf(&b, "- **Organization:** %s\n", notification.Org)
+	if notification.Ruleset != "" {
+		fmt.Fprintf(&b, "- **Ruleset:** %s\n", notification.Ruleset)
+	}
+	if notification.Sender != "" {
+		fmt.Fprintf(&b, "- **Changed by:** @%s\n", notification.Sender)
+	}
+	if notification.DeliveryID != "" {
+		fmt.Fprintf(&b, "- **Delivery:** %s\n", notification.DeliveryID)
+	}
+	if notification.Error != "" {
+		fmt.Fprintf(&b, "\n**Error:** %s\n", notification.Error)
+	}
+	if len(notification.Changes) > 0 {
+		b.WriteString("\n| Field | Changed from | Changed to |\n| --- | --- | --- |\n")
+		for _, change := range notification.Changes {
+			fmt.Fprintf(&b, "| `%s` | `%s` | `%s` |\n", change.Path, formatValue(change.From), formatValue(change.To))
+		}
+	}
+	return b.String()
+}
+
+// invertChanges returns the changes in the opposite direction. The app computes the changes needed to go from the
+// live ruleset back to the configuration, while notifications describe what the sender changed.
+func invertChanges(changes []FieldChange) []FieldChange {
+	inverted := make([]FieldChange, 0, len(changes))
+	for _, change := range changes {
+		inverted = append(inverted, FieldChange{Path: change.Path, From: change.To, To: change.From})
+	}
+	return inverted
+}
+
+// notify delivers a notification, filling in the time, delivery ID and sender from the context when they aren't set.
+// Failures are logged and don't fail the event.
+func (h *RulesetHandler) notify(ctx context.Context, notification Notification, logger zerolog.Logger) {
+	if h.Notifier == nil {
+		return
+	}
+
+	info := eventInfoFromContext(ctx)
+	if notification.Time.IsZero() {
+		notification.Time = time.Now().UTC()
+	}
+	if notification.DeliveryID == "" {
+		notification.DeliveryID = info.DeliveryID
+	}
+	if notification.Sender == "" {
+		notification.Sender = info.Sender
+	}
+	if notification.Summary == "" && len(notification.Changes) > 0 {
+		notification.Summary = "Changes: " + summarizeChanges(notification.Changes)
+	}
+
+	if err := h.Notifier.Notify(ctx, notification); err != nil {
+		logger.Error().Err(err).Msgf("Failed to send the %s notification for the organization %s.", notification.Kind, notification.Org)
+	}
+}
+
+// notifyFailure delivers a notification that reconciling a ruleset failed.
+func (h *RulesetHandler) notifyFailure(ctx context.Context, orgName, rulesetName string, err error, logger zerolog.Logger) {
+	h.notify(ctx, Notification{Kind: NotificationFailure, Org: orgName, Ruleset: rulesetName, Error: err.Error()}, logger)
+}
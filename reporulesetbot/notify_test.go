@@ -0,0 +1,164 @@
+package reporulesetbot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingNotifier is a Notifier that keeps the notifications in memory.
+type recordingNotifier struct {
+	notifications []Notification
+	err           error
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, notification Notification) error {
+	r.notifications = append(r.notifications, notification)
+	return r.err
+}
+
+var testNotification = Notification{
+	Kind:    NotificationRevert,
+	Org:     "test-org",
+	Ruleset: "Default Ruleset",
+	Sender:  "octocat",
+	Changes: []FieldChange{{Path: "enforcement", From: "active", To: "disabled"}},
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), testNotification)
+	assert.NoError(t, err)
+	assert.Equal(t, testNotification.Org, received.Org)
+	assert.Equal(t, testNotification.Changes[0].Path, received.Changes[0].Path)
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	err := NewSlackNotifier(server.URL).Notify(context.Background(), testNotification)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ruleset Default Ruleset in test-org was edited by octocat and has been reverted.", received["text"])
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), testNotification)
+	assert.EqualError(t, err, "Notification endpoint responded with status 500")
+}
+
+func TestMultiNotifier(t *testing.T) {
+	failing := &recordingNotifier{err: assert.AnError}
+	working := &recordingNotifier{}
+
+	err := MultiNotifier{failing, working}.Notify(context.Background(), testNotification)
+	assert.Error(t, err)
+	assert.Len(t, working.notifications, 1)
+}
+
+func TestQueuedNotifier(t *testing.T) {
+	recorder := &recordingNotifier{}
+	notifier := NewQueuedNotifier(recorder, 0, zerolog.Nop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, notifier.Notify(ctx, testNotification))
+	// The notification is still sent after the event that queued it is done.
+	cancel()
+	notifier.Close()
+
+	assert.Equal(t, []Notification{testNotification}, recorder.notifications)
+}
+
+// blockingNotifier is a Notifier that waits until it is released.
+type blockingNotifier struct {
+	release chan struct{}
+}
+
+func (b *blockingNotifier) Notify(ctx context.Context, notification Notification) error {
+	<-b.release
+	return nil
+}
+
+func TestQueuedNotifier_Full(t *testing.T) {
+	blocking := &blockingNotifier{release: make(chan struct{})}
+	notifier := NewQueuedNotifier(blocking, 1, zerolog.Nop())
+
+	// The first notification may already be taken by the worker, so the queue is full after at most three.
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = notifier.Notify(context.Background(), testNotification)
+	}
+	assert.EqualError(t, err, "Notification queue is full, dropped the revert notification")
+
+	close(blocking.release)
+	notifier.Close()
+}
+
+func TestIssueNotifier(t *testing.T) {
+	var received github.IssueRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/security/alerts/issues", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"number": 1}`))
+	}))
+	defer server.Close()
+
+	notifier := &IssueNotifier{
+		Repository: "security/alerts",
+		Labels:     []string{"ruleset-drift"},
+		clientForOrg: func(ctx context.Context, orgName string) (*github.Client, error) {
+			assert.Equal(t, "security", orgName)
+			client := github.NewClient(nil)
+			client.BaseURL, _ = url.Parse(server.URL + "/")
+			return client, nil
+		},
+	}
+
+	err := notifier.Notify(context.Background(), testNotification)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ruleset Default Ruleset in test-org was edited by octocat and has been reverted", received.GetTitle())
+	assert.Contains(t, received.GetBody(), "| `enforcement` | `\"active\"` | `\"disabled\"` |")
+	assert.Equal(t, []string{"ruleset-drift"}, *received.Labels)
+
+	notifier.Repository = "invalid"
+	assert.Error(t, notifier.Notify(context.Background(), testNotification))
+}
+
+func TestHandlerNotify(t *testing.T) {
+	notifier := &recordingNotifier{}
+	handler := &RulesetHandler{Notifier: notifier}
+
+	ctx := withEventInfo(context.Background(), eventInfo{DeliveryID: "test-delivery-id"})
+	ctx = withEventSender(ctx, "octocat")
+
+	changes := []FieldChange{{Path: "enforcement", From: "disabled", To: "active"}}
+	handler.notify(ctx, Notification{Kind: NotificationRevert, Org: "test-org", Ruleset: "Default Ruleset", Changes: invertChanges(changes)}, zerolog.Nop())
+
+	assert.Len(t, notifier.notifications, 1)
+	notification := notifier.notifications[0]
+	assert.Equal(t, "test-delivery-id", notification.DeliveryID)
+	assert.Equal(t, "octocat", notification.Sender)
+	assert.Equal(t, `Changes: enforcement: "active" -> "disabled"`, notification.Summary)
+}
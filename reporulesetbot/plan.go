@@ -0,0 +1,235 @@
+package reporulesetbot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// PlannedChange represents a change the app is going to make to a ruleset in an organization. The action is one of
+// the audit log actions.
+type PlannedChange struct {
+	Action    string        `json:"action"`
+	Ruleset   string        `json:"ruleset"`
+	RulesetID int64         `json:"ruleset_id,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+	Diff      []FieldChange `json:"diff,omitempty"`
+
+	desired *DesiredRuleset
+	target  *github.Ruleset
+}
+
+// String returns a one line description of the change.
+func (c PlannedChange) String() string {
+	description := fmt.Sprintf("%s %s", c.Action, c.Ruleset)
+	if c.RulesetID != 0 {
+		description += fmt.Sprintf(" (ID %d)", c.RulesetID)
+	}
+	if c.Reason != "" {
+		description += ": " + c.Reason
+	}
+	if len(c.Diff) > 0 {
+		description += ": " + summarizeChanges(c.Diff)
+	}
+	return description
+}
+
+// Plan represents the changes that bring the rulesets in an organization in line with the configuration.
+type Plan struct {
+	Org     string          `json:"org"`
+	Changes []PlannedChange `json:"changes"`
+
+	// missing are the managed rulesets that no longer exist in the organization and only need to be untracked.
+	missing []ManagedRuleset
+}
+
+// Count returns the number of planned changes with the given action.
+func (p *Plan) Count(action string) int {
+	count := 0
+	for _, change := range p.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// log writes a summary of the plan and every change it makes to the logger.
+func (p *Plan) log(logger zerolog.Logger) {
+	logger.Info().Msgf("Plan for the organization %s: %d to create, %d to update, %d unchanged, %d to delete, %d to disable.",
+		p.Org, p.Count(AuditActionCreate), p.Count(AuditActionUpdate), p.Count(AuditActionSkip), p.Count(AuditActionDelete), p.Count(AuditActionDisable))
+	for _, change := range p.Changes {
+		if change.Action != AuditActionSkip {
+			logger.Info().Msgf("Planned change in the organization %s: %s.", p.Org, change)
+		}
+	}
+}
+
+// planOrganization returns the changes that bring the rulesets in an organization in line with the configuration.
+func (h *RulesetHandler) planOrganization(ctx context.Context, client *github.Client, orgName, releaseTag string, logger zerolog.Logger) (_ *Plan, err error) {
+	ctx, span := h.startSpan(ctx, "plan organization", AttributeOrg.String(orgName), AttributeRelease.String(releaseTag))
+	defer func() { endSpan(span, err) }()
+
+	rulesets, err := h.getRulesets(ctx, client, orgName, releaseTag, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read rulesets from file")
+	}
+
+	logger.Info().Msgf("Found %d rulesets configured.", len(rulesets))
+
+	orgRulesets, err := getOrgRulesets(ctx, client, orgName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get organization rulesets")
+	}
+
+	managed, err := h.tracker().ManagedRulesets(orgName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get managed rulesets for organization %s", orgName)
+	}
+
+	plan := &Plan{Org: orgName}
+	var present []ManagedRuleset
+	for _, tracked := range managed {
+		if hasRulesetID(orgRulesets, tracked.ID) {
+			present = append(present, tracked)
+		} else {
+			plan.missing = append(plan.missing, tracked)
+		}
+	}
+
+	for _, ruleset := range rulesets {
+		if orgRuleset := findOrgRuleset(ruleset, orgRulesets, managed); orgRuleset != nil {
+			change, err := h.planRulesetUpdate(ctx, client, orgName, orgRuleset.GetID(), ruleset, logger)
+			if err != nil {
+				return nil, err
+			}
+			plan.Changes = append(plan.Changes, change)
+			continue
+		}
+
+		changes, err := diffRulesets(nil, ruleset.Ruleset)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to compare ruleset %s in organization %s", ruleset.Name, orgName)
+		}
+		plan.Changes = append(plan.Changes, PlannedChange{Action: AuditActionCreate, Ruleset: ruleset.Name, Diff: changes, desired: ruleset, target: ruleset.Ruleset})
+	}
+
+	plan.Changes = append(plan.Changes, h.planRemovals(orgName, rulesets, present, logger)...)
+	return plan, nil
+}
+
+// rulesetPlanError is returned when the live state of a ruleset can't be read while planning. Planning has no side
+// effects, so the sync records the error of the ruleset.
+type rulesetPlanError struct {
+	ruleset *DesiredRuleset
+	err     error
+}
+
+// Error implements error.
+func (e *rulesetPlanError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error reading the ruleset.
+func (e *rulesetPlanError) Unwrap() error {
+	return e.err
+}
+
+// planRulesetUpdate returns the change that brings an organization ruleset in line with the desired ruleset.
+func (h *RulesetHandler) planRulesetUpdate(ctx context.Context, client *github.Client, orgName string, rulesetID int64, ruleset *DesiredRuleset, logger zerolog.Logger) (PlannedChange, error) {
+	orgRuleset, err := getOrgRuleset(ctx, client, orgName, rulesetID)
+	if err != nil {
+		return PlannedChange{}, &rulesetPlanError{ruleset: ruleset, err: err}
+	}
+
+	target, changes, err := reconcileRuleset(h.rulesetPolicy(ruleset.Name), orgRuleset, ruleset)
+	if err != nil {
+		return PlannedChange{}, errors.Wrapf(err, "Failed to compare ruleset %s in organization %s", ruleset.Name, orgName)
+	}
+
+	target, changes, exemptions, err := h.applyExemptions(orgName, ruleset.Name, orgRuleset, target, changes, logger)
+	if err != nil {
+		return PlannedChange{}, errors.Wrapf(err, "Failed to apply the exemptions for ruleset %s in organization %s", ruleset.Name, orgName)
+	}
+
+	change := PlannedChange{Action: AuditActionUpdate, Ruleset: ruleset.Name, RulesetID: rulesetID, Diff: changes, desired: ruleset, target: target}
+	if len(changes) == 0 {
+		change.Action = AuditActionSkip
+		change.Reason = "Ruleset already matches the configuration"
+		if len(exemptions) > 0 {
+			change.Reason = describeExemptions(exemptions)
+		}
+	}
+	return change, nil
+}
+
+// recordPlanError records the error of a ruleset that couldn't be planned while syncing an organization.
+func (h *RulesetHandler) recordPlanError(ctx context.Context, orgName, releaseTag string, err error, logger zerolog.Logger) {
+	var planErr *rulesetPlanError
+	if errors.As(err, &planErr) {
+		h.recordRulesetSync(ctx, orgName, planErr.ruleset, releaseTag, planErr.err, logger)
+	}
+}
+
+// applyPlan makes the planned changes in the organization, stopping at the first one that fails.
+func (h *RulesetHandler) applyPlan(ctx context.Context, client *github.Client, plan *Plan, releaseTag string, logger zerolog.Logger) error {
+	for _, tracked := range plan.missing {
+		logger.Info().Msgf("Managed ruleset %s with ID %d no longer exists in the organization %s.", tracked.Name, tracked.ID, plan.Org)
+		if err := h.tracker().UntrackRuleset(plan.Org, tracked.ID); err != nil {
+			return errors.Wrapf(err, "Failed to untrack ruleset %s in organization %s", tracked.Name, plan.Org)
+		}
+	}
+
+	for _, change := range plan.Changes {
+		if err := h.applyChange(ctx, client, plan.Org, change, releaseTag, rulesetLogger(logger, change.Ruleset)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyChange makes a planned change in the organization and records it.
+func (h *RulesetHandler) applyChange(ctx context.Context, client *github.Client, orgName string, change PlannedChange, releaseTag string, logger zerolog.Logger) (err error) {
+	ctx, span := h.startSpan(ctx, "apply change",
+		AttributeOrg.String(orgName),
+		AttributeRuleset.String(change.Ruleset),
+		AttributeRulesetAction.String(change.Action),
+	)
+	defer func() { endSpan(span, err) }()
+
+	switch change.Action {
+	case AuditActionCreate:
+		logger.Info().Msgf("Creating ruleset %s in organization %s.", change.Ruleset, orgName)
+		created, err := createRuleset(ctx, client, orgName, change.target, logger)
+		h.recordRulesetSync(ctx, orgName, change.desired, releaseTag, err, logger)
+		if err != nil {
+			return err
+		}
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: change.Ruleset, RulesetID: created.GetID(), Action: AuditActionCreate, Diff: change.Diff}, logger)
+		return h.trackRuleset(orgName, created.GetID(), change.desired)
+
+	case AuditActionUpdate:
+		err := editRuleset(ctx, client, orgName, change.RulesetID, change.target, logger)
+		h.recordRulesetSync(ctx, orgName, change.desired, releaseTag, err, logger)
+		if err != nil {
+			return err
+		}
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: change.Ruleset, RulesetID: change.RulesetID, Action: AuditActionUpdate, Diff: change.Diff}, logger)
+		return h.trackRuleset(orgName, change.RulesetID, change.desired)
+
+	case AuditActionSkip:
+		logger.Info().Msgf("Ruleset %s in the organization %s is already up to date.", change.Ruleset, orgName)
+		h.recordRulesetSync(ctx, orgName, change.desired, releaseTag, nil, logger)
+		h.audit(ctx, AuditEntry{Org: orgName, Ruleset: change.Ruleset, RulesetID: change.RulesetID, Action: AuditActionSkip, Reason: change.Reason}, logger)
+		return h.trackRuleset(orgName, change.RulesetID, change.desired)
+
+	case AuditActionDelete, AuditActionDisable:
+		return h.removeRuleset(ctx, client, orgName, change, logger)
+
+	default:
+		return errors.Errorf("Unknown planned action %s for ruleset %s in organization %s", change.Action, change.Ruleset, orgName)
+	}
+}
@@ -0,0 +1,80 @@
+package reporulesetbot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlannedChangeString(t *testing.T) {
+	assert.Equal(t, "create Default Ruleset", PlannedChange{Action: AuditActionCreate, Ruleset: "Default Ruleset"}.String())
+	assert.Equal(t, "update Default Ruleset (ID 42): enforcement: \"disabled\" -> \"active\"", PlannedChange{
+		Action:    AuditActionUpdate,
+		Ruleset:   "Default Ruleset",
+		RulesetID: 42,
+		Diff:      []FieldChange{{Path: "enforcement", From: "disabled", To: "active"}},
+	}.String())
+	assert.Equal(t, "delete Old Ruleset (ID 7): Ruleset was removed from the configuration", PlannedChange{
+		Action:    AuditActionDelete,
+		Ruleset:   "Old Ruleset",
+		RulesetID: 7,
+		Reason:    removedRulesetReason,
+	}.String())
+}
+
+func TestApplyPlan(t *testing.T) {
+	logger := zerolog.Nop()
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": 43, "name": "New Ruleset"}`))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	client.BaseURL = baseURL
+
+	tracker := NewMemoryRulesetTracker()
+	assert.NoError(t, tracker.TrackRuleset("test-org", ManagedRuleset{ID: 1, Name: "Gone Ruleset", File: "Gone Ruleset.json"}))
+
+	sink := &memoryAuditSink{}
+	h := &RulesetHandler{Tracker: tracker, Audit: sink}
+
+	existing := &DesiredRuleset{Ruleset: &github.Ruleset{Name: "Default Ruleset"}, File: "Default Ruleset.json"}
+	created := &DesiredRuleset{Ruleset: &github.Ruleset{Name: "New Ruleset"}, File: "New Ruleset.json"}
+	plan := &Plan{
+		Org: "test-org",
+		Changes: []PlannedChange{
+			{Action: AuditActionSkip, Ruleset: "Default Ruleset", RulesetID: 42, Reason: "Ruleset already matches the configuration", desired: existing, target: existing.Ruleset},
+			{Action: AuditActionCreate, Ruleset: "New Ruleset", desired: created, target: created.Ruleset},
+		},
+		missing: []ManagedRuleset{{ID: 1, Name: "Gone Ruleset", File: "Gone Ruleset.json"}},
+	}
+	assert.Equal(t, 1, plan.Count(AuditActionCreate))
+
+	assert.NoError(t, h.applyPlan(context.Background(), client, plan, "v1.0.0", logger))
+	assert.Equal(t, []string{"POST /orgs/test-org/rulesets"}, requests)
+
+	var actions []string
+	for _, entry := range sink.entries {
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{AuditActionSkip, AuditActionCreate}, actions)
+
+	managed, err := tracker.ManagedRulesets("test-org")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []ManagedRuleset{
+		{ID: 42, Name: "Default Ruleset", File: "Default Ruleset.json"},
+		{ID: 43, Name: "New Ruleset", File: "New Ruleset.json"},
+	}, managed)
+}
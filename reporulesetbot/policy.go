@@ -0,0 +1,60 @@
+package reporulesetbot
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Constants for the enforcement modes of a managed ruleset.
+const (
+	// ModeEnforce reverts every change to the ruleset.
+	ModeEnforce = "enforce"
+	// ModeAlert records and notifies about changes to the ruleset without reverting them.
+	ModeAlert = "alert"
+	// ModeIgnore deploys the ruleset on install and release but leaves changes alone.
+	ModeIgnore = "ignore"
+)
+
+// Constants for how a live ruleset is compared with the configuration.
+const (
+	// ComparisonExact reverts any difference from the configuration.
+	ComparisonExact = "exact"
+	// ComparisonAtLeastAsStrict only reverts differences that make the ruleset weaker than the configuration.
+	ComparisonAtLeastAsStrict = "at_least_as_strict"
+)
+
+// RulesetPolicy represents how the app polices a managed ruleset.
+type RulesetPolicy struct {
+	Mode       string `yaml:"mode"`
+	Comparison string `yaml:"comparison"`
+}
+
+// validate checks that the policy only uses known values.
+func (p RulesetPolicy) validate() error {
+	switch p.Mode {
+	case "", ModeEnforce, ModeAlert, ModeIgnore:
+	default:
+		return errors.Errorf("Unknown mode %s, expected one of %s, %s or %s", p.Mode, ModeEnforce, ModeAlert, ModeIgnore)
+	}
+
+	switch p.Comparison {
+	case "", ComparisonExact, ComparisonAtLeastAsStrict:
+		return nil
+	default:
+		return errors.Errorf("Unknown comparison %s, expected %s or %s", p.Comparison, ComparisonExact, ComparisonAtLeastAsStrict)
+	}
+}
+
+// rulesetPolicy returns the configured policy for a ruleset, with defaults filled in.
+func (h *RulesetHandler) rulesetPolicy(rulesetName string) RulesetPolicy {
+	var policy RulesetPolicy
+	if h.Config != nil {
+		policy = h.Config.Rulesets[rulesetName]
+	}
+	if policy.Mode == "" {
+		policy.Mode = ModeEnforce
+	}
+	if policy.Comparison == "" {
+		policy.Comparison = ComparisonExact
+	}
+	return policy
+}
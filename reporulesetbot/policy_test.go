@@ -0,0 +1,66 @@
+package reporulesetbot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRulesetPolicy_Validate(t *testing.T) {
+	for _, mode := range []string{"", ModeEnforce, ModeAlert, ModeIgnore} {
+		assert.NoError(t, RulesetPolicy{Mode: mode}.validate(), mode)
+	}
+	assert.Error(t, RulesetPolicy{Mode: "audit"}.validate())
+	assert.NoError(t, RulesetPolicy{Comparison: ComparisonAtLeastAsStrict}.validate())
+	assert.Error(t, RulesetPolicy{Comparison: "looser"}.validate())
+}
+
+func TestRulesetPolicy_Defaults(t *testing.T) {
+	h := &RulesetHandler{}
+	assert.Equal(t, RulesetPolicy{Mode: ModeEnforce, Comparison: ComparisonExact}, h.rulesetPolicy("Default Ruleset"))
+
+	h.Config = &Config{Rulesets: map[string]RulesetPolicy{
+		"Default Ruleset": {Mode: ModeAlert},
+		"Legacy Ruleset":  {},
+	}}
+	assert.Equal(t, ModeAlert, h.rulesetPolicy("Default Ruleset").Mode)
+	assert.Equal(t, ModeEnforce, h.rulesetPolicy("Legacy Ruleset").Mode)
+	assert.Equal(t, ModeEnforce, h.rulesetPolicy("Other Ruleset").Mode)
+}
+
+func TestReadConfig_RulesetPolicies(t *testing.T) {
+	dir := t.TempDir()
+
+	configContent := `
+server:
+  address: "127.0.0.1"
+  port: 8080
+github:
+  app:
+    integration_id: 12345
+    private_key: "some_private_key"
+    webhook_secret: "some_webhook_secret"
+  v3_api_url: "https://api.github.com"
+rulesets:
+  Default Ruleset:
+    mode: alert
+  Legacy Ruleset:
+    mode: ignore
+`
+	configPath := filepath.Join(dir, "config.yml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	config, err := ReadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, ModeAlert, config.Rulesets["Default Ruleset"].Mode)
+	assert.Equal(t, ModeIgnore, config.Rulesets["Legacy Ruleset"].Mode)
+
+	invalidPath := filepath.Join(dir, "invalid.yml")
+	assert.NoError(t, os.WriteFile(invalidPath, []byte(configContent+"  Other Ruleset:\n    mode: audit\n"), 0644))
+
+	config, err = ReadConfig(invalidPath)
+	assert.Error(t, err)
+	assert.Nil(t, config)
+}
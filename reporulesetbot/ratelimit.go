@@ -0,0 +1,322 @@
+package reporulesetbot
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Metric keys for retries and throttling of GitHub API calls.
+const (
+	MetricsKeyRetries          = "github.retries"
+	MetricsKeyRetriesExhausted = "github.retries.exhausted"
+	MetricsKeyThrottled        = "github.throttled"
+)
+
+// Default values for the rate limit configuration.
+const (
+	defaultMaxRetries   = 3
+	defaultBaseDelay    = 500 * time.Millisecond
+	defaultMaxDelay     = 30 * time.Second
+	defaultMinRemaining = 50
+	defaultTimeout      = 3 * time.Second
+)
+
+// RateLimitConfig represents the retry and throttling configuration for GitHub API calls. A negative number of
+// retries turns retries off, and a negative timeout lets attempts run for as long as the context of the call allows.
+type RateLimitConfig struct {
+	MaxRetries   int           `yaml:"max_retries"`
+	BaseDelay    time.Duration `yaml:"base_delay"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
+	MinRemaining int           `yaml:"min_remaining"`
+	Timeout      time.Duration `yaml:"timeout"`
+}
+
+// withDefaults returns a copy of the configuration with unset fields replaced by their defaults.
+func (c RateLimitConfig) withDefaults() RateLimitConfig {
+	switch {
+	case c.MaxRetries == 0:
+		c.MaxRetries = defaultMaxRetries
+	case c.MaxRetries < 0:
+		c.MaxRetries = 0
+	}
+	if c.BaseDelay == 0 {
+		c.BaseDelay = defaultBaseDelay
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = defaultMaxDelay
+	}
+	if c.MinRemaining == 0 {
+		c.MinRemaining = defaultMinRemaining
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	return c
+}
+
+// sleep waits for the given duration or until the context is done.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RateLimitMiddleware returns a client middleware that retries idempotent requests
+// that failed because of rate limits or server errors, and slows requests down
+// when the remaining rate limit budget is running low. The timeout applies to each
+// attempt, so waiting between attempts doesn't use up the time of the next one.
+func RateLimitMiddleware(config RateLimitConfig, registry metrics.Registry) githubapp.ClientMiddleware {
+	config = config.withDefaults()
+
+	for _, key := range []string{
+		MetricsKeyRetries,
+		MetricsKeyRetriesExhausted,
+		MetricsKeyThrottled,
+	} {
+		metrics.GetOrRegisterCounter(key, registry)
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &rateLimitTransport{
+			next:     next,
+			config:   config,
+			registry: registry,
+		}
+	}
+}
+
+// rateLimitTransport is the http.RoundTripper returned by RateLimitMiddleware.
+// The middleware creates a transport per installation client, and the JWT clients share one,
+// so the budget it tracks belongs to a single installation or to the app.
+type rateLimitTransport struct {
+	next     http.RoundTripper
+	config   RateLimitConfig
+	registry metrics.Registry
+
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	if err := t.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if t.config.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, t.config.Timeout)
+		}
+
+		attemptReq := req.WithContext(attemptCtx)
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			attemptReq = req.Clone(attemptCtx)
+			attemptReq.Body = body
+		}
+
+		res, err := t.next.RoundTrip(attemptReq)
+		if res != nil {
+			res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+			t.update(res.Header)
+		} else {
+			cancel()
+		}
+
+		if !isRetryableRequest(req) {
+			return res, err
+		}
+
+		delay, retry := t.retryDelay(ctx, res, err, attempt)
+		if !retry {
+			return res, err
+		}
+
+		if attempt >= t.config.MaxRetries {
+			t.registry.Get(MetricsKeyRetriesExhausted).(metrics.Counter).Inc(1)
+			return res, err
+		}
+
+		if res != nil {
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		t.registry.Get(MetricsKeyRetries).(metrics.Counter).Inc(1)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// throttle delays the request when the remaining rate limit budget is low. The
+// remaining budget is spread evenly across the time left until the limit resets.
+func (t *rateLimitTransport) throttle(ctx context.Context) error {
+	t.mu.Lock()
+	remaining, reset := t.remaining, t.reset
+	t.mu.Unlock()
+
+	if reset.IsZero() || remaining > t.config.MinRemaining {
+		return nil
+	}
+
+	untilReset := time.Until(reset)
+	if untilReset <= 0 {
+		return nil
+	}
+
+	delay := untilReset / time.Duration(remaining+1)
+	if delay > t.config.MaxDelay {
+		delay = t.config.MaxDelay
+	}
+
+	t.registry.Get(MetricsKeyThrottled).(metrics.Counter).Inc(1)
+	return sleep(ctx, delay)
+}
+
+// update records the rate limit budget from the response headers.
+func (t *rateLimitTransport) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remaining = remaining
+	t.reset = time.Unix(reset, 0)
+}
+
+// retryDelay returns how long to wait before retrying and whether the request should be retried at all.
+func (t *rateLimitTransport) retryDelay(ctx context.Context, res *http.Response, err error, attempt int) (time.Duration, bool) {
+	if err != nil {
+		if res == nil && isTransientError(ctx, err) {
+			return t.backoff(attempt), true
+		}
+		return 0, false
+	}
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+	case res.StatusCode == http.StatusForbidden && isRateLimitedResponse(res):
+	case res.StatusCode >= http.StatusInternalServerError && res.StatusCode != http.StatusNotImplemented:
+	default:
+		return 0, false
+	}
+
+	if delay, ok := headerDelay(res.Header); ok {
+		// Don't hold the event for longer than the configured maximum, the request fails instead.
+		if delay > t.config.MaxDelay {
+			return 0, false
+		}
+		return delay, true
+	}
+
+	return t.backoff(attempt), true
+}
+
+// backoff returns the exponential backoff delay for an attempt with full jitter.
+func (t *rateLimitTransport) backoff(attempt int) time.Duration {
+	delay := t.config.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > t.config.MaxDelay {
+		delay = t.config.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// headerDelay returns the delay requested by the Retry-After or X-RateLimit-Reset headers.
+func headerDelay(header http.Header) (time.Duration, bool) {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return time.Until(date), true
+		}
+	}
+
+	if header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Until(time.Unix(reset, 0)), true
+		}
+	}
+
+	return 0, false
+}
+
+// isRateLimitedResponse returns true if a 403 response was caused by a primary or secondary rate limit.
+func isRateLimitedResponse(res *http.Response) bool {
+	if res.Header.Get("Retry-After") != "" || res.Header.Get("X-RateLimit-Remaining") == "0" {
+		return true
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	message := strings.ToLower(string(body))
+	return strings.Contains(message, "secondary rate limit") || strings.Contains(message, "abuse")
+}
+
+// isRetryableRequest returns true if the request is idempotent and its body can be replayed.
+func isRetryableRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// isTransientError returns true if a transport error is worth retrying. An attempt that timed out is, unless the
+// context of the call is done too.
+func isTransientError(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !errors.Is(err, context.Canceled)
+}
+
+// cancelOnClose is a response body that releases the context of its attempt when it is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer.
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
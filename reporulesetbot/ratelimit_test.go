@@ -0,0 +1,276 @@
+package reporulesetbot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRateLimitTestClient returns an HTTP client using the rate limit middleware and records the requested sleeps.
+func newRateLimitTestClient(t *testing.T, registry metrics.Registry) (*http.Client, *[]time.Duration) {
+	var sleeps []time.Duration
+	originalSleep := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = originalSleep })
+
+	config := RateLimitConfig{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Minute}
+	transport := RateLimitMiddleware(config, registry)(http.DefaultTransport)
+	return &http.Client{Transport: transport}, &sleeps
+}
+
+func TestRateLimitConfig_WithDefaults(t *testing.T) {
+	config := RateLimitConfig{}.withDefaults()
+	assert.Equal(t, defaultMaxRetries, config.MaxRetries)
+	assert.Equal(t, defaultTimeout, config.Timeout)
+
+	config = RateLimitConfig{MaxRetries: -1, Timeout: -1}.withDefaults()
+	assert.Equal(t, 0, config.MaxRetries)
+	assert.Equal(t, time.Duration(-1), config.Timeout)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Run("retries server errors", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		client, _ := newRateLimitTestClient(t, registry)
+
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		res, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, int64(2), registry.Get(MetricsKeyRetries).(metrics.Counter).Count())
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		client, _ := newRateLimitTestClient(t, registry)
+
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		res, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, int64(1), registry.Get(MetricsKeyRetriesExhausted).(metrics.Counter).Count())
+	})
+
+	t.Run("honors Retry-After on secondary rate limits", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		client, sleeps := newRateLimitTestClient(t, registry)
+
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		res, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, []time.Duration{7 * time.Second}, *sleeps)
+	})
+
+	t.Run("detects abuse detection messages", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		client, _ := newRateLimitTestClient(t, registry)
+
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message": "You have exceeded a secondary rate limit."}`))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		res, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("does not retry permission errors", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		client, _ := newRateLimitTestClient(t, registry)
+
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message": "Resource not accessible by integration"}`))
+		}))
+		defer server.Close()
+
+		res, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("does not retry non-idempotent requests", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		client, _ := newRateLimitTestClient(t, registry)
+
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		res, err := client.Post(server.URL, "application/json", strings.NewReader(`{}`))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("replays the body of retried PUT requests", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		client, _ := newRateLimitTestClient(t, registry)
+
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			if len(bodies) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(`{"name":"ruleset"}`))
+		assert.NoError(t, err)
+
+		res, err := client.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, []string{`{"name":"ruleset"}`, `{"name":"ruleset"}`}, bodies)
+	})
+
+	t.Run("does not wait longer than the maximum delay", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		client, sleeps := newRateLimitTestClient(t, registry)
+
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		res, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		assert.Equal(t, 1, calls)
+		assert.Empty(t, *sleeps)
+	})
+
+	t.Run("throttles when the remaining budget is low", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		client, sleeps := newRateLimitTestClient(t, registry)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "9")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(10*time.Second).Unix(), 10))
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		_, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Empty(t, *sleeps)
+
+		_, err = client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Len(t, *sleeps, 1)
+		assert.InDelta(t, time.Second, (*sleeps)[0], float64(time.Second))
+		assert.Equal(t, int64(1), registry.Get(MetricsKeyThrottled).(metrics.Counter).Count())
+	})
+
+	t.Run("does not retry when retries are turned off", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		_, sleeps := newRateLimitTestClient(t, registry)
+		transport := RateLimitMiddleware(RateLimitConfig{MaxRetries: -1}, registry)(http.DefaultTransport)
+		client := &http.Client{Transport: transport}
+
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		res, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, 1, calls)
+		assert.Empty(t, *sleeps)
+	})
+
+	t.Run("times out each attempt on its own", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		newRateLimitTestClient(t, registry)
+		config := RateLimitConfig{MaxRetries: 2, BaseDelay: time.Millisecond, Timeout: 50 * time.Millisecond}
+		client := &http.Client{Transport: RateLimitMiddleware(config, registry)(http.DefaultTransport)}
+
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				<-r.Context().Done()
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		res, err := client.Get(server.URL)
+		if assert.NoError(t, err) {
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, "ok", string(body))
+		}
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, int64(1), registry.Get(MetricsKeyRetries).(metrics.Counter).Count())
+	})
+}
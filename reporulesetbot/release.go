@@ -0,0 +1,221 @@
+package reporulesetbot
+
+import (
+	"context"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// publishRelease rolls a published release out to every organization and makes it the current release.
+func (h *RulesetHandler) publishRelease(ctx context.Context, client *github.Client, owner, repo string, release *github.RepositoryRelease, installations []*github.Installation, logger zerolog.Logger) error {
+	tagName := release.GetTagName()
+
+	if _, err := h.loadBundle(ctx, client, owner, repo, release, logger); err != nil {
+		return err
+	}
+
+	if h.State != nil {
+		if err := h.State.SetRelease(tagName); err != nil {
+			return errors.Wrap(err, "Failed to record the release")
+		}
+	}
+
+	logger.Info().Msgf("Updating the rulesets...")
+	return h.rolloutRelease(ctx, tagName, installations, h.releaseWaves(), logger)
+}
+
+// publishPrerelease rolls a prerelease out to the canary organizations only. The current release is left unchanged.
+func (h *RulesetHandler) publishPrerelease(ctx context.Context, client *github.Client, owner, repo string, release *github.RepositoryRelease, installations []*github.Installation, logger zerolog.Logger) error {
+	tagName := release.GetTagName()
+
+	canaries := h.canaryOrgs()
+	if len(canaries) == 0 {
+		logger.Info().Msgf("No canary organizations are configured, prerelease %s is not deployed.", tagName)
+		return nil
+	}
+
+	if _, err := h.loadBundle(ctx, client, owner, repo, release, logger); err != nil {
+		return err
+	}
+
+	logger.Info().Msgf("Deploying prerelease %s to the canary organizations...", tagName)
+	return h.rolloutRelease(ctx, tagName, filterInstallations(installations, canaries), nil, logger)
+}
+
+// handleReleaseEdited re-deploys an edited release to the organizations that are on it, but only when its ruleset
+// assets changed. A current release that was turned into a prerelease is withdrawn.
+func (h *RulesetHandler) handleReleaseEdited(ctx context.Context, client *github.Client, owner, repo string, release *github.RepositoryRelease, installations []*github.Installation, logger zerolog.Logger) error {
+	tagName := release.GetTagName()
+
+	if release.GetPrerelease() && tagName == h.currentRelease() {
+		logger.Info().Msgf("Release %s was demoted to a prerelease.", tagName)
+		return h.withdrawRelease(ctx, client, owner, repo, tagName, installations, logger)
+	}
+
+	orgs := h.installationsOnRelease(tagName, installations)
+	if len(orgs) == 0 {
+		logger.Info().Msgf("No organization is on release %s, nothing to re-evaluate.", tagName)
+		return nil
+	}
+
+	previousHash := h.bundleHash(tagName)
+
+	bundle, err := downloadBundle(ctx, client, owner, repo, release)
+	if err != nil {
+		return err
+	}
+
+	hash := ""
+	if bundle != nil {
+		hash = bundle.hash()
+	}
+	if hash == previousHash {
+		logger.Info().Msgf("The ruleset assets of release %s did not change.", tagName)
+		return nil
+	}
+
+	h.cacheBundle(tagName, bundle, logger)
+
+	logger.Info().Msgf("The ruleset assets of release %s changed, updating %d organization(s)...", tagName, len(orgs))
+	return h.rolloutRelease(ctx, tagName, orgs, nil, logger)
+}
+
+// withdrawRelease rolls the organizations on a deleted or demoted release back. When it was the current release, every
+// organization on it goes back to the previous published release, which becomes the current release. When it was a
+// prerelease, the canary organizations go back to the current release.
+func (h *RulesetHandler) withdrawRelease(ctx context.Context, client *github.Client, owner, repo, tagName string, installations []*github.Installation, logger zerolog.Logger) error {
+	orgs := h.installationsOnRelease(tagName, installations)
+
+	target := h.currentRelease()
+	if tagName == target {
+		previous, err := previousRelease(ctx, client, owner, repo, tagName)
+		if err != nil {
+			return err
+		}
+		if previous == nil {
+			logger.Warn().Msgf("There is no earlier published release to roll back to, leaving release %s in place.", tagName)
+			return nil
+		}
+
+		target = previous.GetTagName()
+		if _, err := h.loadBundle(ctx, client, owner, repo, previous, logger); err != nil {
+			return err
+		}
+
+		if h.State != nil {
+			if err := h.State.SetRelease(target); err != nil {
+				return errors.Wrap(err, "Failed to record the release")
+			}
+		}
+	}
+
+	if len(orgs) == 0 {
+		logger.Info().Msgf("No organization is on release %s, nothing to roll back.", tagName)
+		return nil
+	}
+
+	logger.Info().Msgf("Rolling %d organization(s) back from release %s to %s...", len(orgs), tagName, target)
+	return h.rolloutRelease(ctx, target, orgs, nil, logger)
+}
+
+// rolloutRelease rolls a release out to the installations and records the report. A rollout in waves can take longer
+// than GitHub waits for the webhook, so it continues in the background.
+func (h *RulesetHandler) rolloutRelease(ctx context.Context, releaseTag string, installations []*github.Installation, waves []RolloutWave, logger zerolog.Logger) error {
+	h.recordSnapshot(ctx, releaseTag, logger)
+
+	if len(waves) > 0 {
+		go func() {
+			report := h.rollout(context.WithoutCancel(ctx), releaseTag, installations, waves, logger)
+			report.log(logger)
+			h.setLastRolloutReport(report)
+		}()
+		return nil
+	}
+
+	report := h.rollout(ctx, releaseTag, installations, nil, logger)
+	report.log(logger)
+	h.setLastRolloutReport(report)
+
+	return report.Err()
+}
+
+// previousRelease returns the most recent published release other than the given one, or nil if there is none.
+func previousRelease(ctx context.Context, client *github.Client, owner, repo, tagName string) (*github.RepositoryRelease, error) {
+	var releases []*github.RepositoryRelease
+	err := paginate(func(opts *github.ListOptions) (*github.Response, error) {
+		page, resp, err := client.Repositories.ListReleases(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, page...)
+		return resp, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list the releases of %s/%s", owner, repo)
+	}
+
+	var previous *github.RepositoryRelease
+	for _, release := range releases {
+		if release.GetDraft() || release.GetPrerelease() || release.GetTagName() == tagName {
+			continue
+		}
+		if previous == nil || release.GetCreatedAt().After(previous.GetCreatedAt().Time) {
+			previous = release
+		}
+	}
+	return previous, nil
+}
+
+// installationsOnRelease returns the installations of the organizations that were last synced to a release.
+func (h *RulesetHandler) installationsOnRelease(tagName string, installations []*github.Installation) []*github.Installation {
+	var on []*github.Installation
+	for _, installation := range installations {
+		if h.orgRelease(installation.GetAccount().GetLogin()) == tagName {
+			on = append(on, installation)
+		}
+	}
+	return on
+}
+
+// filterInstallations returns the installations of the given organizations.
+func filterInstallations(installations []*github.Installation, orgs []string) []*github.Installation {
+	var filtered []*github.Installation
+	for _, installation := range installations {
+		if containsOrg(orgs, installation.GetAccount().GetLogin()) {
+			filtered = append(filtered, installation)
+		}
+	}
+	return filtered
+}
+
+// bundleHash returns the hash of the ruleset files last loaded for a release.
+func (h *RulesetHandler) bundleHash(tagName string) string {
+	if bundle, ok := h.cachedBundle(tagName); ok {
+		if bundle == nil {
+			return ""
+		}
+		return bundle.hash()
+	}
+	if h.State == nil {
+		return ""
+	}
+	return h.State.BundleHash(tagName)
+}
+
+// canaryOrgs returns the organizations prereleases are deployed to.
+func (h *RulesetHandler) canaryOrgs() []string {
+	if h.Config == nil {
+		return nil
+	}
+	return h.Config.Release.CanaryOrgs
+}
+
+// releaseWaves returns the waves new releases are rolled out in.
+func (h *RulesetHandler) releaseWaves() []RolloutWave {
+	if h.Config == nil {
+		return nil
+	}
+	return h.Config.Release.Waves
+}
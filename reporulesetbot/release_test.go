@@ -0,0 +1,90 @@
+package reporulesetbot
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviousRelease(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/octo-org/rulesets/releases", r.URL.Path)
+		w.Write([]byte(`[
+			{"tag_name": "v1.3.0", "created_at": "2024-10-04T00:00:00Z"},
+			{"tag_name": "v1.3.0-rc.1", "prerelease": true, "created_at": "2024-10-03T00:00:00Z"},
+			{"tag_name": "v1.2.1", "draft": true, "created_at": "2024-10-02T00:00:00Z"},
+			{"tag_name": "v1.1.0", "created_at": "2024-09-01T00:00:00Z"},
+			{"tag_name": "v1.2.0", "created_at": "2024-10-01T00:00:00Z"}
+		]`))
+	}))
+
+	previous, err := previousRelease(context.Background(), client, "octo-org", "rulesets", "v1.3.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.2.0", previous.GetTagName())
+
+	previous, err = previousRelease(context.Background(), client, "octo-org", "rulesets", "v1.2.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.3.0", previous.GetTagName())
+}
+
+func TestInstallationsOnRelease(t *testing.T) {
+	store := newTestStateStore(t)
+	assert.NoError(t, store.SetRelease("v1.2.0"))
+	assert.NoError(t, store.RecordOrgSync("org-a", 1, "v1.2.0", nil))
+	assert.NoError(t, store.RecordOrgSync("org-b", 2, "v1.3.0-rc.1", nil))
+
+	installations := []*github.Installation{
+		newTestInstallation(1, "org-a"),
+		newTestInstallation(2, "org-b"),
+		newTestInstallation(3, "org-c"),
+	}
+
+	h := &RulesetHandler{State: store}
+
+	// Organizations that were never synced are on the current release.
+	assert.Equal(t, []*github.Installation{installations[0], installations[2]}, h.installationsOnRelease("v1.2.0", installations))
+	assert.Equal(t, []*github.Installation{installations[1]}, h.installationsOnRelease("v1.3.0-rc.1", installations))
+}
+
+func TestFilterInstallations(t *testing.T) {
+	installations := []*github.Installation{newTestInstallation(1, "org-a"), newTestInstallation(2, "Canary-Org")}
+	assert.Equal(t, []*github.Installation{installations[1]}, filterInstallations(installations, []string{"canary-org"}))
+	assert.Empty(t, filterInstallations(installations, nil))
+}
+
+func TestPublishPrerelease_NoCanaries(t *testing.T) {
+	h := &RulesetHandler{}
+	release := &github.RepositoryRelease{TagName: github.String("v1.3.0-rc.1"), Prerelease: github.Bool(true)}
+
+	// Without canary organizations nothing is downloaded or deployed.
+	assert.NoError(t, h.publishPrerelease(context.Background(), nil, "octo-org", "rulesets", release, []*github.Installation{newTestInstallation(1, "org-a")}, zerolog.Nop()))
+}
+
+func TestHandleReleaseEdited_Unchanged(t *testing.T) {
+	logger := zerolog.Nop()
+	store := newTestStateStore(t)
+	assert.NoError(t, store.SetRelease("v1.2.0"))
+
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/octo-org/rulesets/releases/1/assets":
+			w.Write([]byte(`[{"id": 10, "name": "Default Ruleset.json"}]`))
+		case "/repos/octo-org/rulesets/releases/assets/10":
+			w.Write([]byte(`{"name": "Default Ruleset"}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+	}))
+
+	h := &RulesetHandler{State: store}
+	h.cacheBundle("v1.2.0", &rulesetBundle{Tag: "v1.2.0", Files: map[string][]byte{"Default Ruleset.json": []byte(`{"name": "Default Ruleset"}`)}}, logger)
+
+	// Editing the notes of a release doesn't change its assets, so nothing is rolled out.
+	release := &github.RepositoryRelease{ID: github.Int64(1), TagName: github.String("v1.2.0")}
+	assert.NoError(t, h.handleReleaseEdited(context.Background(), client, "octo-org", "rulesets", release, []*github.Installation{newTestInstallation(1, "org-a")}, logger))
+	assert.Nil(t, h.LastRolloutReport())
+}
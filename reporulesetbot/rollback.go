@@ -0,0 +1,85 @@
+package reporulesetbot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// eventTypeRollback is recorded in the audit log for the changes made by a rollback.
+const eventTypeRollback = "rollback"
+
+// RollbackRequest represents a request to redeploy the rulesets of an earlier release. Without an organization, every
+// organization is rolled back and the release becomes the current release.
+type RollbackRequest struct {
+	Release string `json:"release"`
+	Org     string `json:"org,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Actor   string `json:"actor,omitempty"`
+}
+
+// Rollback redeploys the rulesets of an earlier release, from its JSON assets or, when it has none or was deleted, from
+// the snapshot recorded when it was deployed. Every organization that was rolled back is recorded in the audit log.
+func (h *RulesetHandler) Rollback(ctx context.Context, request RollbackRequest) (*RolloutReport, error) {
+	logger := h.Logger
+
+	if request.Release == "" {
+		return nil, &invalidRequestError{message: "A release tag is required"}
+	}
+	if err := validateReleaseTag(request.Release); err != nil {
+		return nil, err
+	}
+
+	bundle, ok := h.cachedBundle(request.Release)
+	if !ok {
+		var err error
+		bundle, err = h.fetchBundle(ctx, request.Release, logger)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to get the rulesets of release %s", request.Release)
+		}
+	}
+	if bundle == nil {
+		return nil, &notFoundError{message: fmt.Sprintf("Release %s has no ruleset assets or snapshot to roll back to", request.Release)}
+	}
+
+	jwtclient, err := newJWTClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create JWT client")
+	}
+
+	installations, err := getInstallationsForAuthenticatedApp(ctx, jwtclient)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get installations for authenticated app")
+	}
+
+	if request.Org != "" {
+		installations = filterInstallations(installations, []string{request.Org})
+		if len(installations) == 0 {
+			return nil, &notFoundError{message: fmt.Sprintf("The app is not installed in the organization %s", request.Org)}
+		}
+	} else if h.State != nil {
+		if err := h.State.SetRelease(request.Release); err != nil {
+			return nil, errors.Wrap(err, "Failed to record the release")
+		}
+	}
+
+	logger.Info().Msgf("Rolling %d organization(s) back to release %s...", len(installations), request.Release)
+
+	ctx = withEventInfo(ctx, eventInfo{EventType: eventTypeRollback, Sender: request.Actor})
+	report := h.rollout(ctx, request.Release, installations, nil, logger)
+	report.log(logger)
+	h.setLastRolloutReport(report)
+
+	reason := fmt.Sprintf("Rolled back to release %s", request.Release)
+	if request.Reason != "" {
+		reason += ": " + request.Reason
+	}
+	for _, result := range report.Results {
+		if result.Status == RolloutStatusSuccess {
+			h.audit(ctx, AuditEntry{Org: result.Org, Action: AuditActionRollback, Reason: reason}, logger)
+		}
+	}
+
+	return report, report.Err()
+}
@@ -0,0 +1,128 @@
+package reporulesetbot
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollback_Validation(t *testing.T) {
+	h := &RulesetHandler{}
+
+	_, err := h.Rollback(context.Background(), RollbackRequest{})
+	assert.EqualError(t, err, "A release tag is required")
+
+	_, err = h.Rollback(context.Background(), RollbackRequest{Release: "../../etc"})
+	assert.EqualError(t, err, `Invalid release tag "../../etc"`)
+
+	// A release that was only ever deployed from the local rulesets directory has nothing to roll back to.
+	h.cacheBundle("v1.0.0", nil, zerolog.Nop())
+	_, err = h.Rollback(context.Background(), RollbackRequest{Release: "v1.0.0"})
+	assert.EqualError(t, err, "Release v1.0.0 has no ruleset assets or snapshot to roll back to")
+	assert.Equal(t, http.StatusNotFound, errorStatus(err))
+}
+
+// stubInstallations replaces the JWT client with one that lists the given installations.
+func stubInstallations(t *testing.T, installations string) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(installations))
+	}))
+
+	original := newJWTClient
+	newJWTClient = func() (*github.Client, error) { return client, nil }
+	t.Cleanup(func() { newJWTClient = original })
+}
+
+// newRollbackHandler returns a handler that can roll test-org back to v1.0.0 and fails to create a client for other-org.
+func newRollbackHandler(t *testing.T) (*RulesetHandler, *memoryAuditSink) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			_, _ = w.Write([]byte(`{"id": 42, "name": "Default Ruleset", "target": "branch", "enforcement": "active"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+
+	mockClient := new(MockClient)
+	mockClient.On("NewInstallationClient", int64(7)).Return(client, nil)
+	mockClient.On("NewInstallationClient", int64(8)).Return((*github.Client)(nil), errors.New("Installation suspended"))
+
+	sink := &memoryAuditSink{}
+	h := &RulesetHandler{
+		ClientCreator: mockClient,
+		Config:        &Config{Release: ReleaseConfig{Concurrency: 1}},
+		State:         newTestStateStore(t),
+		Audit:         sink,
+		Tracker:       NewMemoryRulesetTracker(),
+	}
+	assert.NoError(t, h.State.SetRelease("v2.0.0"))
+	h.cacheBundle("v1.0.0", &rulesetBundle{Tag: "v1.0.0", Files: map[string][]byte{
+		"Default Ruleset.json": []byte(`{"name": "Default Ruleset", "target": "branch", "enforcement": "active"}`),
+	}}, h.Logger)
+	return h, sink
+}
+
+// rollbackEntries returns the rollback entries in the audit log.
+func rollbackEntries(sink *memoryAuditSink) []AuditEntry {
+	var entries []AuditEntry
+	for _, entry := range sink.entries {
+		if entry.Action == AuditActionRollback {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func TestRollback(t *testing.T) {
+	stubInstallations(t, `[{"id": 7, "account": {"login": "test-org"}}, {"id": 8, "account": {"login": "other-org"}}]`)
+
+	t.Run("every organization", func(t *testing.T) {
+		h, sink := newRollbackHandler(t)
+
+		report, err := h.Rollback(context.Background(), RollbackRequest{Release: "v1.0.0", Reason: "Broke the build", Actor: "octocat"})
+		assert.EqualError(t, err, "Rollout of release v1.0.0 failed for 1 organization(s): other-org: Failed to create installation client: Installation suspended")
+		assert.Len(t, report.Results, 2)
+		assert.Equal(t, "v1.0.0", h.State.Release())
+
+		entries := rollbackEntries(sink)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, "test-org", entries[0].Org)
+			assert.Equal(t, "octocat", entries[0].Actor)
+			assert.Equal(t, "Rolled back to release v1.0.0: Broke the build", entries[0].Reason)
+		}
+	})
+
+	t.Run("one organization", func(t *testing.T) {
+		h, sink := newRollbackHandler(t)
+
+		report, err := h.Rollback(context.Background(), RollbackRequest{Release: "v1.0.0", Org: "TEST-ORG", Actor: "octocat"})
+		assert.NoError(t, err)
+		if assert.Len(t, report.Results, 1) {
+			assert.Equal(t, "test-org", report.Results[0].Org)
+		}
+		assert.Equal(t, "v2.0.0", h.State.Release())
+
+		entries := rollbackEntries(sink)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, "octocat", entries[0].Actor)
+			assert.Equal(t, "Rolled back to release v1.0.0", entries[0].Reason)
+		}
+	})
+
+	t.Run("organization not installed", func(t *testing.T) {
+		h, sink := newRollbackHandler(t)
+
+		_, err := h.Rollback(context.Background(), RollbackRequest{Release: "v1.0.0", Org: "missing-org"})
+		assert.EqualError(t, err, "The app is not installed in the organization missing-org")
+		assert.Equal(t, http.StatusNotFound, errorStatus(err))
+		assert.Equal(t, "v2.0.0", h.State.Release())
+		assert.Empty(t, sink.entries)
+	})
+}
@@ -0,0 +1,321 @@
+package reporulesetbot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Constants for the status of an organization in a rollout.
+const (
+	RolloutStatusSuccess = "success"
+	RolloutStatusFailed  = "failed"
+	RolloutStatusSkipped = "skipped"
+)
+
+// defaultRolloutConcurrency is the number of organizations updated at the same time when not configured.
+const defaultRolloutConcurrency = 4
+
+// ReleaseConfig represents the configuration of release rollouts.
+type ReleaseConfig struct {
+	Concurrency int               `yaml:"concurrency"`
+	CanaryOrgs  []string          `yaml:"canary_orgs"`
+	Waves       []RolloutWave     `yaml:"waves"`
+	Gate        RolloutGateConfig `yaml:"gate"`
+}
+
+// OrgResult represents the outcome of a rollout for a single organization.
+type OrgResult struct {
+	Org    string `json:"org"`
+	Wave   string `json:"wave,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// RolloutReport represents the aggregated outcome of a rollout across organizations.
+type RolloutReport struct {
+	Release    string      `json:"release"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	Aborted    string      `json:"aborted,omitempty"`
+	Results    []OrgResult `json:"results"`
+}
+
+// Count returns the number of organizations with the given status.
+func (r *RolloutReport) Count(status string) int {
+	count := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Err returns an error listing the organizations that failed, or nil if none did.
+func (r *RolloutReport) Err() error {
+	var failed []string
+	for _, result := range r.Results {
+		if result.Status == RolloutStatusFailed {
+			failed = append(failed, fmt.Sprintf("%s: %s", result.Org, result.Reason))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.Errorf("Rollout of release %s failed for %d organization(s): %s", r.Release, len(failed), strings.Join(failed, "; "))
+}
+
+// log writes the outcome of the rollout for every organization.
+func (r *RolloutReport) log(logger zerolog.Logger) {
+	for _, result := range r.Results {
+		switch result.Status {
+		case RolloutStatusFailed:
+			logger.Error().Msgf("Rollout of release %s to the organization %s failed: %s.", r.Release, result.Org, result.Reason)
+		case RolloutStatusSkipped:
+			logger.Warn().Msgf("Rollout of release %s to the organization %s was skipped: %s.", r.Release, result.Org, result.Reason)
+		default:
+			logger.Info().Msgf("Rollout of release %s to the organization %s succeeded.", r.Release, result.Org)
+		}
+	}
+	if r.Aborted != "" {
+		logger.Warn().Msgf("Rollout of release %s was stopped: %s.", r.Release, r.Aborted)
+	}
+	logger.Info().Msgf("Rollout of release %s finished: %d succeeded, %d failed, %d skipped.", r.Release, r.Count(RolloutStatusSuccess), r.Count(RolloutStatusFailed), r.Count(RolloutStatusSkipped))
+}
+
+// LastRolloutReport returns the report of the most recent rollout, or nil if there hasn't been one.
+func (h *RulesetHandler) LastRolloutReport() *RolloutReport {
+	h.rolloutMu.Lock()
+	defer h.rolloutMu.Unlock()
+	return h.lastRollout
+}
+
+// setLastRolloutReport records the report of the most recent rollout.
+func (h *RulesetHandler) setLastRolloutReport(report *RolloutReport) {
+	h.rolloutMu.Lock()
+	defer h.rolloutMu.Unlock()
+	h.lastRollout = report
+}
+
+// rolloutConcurrency returns the number of organizations to update at the same time.
+func (h *RulesetHandler) rolloutConcurrency() int {
+	if h.Config == nil || h.Config.Release.Concurrency <= 0 {
+		return defaultRolloutConcurrency
+	}
+	return h.Config.Release.Concurrency
+}
+
+// rollout applies the configured rulesets to every installation with bounded concurrency, one wave at a time.
+// A failure in one organization does not stop the rollout to the others in its wave, but the health gate of the next
+// wave stops the rollout, as does aborting it.
+func (h *RulesetHandler) rollout(ctx context.Context, release string, installations []*github.Installation, waves []RolloutWave, logger zerolog.Logger) *RolloutReport {
+	ctx, active, done := h.startRollout(ctx, release)
+	defer done()
+
+	ctx, span := h.startSpan(ctx, "rollout", AttributeRelease.String(release))
+	defer span.End()
+
+	report := &RolloutReport{
+		Release:   release,
+		StartedAt: time.Now(),
+	}
+
+	var previous []OrgResult
+	var started time.Time
+	planned := planWaves(installations, waves)
+	active.update(func(progress *RolloutProgress) {
+		progress.Waves = len(planned)
+		progress.Total = len(installations)
+	})
+	for i, wave := range planned {
+		active.update(func(progress *RolloutProgress) {
+			progress.Wave = wave.Name
+			progress.WaveIndex = i + 1
+		})
+
+		if i > 0 {
+			err := waitForWave(ctx, wave.Delay)
+			if err == nil && wave.Gate {
+				err = h.checkWaveHealth(ctx, planned[i-1], previous, started, logger)
+			}
+			if err != nil {
+				report.Aborted = err.Error()
+				for _, skipped := range planned[i:] {
+					report.Results = append(report.Results, skipWave(skipped, err.Error())...)
+				}
+				break
+			}
+		}
+
+		if wave.Name != "" {
+			logger.Info().Msgf("Rolling out release %s to wave %s with %d organization(s).", release, wave.Name, len(wave.installations))
+		}
+
+		started = time.Now()
+		previous = rolloutToOrgs(ctx, wave.installations, h.rolloutConcurrency(), func(ctx context.Context, installation *github.Installation) error {
+			orgName := installation.GetAccount().GetLogin()
+			err := h.syncOrganization(ctx, installation.GetID(), orgName, release, orgLogger(logger, orgName, installation.GetID()))
+			active.update(func(progress *RolloutProgress) {
+				progress.Done++
+				if err != nil {
+					progress.Failed++
+				}
+			})
+			return err
+		})
+		for j := range previous {
+			previous[j].Wave = wave.Name
+		}
+		report.Results = append(report.Results, previous...)
+		active.update(func(progress *RolloutProgress) { progress.Done = len(report.Results) })
+	}
+	if report.Aborted == "" && ctx.Err() != nil {
+		report.Aborted = context.Cause(ctx).Error()
+	}
+	report.FinishedAt = time.Now()
+
+	for _, result := range report.Results {
+		h.incCounter(MetricsKeyRolloutResults, "status", result.Status)
+	}
+	if report.Aborted != "" {
+		h.incCounter(MetricsKeyRolloutsAborted)
+		span.SetStatus(codes.Error, report.Aborted)
+	}
+	span.SetAttributes(
+		attribute.Int("rollout.success", report.Count(RolloutStatusSuccess)),
+		attribute.Int("rollout.failed", report.Count(RolloutStatusFailed)),
+		attribute.Int("rollout.skipped", report.Count(RolloutStatusSkipped)),
+	)
+
+	return report
+}
+
+// rolloutToOrgs calls syncOrg for every installation, running at most concurrency calls at the same time,
+// and returns the result for every organization sorted by name.
+func rolloutToOrgs(ctx context.Context, installations []*github.Installation, concurrency int, syncOrg func(context.Context, *github.Installation) error) []OrgResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]OrgResult, len(installations))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, installation := range installations {
+		orgName := installation.GetAccount().GetLogin()
+		results[i] = OrgResult{Org: orgName}
+
+		if reason := skipReason(installation); reason != "" {
+			results[i].Status = RolloutStatusSkipped
+			results[i].Reason = reason
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+			}
+
+			if ctx.Err() != nil {
+				results[i].Status = RolloutStatusSkipped
+				results[i].Reason = context.Cause(ctx).Error()
+				return
+			}
+
+			if err := syncOrg(ctx, installation); err != nil {
+				results[i].Status = RolloutStatusFailed
+				results[i].Reason = err.Error()
+				return
+			}
+			results[i].Status = RolloutStatusSuccess
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Org < results[j].Org })
+	return results
+}
+
+// skipReason returns why an installation should not receive the rulesets, or an empty string if it should.
+func skipReason(installation *github.Installation) string {
+	if accountType := installation.GetAccount().GetType(); accountType != "" && accountType != "Organization" {
+		return fmt.Sprintf("account type %s does not support organization rulesets", accountType)
+	}
+	if installation.SuspendedAt != nil {
+		return "installation is suspended"
+	}
+	return ""
+}
+
+// syncOrganization creates or updates the configured rulesets in an organization and records the outcome. The state of
+// the organization is written once the sync is done.
+func (h *RulesetHandler) syncOrganization(ctx context.Context, installationID int64, orgName, releaseTag string, logger zerolog.Logger) error {
+	ctx, span := h.startSpan(ctx, "sync organization",
+		AttributeOrg.String(orgName),
+		AttributeInstallationID.Int64(installationID),
+		AttributeRelease.String(releaseTag),
+	)
+	defer h.batchStateWrites(orgName, logger)()
+
+	err := h.syncOrganizationRulesets(ctx, installationID, orgName, releaseTag, logger)
+	endSpan(span, err)
+	h.recordOrgSync(orgName, installationID, releaseTag, err, logger)
+	if err != nil {
+		h.notifyFailure(ctx, orgName, "", err, logger)
+	}
+	return err
+}
+
+// syncOrganizationRulesets plans and applies the changes that bring the rulesets in an organization in line with the
+// configuration.
+func (h *RulesetHandler) syncOrganizationRulesets(ctx context.Context, installationID int64, orgName, releaseTag string, logger zerolog.Logger) error {
+	client, err := h.ClientCreator.NewInstallationClient(installationID)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create installation client")
+	}
+
+	plan, err := h.planOrganization(ctx, client, orgName, releaseTag, logger)
+	if err != nil {
+		h.recordPlanError(ctx, orgName, releaseTag, err, logger)
+		return err
+	}
+
+	plan.log(logger)
+
+	return h.applyPlan(ctx, client, plan, releaseTag, logger)
+}
+
+// updateOrgRuleset updates an organization ruleset to match the desired ruleset, unless it already does.
+func (h *RulesetHandler) updateOrgRuleset(ctx context.Context, client *github.Client, orgName string, rulesetID int64, ruleset *DesiredRuleset, releaseTag string, logger zerolog.Logger) error {
+	change, err := h.planRulesetUpdate(ctx, client, orgName, rulesetID, ruleset, logger)
+	if err != nil {
+		h.recordPlanError(ctx, orgName, releaseTag, err, logger)
+		return err
+	}
+	return h.applyChange(ctx, client, orgName, change, releaseTag, logger)
+}
+
+// hasRulesetID returns true if a ruleset with the given ID is in the list.
+func hasRulesetID(rulesets []*github.Ruleset, rulesetID int64) bool {
+	for _, ruleset := range rulesets {
+		if ruleset.GetID() == rulesetID {
+			return true
+		}
+	}
+	return false
+}
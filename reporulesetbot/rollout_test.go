@@ -0,0 +1,116 @@
+package reporulesetbot
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestInstallation returns an installation for the given organization.
+func newTestInstallation(id int64, orgName string) *github.Installation {
+	return &github.Installation{
+		ID: github.Int64(id),
+		Account: &github.User{
+			Login: github.String(orgName),
+			Type:  github.String("Organization"),
+		},
+	}
+}
+
+func TestRolloutToOrgs(t *testing.T) {
+	t.Run("continues after an organization fails", func(t *testing.T) {
+		installations := []*github.Installation{
+			newTestInstallation(1, "org-c"),
+			newTestInstallation(2, "org-a"),
+			newTestInstallation(3, "org-b"),
+		}
+
+		results := rolloutToOrgs(context.Background(), installations, 2, func(ctx context.Context, installation *github.Installation) error {
+			if installation.GetAccount().GetLogin() == "org-a" {
+				return errors.New("Failed to get team with name release-managers")
+			}
+			return nil
+		})
+
+		assert.Equal(t, []OrgResult{
+			{Org: "org-a", Status: RolloutStatusFailed, Reason: "Failed to get team with name release-managers"},
+			{Org: "org-b", Status: RolloutStatusSuccess},
+			{Org: "org-c", Status: RolloutStatusSuccess},
+		}, results)
+	})
+
+	t.Run("skips user accounts and suspended installations", func(t *testing.T) {
+		user := newTestInstallation(1, "octocat")
+		user.Account.Type = github.String("User")
+		suspended := newTestInstallation(2, "org-suspended")
+		suspended.SuspendedAt = &github.Timestamp{Time: time.Now()}
+
+		called := false
+		results := rolloutToOrgs(context.Background(), []*github.Installation{user, suspended}, 2, func(ctx context.Context, installation *github.Installation) error {
+			called = true
+			return nil
+		})
+
+		assert.False(t, called)
+		assert.Equal(t, RolloutStatusSkipped, results[0].Status)
+		assert.Equal(t, RolloutStatusSkipped, results[1].Status)
+		assert.Equal(t, "installation is suspended", results[1].Reason)
+	})
+
+	t.Run("limits the number of concurrent organizations", func(t *testing.T) {
+		var installations []*github.Installation
+		for i := 0; i < 10; i++ {
+			installations = append(installations, newTestInstallation(int64(i), string(rune('a'+i))))
+		}
+
+		var running, maxRunning int32
+		rolloutToOrgs(context.Background(), installations, 3, func(ctx context.Context, installation *github.Installation) error {
+			current := atomic.AddInt32(&running, 1)
+			for {
+				observed := atomic.LoadInt32(&maxRunning)
+				if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+
+		assert.LessOrEqual(t, maxRunning, int32(3))
+	})
+
+	t.Run("skips organizations after the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results := rolloutToOrgs(ctx, []*github.Installation{newTestInstallation(1, "org-a")}, 0, func(ctx context.Context, installation *github.Installation) error {
+			return nil
+		})
+
+		assert.Equal(t, OrgResult{Org: "org-a", Status: RolloutStatusSkipped, Reason: "context canceled"}, results[0])
+	})
+}
+
+func TestRolloutReport(t *testing.T) {
+	report := &RolloutReport{
+		Release: "v1.2.0",
+		Results: []OrgResult{
+			{Org: "org-a", Status: RolloutStatusSuccess},
+			{Org: "org-b", Status: RolloutStatusFailed, Reason: "boom"},
+			{Org: "org-c", Status: RolloutStatusSkipped, Reason: "installation is suspended"},
+		},
+	}
+
+	assert.Equal(t, 1, report.Count(RolloutStatusSuccess))
+	assert.Equal(t, 1, report.Count(RolloutStatusFailed))
+	assert.EqualError(t, report.Err(), "Rollout of release v1.2.0 failed for 1 organization(s): org-b: boom")
+
+	report.Results = report.Results[:1]
+	assert.NoError(t, report.Err())
+}
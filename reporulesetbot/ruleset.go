@@ -3,11 +3,11 @@ package reporulesetbot
 import (
 	"context"
 	"encoding/json"
-	"os"
 
 	"github.com/google/go-github/v65/github"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Changes represents the changes in a ruleset event.
@@ -20,6 +20,13 @@ type Changes struct {
 	} `json:"enforcement,omitempty"`
 }
 
+// DesiredRuleset represents a ruleset from a ruleset file, in the state it should be in an organization.
+type DesiredRuleset struct {
+	*github.Ruleset
+	File               string
+	LocalModifications []LocalModification
+}
+
 // Workflows represents the ruleset workflows parameters.
 type Workflows struct {
 	Workflows []Workflow `json:"workflows"`
@@ -32,17 +39,20 @@ type Workflow struct {
 	Ref          string `json:"ref"`
 }
 
-// getRulesets returns the rulesets from the ruleset files.
-func (h *RulesetHandler) getRulesets(ctx context.Context, client *github.Client, orgName string, logger zerolog.Logger) ([]*github.Ruleset, error) {
-	var rulesets []*github.Ruleset
+// getRulesets returns the rulesets from the ruleset files of a release.
+func (h *RulesetHandler) getRulesets(ctx context.Context, client *github.Client, orgName, releaseTag string, logger zerolog.Logger) (_ []*DesiredRuleset, err error) {
+	ctx, span := h.startSpan(ctx, "get rulesets", AttributeOrg.String(orgName), AttributeRelease.String(releaseTag))
+	defer func() { endSpan(span, err) }()
+
+	var rulesets []*DesiredRuleset
 
-	files, err := getRulesetFiles("rulesets")
+	bundle, err := h.rulesetBundle(ctx, releaseTag, logger)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to get ruleset files")
+		return nil, errors.Wrapf(err, "Failed to get the ruleset files of release %s", releaseTag)
 	}
 
-	for _, file := range files {
-		ruleset, err := h.processRulesetFile(file, ctx, client, orgName, logger)
+	for _, file := range bundle.names() {
+		ruleset, err := h.processRulesetData(file, bundle.Files[file], ctx, client, orgName, logger)
 		if err != nil {
 			return nil, errors.Wrapf(err, "Failed to process ruleset file %s", file)
 		}
@@ -51,20 +61,17 @@ func (h *RulesetHandler) getRulesets(ctx context.Context, client *github.Client,
 	return rulesets, nil
 }
 
-// processRulesetFile processes the ruleset from a given JSON file.
-func (h *RulesetHandler) processRulesetFile(file string, ctx context.Context, client *github.Client, orgName string, logger zerolog.Logger) (*github.Ruleset, error) {
+// processRulesetData processes the ruleset from the JSON content of a ruleset file.
+func (h *RulesetHandler) processRulesetData(file string, jsonData []byte, ctx context.Context, client *github.Client, orgName string, logger zerolog.Logger) (_ *DesiredRuleset, err error) {
+	ctx, span := h.startSpan(ctx, "process ruleset file", AttributeOrg.String(orgName), AttributeRulesetFile.String(file))
+	defer func() { endSpan(span, err) }()
+
 	logger.Info().Msgf("Processing ruleset file %s...", file)
 
-	jsonData, err := os.ReadFile(file)
+	ruleset, options, err := parseRulesetFile(file, jsonData)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Failed to read ruleset file %s.", file)
-		return nil, errors.Wrap(err, "Failed to read ruleset file")
-	}
-
-	var ruleset *github.Ruleset
-	if err := json.Unmarshal(jsonData, &ruleset); err != nil {
-		logger.Error().Err(err).Msgf("Failed to unmarshal ruleset file %s.", file)
-		return nil, errors.Wrap(err, "Failed to unmarshal ruleset file")
+		logger.Error().Err(err).Msgf("Failed to parse ruleset file %s.", file)
+		return nil, err
 	}
 
 	if err := h.processRuleset(ctx, ruleset, client, orgName, logger); err != nil {
@@ -73,7 +80,28 @@ func (h *RulesetHandler) processRulesetFile(file string, ctx context.Context, cl
 
 	logger.Info().Msgf("Processed ruleset file %s.", file)
 
-	return ruleset, nil
+	return &DesiredRuleset{Ruleset: ruleset, File: file, LocalModifications: options.AllowedLocalModifications}, nil
+}
+
+// parseRulesetFile parses and validates the JSON content of a ruleset file, before any names are resolved in an
+// organization.
+func parseRulesetFile(file string, jsonData []byte) (*github.Ruleset, rulesetFileOptions, error) {
+	var ruleset *github.Ruleset
+	if err := json.Unmarshal(jsonData, &ruleset); err != nil {
+		return nil, rulesetFileOptions{}, errors.Wrap(err, "Failed to unmarshal ruleset file")
+	}
+
+	var options rulesetFileOptions
+	if err := json.Unmarshal(jsonData, &options); err != nil {
+		return nil, rulesetFileOptions{}, errors.Wrap(err, "Failed to unmarshal ruleset file options")
+	}
+
+	for _, modification := range options.AllowedLocalModifications {
+		if err := modification.validate(); err != nil {
+			return nil, rulesetFileOptions{}, errors.Wrapf(err, "Invalid ruleset file %s", file)
+		}
+	}
+	return ruleset, options, nil
 }
 
 // processRuleset processes the ruleset.
@@ -83,6 +111,7 @@ func (h *RulesetHandler) processRuleset(ctx context.Context, ruleset *github.Rul
 	for _, rule := range ruleset.Rules {
 		if rule.Type == "workflows" {
 			if err := h.processWorkflows(ctx, rule, client, sourceOrgName, orgName, logger); err != nil {
+				h.incCounter(MetricsKeyResolutionFailures, "kind", "workflow")
 				return errors.Wrapf(err, "Failed to process workflows in ruleset file: %s", ruleset.Name)
 			}
 		}
@@ -93,10 +122,12 @@ func (h *RulesetHandler) processRuleset(ctx context.Context, ruleset *github.Rul
 			switch bypassActor.GetActorType() {
 			case "Team":
 				if err := h.processTeamActor(ctx, client, bypassActor, sourceOrgName, orgName, logger); err != nil {
+					h.incCounter(MetricsKeyResolutionFailures, "kind", "team")
 					return errors.Wrapf(err, "Failed to process team bypass actor with id %d in ruleset file: %s", bypassActor.GetActorID(), ruleset.Name)
 				}
 			case "RepositoryRole":
 				if err := h.processRepoRoleActor(ctx, client, bypassActor, sourceOrgName, orgName, logger); err != nil {
+					h.incCounter(MetricsKeyResolutionFailures, "kind", "repository_role")
 					return errors.Wrapf(err, "Failed to process repository role bypass actor with id %d in ruleset file: %s", bypassActor.GetActorID(), ruleset.Name)
 				}
 			case "Integration":
@@ -110,7 +141,10 @@ func (h *RulesetHandler) processRuleset(ctx context.Context, ruleset *github.Rul
 }
 
 // processWorkflows processes the workflows in a repository rule.
-func (h *RulesetHandler) processWorkflows(ctx context.Context, rule *github.RepositoryRule, client *github.Client, sourceOrgName, orgName string, logger zerolog.Logger) error {
+func (h *RulesetHandler) processWorkflows(ctx context.Context, rule *github.RepositoryRule, client *github.Client, sourceOrgName, orgName string, logger zerolog.Logger) (err error) {
+	ctx, span := h.startSpan(ctx, "resolve workflows", AttributeOrg.String(orgName))
+	defer func() { endSpan(span, err) }()
+
 	var workflows Workflows
 	if err := json.Unmarshal(*rule.Parameters, &workflows); err != nil {
 		logger.Error().Err(err).Msg("Failed to unmarshal workflow parameters.")
@@ -158,7 +192,9 @@ func (h *RulesetHandler) updateWorkflowRepoID(ctx context.Context, workflow *Wor
 }
 
 // processTeamActor processes a team actor.
-func (h *RulesetHandler) processTeamActor(ctx context.Context, client *github.Client, actor *github.BypassActor, sourceOrgName, orgName string, logger zerolog.Logger) error {
+func (h *RulesetHandler) processTeamActor(ctx context.Context, client *github.Client, actor *github.BypassActor, sourceOrgName, orgName string, logger zerolog.Logger) (err error) {
+	ctx, span := h.startSpan(ctx, "resolve team bypass actor", AttributeOrg.String(orgName), attribute.Int64("ruleset.bypass_actor.id", actor.GetActorID()))
+	defer func() { endSpan(span, err) }()
 
 	sourceClient, err := h.getSourceClient(ctx, sourceOrgName, logger)
 	if err != nil {
@@ -192,9 +228,12 @@ func (h *RulesetHandler) processTeamActor(ctx context.Context, client *github.Cl
 }
 
 // processRepoRoleActor processes a repository role actor.
-func (h *RulesetHandler) processRepoRoleActor(ctx context.Context, client *github.Client, actor *github.BypassActor, sourceOrgName, orgName string, logger zerolog.Logger) error {
+func (h *RulesetHandler) processRepoRoleActor(ctx context.Context, client *github.Client, actor *github.BypassActor, sourceOrgName, orgName string, logger zerolog.Logger) (err error) {
 	actorID := actor.GetActorID()
 
+	ctx, span := h.startSpan(ctx, "resolve repository role bypass actor", AttributeOrg.String(orgName), attribute.Int64("ruleset.bypass_actor.id", actorID))
+	defer func() { endSpan(span, err) }()
+
 	sourceClient, err := h.getSourceClient(ctx, sourceOrgName, logger)
 	if err != nil {
 		return err
@@ -0,0 +1,473 @@
+package reporulesetbot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// defaultStatePath is the file the state is stored in when not configured.
+const defaultStatePath = "state.json"
+
+// StateConfig represents the configuration of the state store.
+type StateConfig struct {
+	Path      string `yaml:"path"`
+	Snapshots string `yaml:"snapshots"`
+}
+
+// RulesetState represents what the app last applied for a ruleset in an organization.
+type RulesetState struct {
+	ID         int64     `json:"id,omitempty"`
+	Name       string    `json:"name"`
+	File       string    `json:"file"`
+	Hash       string    `json:"hash,omitempty"`
+	ReleaseTag string    `json:"release_tag,omitempty"`
+	LastSync   time.Time `json:"last_sync,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// OrgState represents the sync status of an organization and its managed rulesets, keyed by ruleset file.
+type OrgState struct {
+	InstallationID int64                    `json:"installation_id,omitempty"`
+	LastSync       time.Time                `json:"last_sync,omitempty"`
+	LastError      string                   `json:"last_error,omitempty"`
+	Release        string                   `json:"release,omitempty"`
+	Suspended      bool                     `json:"suspended,omitempty"`
+	Rulesets       map[string]*RulesetState `json:"rulesets"`
+}
+
+// state is the content of the state file.
+type state struct {
+	Release string               `json:"release,omitempty"`
+	Bundles map[string]string    `json:"bundles,omitempty"`
+	Orgs    map[string]*OrgState `json:"orgs"`
+}
+
+// StateStore records the state applied to each organization in a JSON file on disk.
+// It implements RulesetTracker, so it can be used to look up managed rulesets.
+type StateStore struct {
+	path string
+
+	mu      sync.Mutex
+	state   state
+	batches map[string]int
+	dirty   bool
+}
+
+// OpenStateStore opens the state store at the given path, creating it on the first write if it doesn't exist.
+func OpenStateStore(path string) (*StateStore, error) {
+	if path == "" {
+		path = defaultStatePath
+	}
+
+	store := &StateStore{
+		path:  path,
+		state: state{Orgs: make(map[string]*OrgState)},
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read state file %s", path)
+	}
+
+	if err := json.Unmarshal(data, &store.state); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse state file %s", path)
+	}
+	if store.state.Orgs == nil {
+		store.state.Orgs = make(map[string]*OrgState)
+	}
+
+	return store, nil
+}
+
+// save writes the state to a temporary file and renames it over the state file, so a crash never leaves a partial file.
+// The caller must hold the lock.
+func (s *StateStore) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal state")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "Failed to create temporary state file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "Failed to write temporary state file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "Failed to close temporary state file")
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrapf(err, "Failed to write state file %s", s.path)
+	}
+	s.dirty = false
+	return nil
+}
+
+// update applies a change to the state and saves it.
+func (s *StateStore) update(change func(*state)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change(&s.state)
+	return s.save()
+}
+
+// updateOrg applies a change to the state of an organization. While the organization is in a batch, the change is
+// only saved when the batch ends.
+func (s *StateStore) updateOrg(orgName string, change func(*state)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change(&s.state)
+	if s.batches[orgName] > 0 {
+		s.dirty = true
+		return nil
+	}
+	return s.save()
+}
+
+// BeginBatch holds back the changes to the state of an organization until EndBatch is called, so syncing an
+// organization writes the state file once instead of once per ruleset. Batches of the same organization nest.
+func (s *StateStore) BeginBatch(orgName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.batches == nil {
+		s.batches = make(map[string]int)
+	}
+	s.batches[orgName]++
+}
+
+// EndBatch ends a batch of changes to the state of an organization, and saves the changes held back when it was the
+// outermost batch.
+func (s *StateStore) EndBatch(orgName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches[orgName]--
+	if s.batches[orgName] > 0 {
+		return nil
+	}
+	delete(s.batches, orgName)
+
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// org returns the state of an organization, creating it if needed. The caller must hold the lock.
+func (st *state) org(orgName string) *OrgState {
+	org, ok := st.Orgs[orgName]
+	if !ok {
+		org = &OrgState{Rulesets: make(map[string]*RulesetState)}
+		st.Orgs[orgName] = org
+	}
+	if org.Rulesets == nil {
+		org.Rulesets = make(map[string]*RulesetState)
+	}
+	return org
+}
+
+// ruleset returns the state of a ruleset in an organization, creating it if needed. The caller must hold the lock.
+func (st *state) ruleset(orgName, file, name string) *RulesetState {
+	org := st.org(orgName)
+	ruleset, ok := org.Rulesets[file]
+	if !ok {
+		ruleset = &RulesetState{File: file}
+		org.Rulesets[file] = ruleset
+	}
+	if name != "" {
+		ruleset.Name = name
+	}
+	return ruleset
+}
+
+// ManagedRulesets returns the rulesets the app deployed to an organization, sorted by ID.
+func (s *StateStore) ManagedRulesets(orgName string) ([]ManagedRuleset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rulesets []ManagedRuleset
+	if org, ok := s.state.Orgs[orgName]; ok {
+		for _, ruleset := range org.Rulesets {
+			if ruleset.ID != 0 {
+				rulesets = append(rulesets, ManagedRuleset{ID: ruleset.ID, Name: ruleset.Name, File: ruleset.File})
+			}
+		}
+	}
+	sort.Slice(rulesets, func(i, j int) bool { return rulesets[i].ID < rulesets[j].ID })
+	return rulesets, nil
+}
+
+// TrackRuleset records the ID of a ruleset deployed to an organization.
+func (s *StateStore) TrackRuleset(orgName string, ruleset ManagedRuleset) error {
+	return s.updateOrg(orgName, func(st *state) {
+		st.ruleset(orgName, ruleset.File, ruleset.Name).ID = ruleset.ID
+	})
+}
+
+// UntrackRuleset forgets the ID of a ruleset that no longer exists in an organization.
+func (s *StateStore) UntrackRuleset(orgName string, rulesetID int64) error {
+	return s.updateOrg(orgName, func(st *state) {
+		org, ok := st.Orgs[orgName]
+		if !ok {
+			return
+		}
+		for _, ruleset := range org.Rulesets {
+			if ruleset.ID == rulesetID {
+				ruleset.ID = 0
+			}
+		}
+	})
+}
+
+// ForgetRuleset removes the state of a ruleset that was removed from the configuration, so the release it was last
+// synced to no longer counts towards the organization.
+func (s *StateStore) ForgetRuleset(orgName string, rulesetID int64) error {
+	return s.updateOrg(orgName, func(st *state) {
+		org, ok := st.Orgs[orgName]
+		if !ok {
+			return
+		}
+		for file, ruleset := range org.Rulesets {
+			if ruleset.ID == rulesetID {
+				delete(org.Rulesets, file)
+			}
+		}
+	})
+}
+
+// RecordRulesetSync records the outcome of applying a ruleset to an organization.
+// On success the hash and release tag of the applied ruleset are recorded, on failure only the error.
+func (s *StateStore) RecordRulesetSync(orgName, file, name, hash, releaseTag string, syncErr error) error {
+	return s.updateOrg(orgName, func(st *state) {
+		ruleset := st.ruleset(orgName, file, name)
+		if syncErr != nil {
+			ruleset.LastError = syncErr.Error()
+			return
+		}
+		ruleset.Hash = hash
+		ruleset.ReleaseTag = releaseTag
+		ruleset.LastSync = time.Now().UTC()
+		ruleset.LastError = ""
+	})
+}
+
+// RecordOrgSync records the outcome of syncing all the rulesets of an organization to a release.
+func (s *StateStore) RecordOrgSync(orgName string, installationID int64, releaseTag string, syncErr error) error {
+	return s.updateOrg(orgName, func(st *state) {
+		org := st.org(orgName)
+		if installationID != 0 {
+			org.InstallationID = installationID
+		}
+		if syncErr != nil {
+			org.LastError = syncErr.Error()
+			return
+		}
+		org.Release = releaseTag
+		org.LastSync = time.Now().UTC()
+		org.LastError = ""
+	})
+}
+
+// SetOrgSuspended records whether the installation of the app in an organization is suspended.
+func (s *StateStore) SetOrgSuspended(orgName string, installationID int64, suspended bool) error {
+	return s.updateOrg(orgName, func(st *state) {
+		org := st.org(orgName)
+		if installationID != 0 {
+			org.InstallationID = installationID
+		}
+		org.Suspended = suspended
+	})
+}
+
+// RenameOrg moves the state of an organization to its new name.
+func (s *StateStore) RenameOrg(from, to string) error {
+	return s.update(func(st *state) {
+		if org, ok := st.Orgs[from]; ok {
+			delete(st.Orgs, from)
+			st.Orgs[to] = org
+		}
+	})
+}
+
+// ForgetOrg removes the state of an organization.
+func (s *StateStore) ForgetOrg(orgName string) error {
+	return s.update(func(st *state) {
+		delete(st.Orgs, orgName)
+	})
+}
+
+// SetRelease records the release tag that is currently being applied.
+func (s *StateStore) SetRelease(releaseTag string) error {
+	return s.update(func(st *state) {
+		st.Release = releaseTag
+	})
+}
+
+// SetBundleHash records the hash of the ruleset files of a release.
+func (s *StateStore) SetBundleHash(releaseTag, hash string) error {
+	return s.update(func(st *state) {
+		if st.Bundles == nil {
+			st.Bundles = make(map[string]string)
+		}
+		st.Bundles[releaseTag] = hash
+	})
+}
+
+// BundleHash returns the recorded hash of the ruleset files of a release, or an empty string if there is none.
+func (s *StateStore) BundleHash(releaseTag string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.Bundles[releaseTag]
+}
+
+// Release returns the release tag that was last applied.
+func (s *StateStore) Release() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.Release
+}
+
+// Org returns a copy of the state of an organization.
+func (s *StateStore) Org(orgName string) (OrgState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	org, ok := s.state.Orgs[orgName]
+	if !ok {
+		return OrgState{}, false
+	}
+	return org.copy(), true
+}
+
+// OrgName returns the spelling of an organization name in the state, matching it case-insensitively. A name that isn't
+// in the state is returned unchanged.
+func (s *StateStore) OrgName(orgName string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Orgs[orgName]; ok {
+		return orgName
+	}
+	for name := range s.state.Orgs {
+		if strings.EqualFold(name, orgName) {
+			return name
+		}
+	}
+	return orgName
+}
+
+// Orgs returns a copy of the state of every organization, keyed by organization name.
+func (s *StateStore) Orgs() map[string]OrgState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orgs := make(map[string]OrgState, len(s.state.Orgs))
+	for orgName, org := range s.state.Orgs {
+		orgs[orgName] = org.copy()
+	}
+	return orgs
+}
+
+// copy returns a deep copy of the organization state.
+func (o *OrgState) copy() OrgState {
+	c := *o
+	c.Rulesets = make(map[string]*RulesetState, len(o.Rulesets))
+	for file, ruleset := range o.Rulesets {
+		r := *ruleset
+		c.Rulesets[file] = &r
+	}
+	return c
+}
+
+// rulesetHash returns a hash of the content of a ruleset, recorded to show which desired state was applied.
+func rulesetHash(ruleset *github.Ruleset) string {
+	data, err := json.Marshal(ruleset)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// currentRelease returns the release tag that was last applied, or an empty string without a state store.
+func (h *RulesetHandler) currentRelease() string {
+	if h.State == nil {
+		return ""
+	}
+	return h.State.Release()
+}
+
+// orgRelease returns the release tag last applied to an organization, which differs from the current release while the
+// organization is on a prerelease. It falls back to the current release.
+func (h *RulesetHandler) orgRelease(orgName string) string {
+	if h.State == nil {
+		return ""
+	}
+	if org, ok := h.State.Org(orgName); ok && org.Release != "" {
+		return org.Release
+	}
+	return h.State.Release()
+}
+
+// recordRulesetSync records the outcome of applying a ruleset to an organization in the state store, and adds the
+// ruleset to the content applied by the delivery being handled.
+func (h *RulesetHandler) recordRulesetSync(ctx context.Context, orgName string, ruleset *DesiredRuleset, releaseTag string, syncErr error, logger zerolog.Logger) {
+	hash := rulesetHash(ruleset.Ruleset)
+	if syncErr == nil {
+		addAppliedContent(ctx, orgName, ruleset.File, hash)
+	}
+
+	if h.State == nil {
+		return
+	}
+	if err := h.State.RecordRulesetSync(orgName, ruleset.File, ruleset.Name, hash, releaseTag, syncErr); err != nil {
+		logger.Error().Err(err).Msgf("Failed to record the sync of ruleset %s in the organization %s.", ruleset.Name, orgName)
+	}
+}
+
+// batchStateWrites holds back the changes to the state of an organization until the returned function is called.
+func (h *RulesetHandler) batchStateWrites(orgName string, logger zerolog.Logger) func() {
+	if h.State == nil {
+		return func() {}
+	}
+
+	h.State.BeginBatch(orgName)
+	return func() {
+		if err := h.State.EndBatch(orgName); err != nil {
+			logger.Error().Err(err).Msgf("Failed to save the state of the organization %s.", orgName)
+		}
+	}
+}
+
+// recordOrgSync records the outcome of syncing an organization in the state store.
+func (h *RulesetHandler) recordOrgSync(orgName string, installationID int64, releaseTag string, syncErr error, logger zerolog.Logger) {
+	if h.State == nil {
+		return
+	}
+	if err := h.State.RecordOrgSync(orgName, installationID, releaseTag, syncErr); err != nil {
+		logger.Error().Err(err).Msgf("Failed to record the sync of the organization %s.", orgName)
+	}
+}
@@ -0,0 +1,143 @@
+package reporulesetbot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateStore(t *testing.T) {
+	// Create a temporary directory
+	dir, err := os.MkdirTemp("", "state_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+
+	store, err := OpenStateStore(path)
+	assert.NoError(t, err)
+	assert.Empty(t, store.Orgs())
+
+	assert.NoError(t, store.SetRelease("v1.4.0"))
+	assert.NoError(t, store.TrackRuleset("test-org", ManagedRuleset{ID: 10, Name: "Default Ruleset", File: "Default Ruleset.json"}))
+	assert.NoError(t, store.RecordRulesetSync("test-org", "Default Ruleset.json", "Default Ruleset", "abc123", "v1.4.0", nil))
+	assert.NoError(t, store.RecordOrgSync("test-org", 42, "v1.4.0", nil))
+
+	// Reopen the store to make sure the state was written to disk
+	store, err = OpenStateStore(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.4.0", store.Release())
+
+	org, ok := store.Org("test-org")
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), org.InstallationID)
+	assert.Equal(t, "v1.4.0", org.Release)
+	assert.False(t, org.LastSync.IsZero())
+
+	ruleset := org.Rulesets["Default Ruleset.json"]
+	assert.Equal(t, int64(10), ruleset.ID)
+	assert.Equal(t, "abc123", ruleset.Hash)
+	assert.Equal(t, "v1.4.0", ruleset.ReleaseTag)
+	assert.Empty(t, ruleset.LastError)
+
+	managed, err := store.ManagedRulesets("test-org")
+	assert.NoError(t, err)
+	assert.Equal(t, []ManagedRuleset{{ID: 10, Name: "Default Ruleset", File: "Default Ruleset.json"}}, managed)
+
+	// A failed sync keeps the last applied hash and records the error
+	assert.NoError(t, store.RecordRulesetSync("test-org", "Default Ruleset.json", "Default Ruleset", "def456", "v1.5.0", errors.New("Failed to get team")))
+	assert.NoError(t, store.RecordOrgSync("test-org", 0, "v1.5.0", errors.New("Failed to get team")))
+
+	org, _ = store.Org("test-org")
+	assert.Equal(t, int64(42), org.InstallationID)
+	assert.Equal(t, "Failed to get team", org.LastError)
+	assert.Equal(t, "v1.4.0", org.Release)
+	assert.Equal(t, "abc123", org.Rulesets["Default Ruleset.json"].Hash)
+	assert.Equal(t, "Failed to get team", org.Rulesets["Default Ruleset.json"].LastError)
+
+	// Untracking keeps the sync history but forgets the ID
+	assert.NoError(t, store.UntrackRuleset("test-org", 10))
+	managed, err = store.ManagedRulesets("test-org")
+	assert.NoError(t, err)
+	assert.Empty(t, managed)
+
+	// Changes to returned copies don't affect the store
+	org, _ = store.Org("test-org")
+	org.Rulesets["Default Ruleset.json"].Hash = "changed"
+	org, _ = store.Org("test-org")
+	assert.Equal(t, "abc123", org.Rulesets["Default Ruleset.json"].Hash)
+}
+
+func TestOpenStateStore_InvalidFile(t *testing.T) {
+	// Create a temporary directory
+	dir, err := os.MkdirTemp("", "state_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	err = os.WriteFile(path, []byte("not json"), 0644)
+	assert.NoError(t, err)
+
+	store, err := OpenStateStore(path)
+	assert.Error(t, err)
+	assert.Nil(t, store)
+}
+
+func TestRulesetHash(t *testing.T) {
+	ruleset := &github.Ruleset{Name: "Default Ruleset", Enforcement: "active"}
+	hash := rulesetHash(ruleset)
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, rulesetHash(&github.Ruleset{Name: "Default Ruleset", Enforcement: "active"}))
+	assert.NotEqual(t, hash, rulesetHash(&github.Ruleset{Name: "Default Ruleset", Enforcement: "evaluate"}))
+}
+
+func TestStateStoreBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := OpenStateStore(path)
+	assert.NoError(t, err)
+
+	store.BeginBatch("test-org")
+	store.BeginBatch("test-org")
+	assert.NoError(t, store.TrackRuleset("test-org", ManagedRuleset{ID: 42, Name: "Default Ruleset", File: "Default Ruleset.json"}))
+	assert.NoError(t, store.RecordRulesetSync("test-org", "Default Ruleset.json", "Default Ruleset", "abc123", "v1.0.0", nil))
+
+	// The changes are visible in memory, but not written until the outermost batch ends.
+	_, ok := store.Org("test-org")
+	assert.True(t, ok)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, store.EndBatch("test-org"))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, store.EndBatch("test-org"))
+	reopened, err := OpenStateStore(path)
+	assert.NoError(t, err)
+	org, ok := reopened.Org("test-org")
+	assert.True(t, ok)
+	assert.Equal(t, "abc123", org.Rulesets["Default Ruleset.json"].Hash)
+
+	// Changes to other organizations are written right away.
+	store.BeginBatch("test-org")
+	assert.NoError(t, store.RecordOrgSync("other-org", 7, "v1.0.0", nil))
+	reopened, err = OpenStateStore(path)
+	assert.NoError(t, err)
+	_, ok = reopened.Org("other-org")
+	assert.True(t, ok)
+	assert.NoError(t, store.EndBatch("test-org"))
+}
+
+func TestStateStoreOrgName(t *testing.T) {
+	store, err := OpenStateStore(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, store.RecordOrgSync("test-org", 1, "", nil))
+
+	assert.Equal(t, "test-org", store.OrgName("test-org"))
+	assert.Equal(t, "test-org", store.OrgName("Test-Org"))
+	assert.Equal(t, "Other-Org", store.OrgName("Other-Org"))
+}
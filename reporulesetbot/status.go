@@ -0,0 +1,198 @@
+package reporulesetbot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+)
+
+// eventTypeAdminSync is recorded in the audit log for the changes made by a sync requested through the admin API.
+const eventTypeAdminSync = "admin_sync"
+
+// InstallationStatus represents an installation of the app and the last sync of its organization.
+type InstallationStatus struct {
+	Org            string    `json:"org"`
+	InstallationID int64     `json:"installation_id"`
+	Suspended      bool      `json:"suspended"`
+	Release        string    `json:"release,omitempty"`
+	LastSync       time.Time `json:"last_sync,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// ManagedRulesetStatus represents a ruleset the app deployed to an organization and the last time it was applied.
+type ManagedRulesetStatus struct {
+	ManagedRuleset
+	Release   string    `json:"release,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	LastSync  time.Time `json:"last_sync,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// OrgStatus represents the managed rulesets of an organization and the result of its last sync.
+type OrgStatus struct {
+	InstallationStatus
+	Rulesets []ManagedRulesetStatus `json:"rulesets"`
+}
+
+// OrgPlan represents the changes a sync would make to an organization. The organization has drifted from the
+// configuration when any change is not a skip.
+type OrgPlan struct {
+	*Plan
+	Release string `json:"release,omitempty"`
+	Drifted bool   `json:"drifted"`
+}
+
+// ListInstallations returns every installation of the app, with the last sync of its organization from the state
+// store.
+func (h *RulesetHandler) ListInstallations(ctx context.Context) ([]InstallationStatus, error) {
+	jwtclient, err := newJWTClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create JWT client")
+	}
+
+	installations, err := getInstallationsForAuthenticatedApp(ctx, jwtclient)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get installations for authenticated app")
+	}
+
+	statuses := make([]InstallationStatus, 0, len(installations))
+	for _, installation := range installations {
+		status := h.installationStatus(installation.GetAccount().GetLogin())
+		status.InstallationID = installation.GetID()
+		status.Suspended = installation.SuspendedAt != nil
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Org < statuses[j].Org })
+
+	return statuses, nil
+}
+
+// OrgStatus returns the managed rulesets of an organization and the result of its last sync. It returns false when the
+// app has no record of the organization.
+func (h *RulesetHandler) OrgStatus(orgName string) (*OrgStatus, bool, error) {
+	managed, err := h.tracker().ManagedRulesets(orgName)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "Failed to get managed rulesets for organization %s", orgName)
+	}
+
+	var org OrgState
+	known := len(managed) > 0
+	if h.State != nil {
+		var ok bool
+		org, ok = h.State.Org(orgName)
+		known = known || ok
+	}
+	if !known {
+		return nil, false, nil
+	}
+
+	status := &OrgStatus{InstallationStatus: h.installationStatus(orgName), Rulesets: []ManagedRulesetStatus{}}
+	for _, tracked := range managed {
+		ruleset := ManagedRulesetStatus{ManagedRuleset: tracked}
+		if state, ok := org.Rulesets[tracked.File]; ok {
+			ruleset.Release = state.ReleaseTag
+			ruleset.Hash = state.Hash
+			ruleset.LastSync = state.LastSync
+			ruleset.LastError = state.LastError
+		}
+		status.Rulesets = append(status.Rulesets, ruleset)
+	}
+	sort.Slice(status.Rulesets, func(i, j int) bool { return status.Rulesets[i].File < status.Rulesets[j].File })
+
+	return status, true, nil
+}
+
+// PlanOrganization returns the changes a sync of an organization to its release would make, without making them.
+func (h *RulesetHandler) PlanOrganization(ctx context.Context, orgName string) (*OrgPlan, error) {
+	installationID, err := h.orgInstallationID(ctx, orgName)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := h.ClientCreator.NewInstallationClient(installationID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create installation client")
+	}
+
+	releaseTag := h.orgRelease(orgName)
+	plan, err := h.planOrganization(ctx, client, orgName, releaseTag, orgLogger(h.Logger, orgName, installationID))
+	if err != nil {
+		return nil, err
+	}
+
+	drifted := len(plan.missing) > 0
+	for _, change := range plan.Changes {
+		drifted = drifted || change.Action != AuditActionSkip
+	}
+	return &OrgPlan{Plan: plan, Release: releaseTag, Drifted: drifted}, nil
+}
+
+// SyncOrganization syncs an organization to its release outside of a webhook event, and returns the result. The actor
+// is recorded in the audit log.
+func (h *RulesetHandler) SyncOrganization(ctx context.Context, orgName, actor string) (*OrgStatus, error) {
+	if h.isOrgSuspended(orgName) {
+		return nil, &conflictError{message: fmt.Sprintf("The installation in the organization %s is suspended", orgName)}
+	}
+
+	installationID, err := h.orgInstallationID(ctx, orgName)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := orgLogger(h.Logger, orgName, installationID).With().Str(LogFieldEventType, eventTypeAdminSync).Logger()
+	logger.Info().Msgf("Syncing the organization %s for %s...", orgName, actor)
+
+	ctx = withEventInfo(ctx, eventInfo{EventType: eventTypeAdminSync, Sender: actor})
+	syncErr := h.syncOrganization(ctx, installationID, orgName, h.orgRelease(orgName), logger)
+
+	status, _, err := h.OrgStatus(orgName)
+	if err != nil {
+		return nil, err
+	}
+	return status, syncErr
+}
+
+// installationStatus returns the last sync of an organization from the state store.
+func (h *RulesetHandler) installationStatus(orgName string) InstallationStatus {
+	status := InstallationStatus{Org: orgName}
+	if h.State == nil {
+		return status
+	}
+
+	if org, ok := h.State.Org(orgName); ok {
+		status.InstallationID = org.InstallationID
+		status.Suspended = org.Suspended
+		status.Release = org.Release
+		status.LastSync = org.LastSync
+		status.LastError = org.LastError
+	}
+	return status
+}
+
+// orgInstallationID returns the installation ID of the app in an organization, from the state store when it is known.
+func (h *RulesetHandler) orgInstallationID(ctx context.Context, orgName string) (int64, error) {
+	if h.State != nil {
+		if org, ok := h.State.Org(orgName); ok && org.InstallationID != 0 {
+			return org.InstallationID, nil
+		}
+	}
+
+	jwtclient, err := newJWTClient()
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to create JWT client")
+	}
+	installationID, err := getOrgAppInstallationID(ctx, jwtclient, orgName)
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound {
+		return 0, &notFoundError{message: fmt.Sprintf("The app is not installed in the organization %s", orgName)}
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to get installation ID for the org %s", orgName)
+	}
+	return installationID, nil
+}
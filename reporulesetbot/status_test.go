@@ -0,0 +1,95 @@
+package reporulesetbot
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrgStatus(t *testing.T) {
+	h := &RulesetHandler{State: newTestStateStore(t)}
+
+	_, ok, err := h.OrgStatus("test-org")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, h.State.TrackRuleset("test-org", ManagedRuleset{ID: 42, Name: "Default Ruleset", File: "Default Ruleset.json"}))
+	assert.NoError(t, h.State.RecordRulesetSync("test-org", "Default Ruleset.json", "Default Ruleset", "abc123", "v1.0.0", nil))
+	assert.NoError(t, h.State.RecordOrgSync("test-org", 7, "v1.0.0", nil))
+	assert.NoError(t, h.State.RecordOrgSync("test-org", 7, "v1.1.0", errors.New("Failed to get team")))
+
+	status, ok, err := h.OrgStatus("test-org")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), status.InstallationID)
+	assert.Equal(t, "v1.0.0", status.Release)
+	assert.Equal(t, "Failed to get team", status.LastError)
+	if assert.Len(t, status.Rulesets, 1) {
+		assert.Equal(t, int64(42), status.Rulesets[0].ID)
+		assert.Equal(t, "abc123", status.Rulesets[0].Hash)
+		assert.Equal(t, "v1.0.0", status.Rulesets[0].Release)
+	}
+}
+
+func TestPlanOrganization(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"id": 42, "name": "Default Ruleset", "source_type": "Organization", "enforcement": "active"}]`))
+	}))
+
+	mockClient := new(MockClient)
+	mockClient.On("NewInstallationClient", int64(7)).Return(client, nil)
+
+	h := &RulesetHandler{ClientCreator: mockClient, State: newTestStateStore(t)}
+	assert.NoError(t, h.State.RecordOrgSync("test-org", 7, "v1.0.0", nil))
+	h.cacheBundle("v1.0.0", &rulesetBundle{Tag: "v1.0.0", Files: map[string][]byte{
+		"New Ruleset.json": []byte(`{"name": "New Ruleset", "target": "branch", "enforcement": "active"}`),
+	}}, h.Logger)
+
+	plan, err := h.PlanOrganization(context.Background(), "test-org")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", plan.Release)
+	assert.True(t, plan.Drifted)
+	assert.Equal(t, 1, plan.Count(AuditActionCreate))
+}
+
+func TestSyncOrganization_Suspended(t *testing.T) {
+	h := &RulesetHandler{State: newTestStateStore(t)}
+	assert.NoError(t, h.State.SetOrgSuspended("test-org", 7, true))
+
+	_, err := h.SyncOrganization(context.Background(), "test-org", "octocat")
+	assert.EqualError(t, err, "The installation in the organization test-org is suspended")
+	assert.Equal(t, http.StatusConflict, errorStatus(err))
+}
+
+func TestPlanOrganization_NoSideEffects(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/rulesets/42") {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message": "Resource not accessible by integration"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"id": 42, "name": "Default Ruleset", "source_type": "Organization", "enforcement": "active"}]`))
+	}))
+
+	mockClient := new(MockClient)
+	mockClient.On("NewInstallationClient", int64(7)).Return(client, nil)
+
+	h := &RulesetHandler{ClientCreator: mockClient, State: newTestStateStore(t)}
+	assert.NoError(t, h.State.RecordOrgSync("test-org", 7, "v1.0.0", nil))
+	h.cacheBundle("v1.0.0", &rulesetBundle{Tag: "v1.0.0", Files: map[string][]byte{
+		"Default Ruleset.json": []byte(`{"name": "Default Ruleset", "target": "branch", "enforcement": "active"}`),
+	}}, h.Logger)
+
+	_, err := h.PlanOrganization(context.Background(), "test-org")
+	assert.Error(t, err)
+
+	org, ok := h.State.Org("test-org")
+	assert.True(t, ok)
+	assert.Empty(t, org.Rulesets)
+}
@@ -0,0 +1,244 @@
+package reporulesetbot
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+)
+
+// enforcementRank orders the enforcement levels of a ruleset from the weakest to the strictest.
+var enforcementRank = map[interface{}]int{
+	nil:        0,
+	"disabled": 0,
+	"evaluate": 1,
+	"active":   2,
+}
+
+// bypassModeRank orders the bypass modes of an actor from the strictest to the weakest.
+var bypassModeRank = map[interface{}]int{
+	"pull_request": 0,
+	"always":       1,
+}
+
+// strictnessComparators compare the live and configured values of a field, keyed by the path of the field with the
+// rule type or actor left out. They return true when the live value is at least as strict as the configured one.
+var strictnessComparators = map[string]func(live, desired interface{}) bool{
+	"enforcement": func(live, desired interface{}) bool {
+		return enforcementRank[live] >= enforcementRank[desired]
+	},
+	"bypass_actors.*.bypass_mode": func(live, desired interface{}) bool {
+		liveRank, ok := bypassModeRank[live]
+		return ok && liveRank <= bypassModeRank[desired]
+	},
+	"conditions.ref_name.include":                                                  isSupersetOf,
+	"conditions.ref_name.exclude":                                                  isSubsetOf,
+	"conditions.repository_name.include":                                           isSupersetOf,
+	"conditions.repository_name.exclude":                                           isSubsetOf,
+	"rules.pull_request.parameters.required_approving_review_count":                isAtLeast,
+	"rules.pull_request.parameters.dismiss_stale_reviews_on_push":                  isAtLeastTrue,
+	"rules.pull_request.parameters.require_code_owner_review":                      isAtLeastTrue,
+	"rules.pull_request.parameters.require_last_push_approval":                     isAtLeastTrue,
+	"rules.pull_request.parameters.required_review_thread_resolution":              isAtLeastTrue,
+	"rules.required_status_checks.parameters.required_status_checks":               isSupersetOf,
+	"rules.required_status_checks.parameters.strict_required_status_checks_policy": isAtLeastTrue,
+	"rules.required_deployments.parameters.required_deployment_environments":       isSupersetOf,
+	"rules.code_scanning.parameters.code_scanning_tools":                           isSupersetOf,
+	"rules.workflows.parameters.workflows":                                         isSupersetOf,
+	"rules.pull_request.parameters.allowed_merge_methods":                          isSubsetOf,
+	"rules.required_status_checks.parameters.do_not_enforce_on_create":             isAtMostTrue,
+	"rules.workflows.parameters.do_not_enforce_on_create":                          isAtMostTrue,
+}
+
+// weakeningChanges returns the changes, as computed by diffRulesets from the live ruleset to the configured one,
+// that are needed because the live ruleset is weaker than the configuration. Changes for which the live ruleset is
+// at least as strict are left out.
+//
+// Extra rules and fewer bypass actors make a ruleset stricter, as do the fields with a comparator in
+// strictnessComparators. Any other difference is treated as weakening the ruleset.
+func weakeningChanges(changes []FieldChange) []FieldChange {
+	var weakening []FieldChange
+	for _, change := range changes {
+		if !isAtLeastAsStrict(change) {
+			weakening = append(weakening, change)
+		}
+	}
+	return weakening
+}
+
+// isAtLeastAsStrict returns true when the live value of a changed field is at least as strict as the configured one.
+func isAtLeastAsStrict(change FieldChange) bool {
+	parts := strings.Split(change.Path, ".")
+	switch {
+	case len(parts) == 2 && parts[0] == "rules":
+		// A rule that only exists in the live ruleset adds a restriction.
+		if change.To == nil {
+			return true
+		}
+	case len(parts) == 2 && parts[0] == "bypass_actors":
+		// A bypass actor that only exists in the configuration is an exemption the organization gave up.
+		return change.From == nil
+	case len(parts) > 2 && parts[0] == "bypass_actors":
+		parts[1] = "*"
+	}
+
+	compare, ok := strictnessComparators[strings.Join(parts, ".")]
+	return ok && compare(change.From, change.To)
+}
+
+// isAtLeast returns true when the live number is greater than or equal to the configured one.
+func isAtLeast(live, desired interface{}) bool {
+	liveNumber, _ := live.(float64)
+	desiredNumber, _ := desired.(float64)
+	return liveNumber >= desiredNumber
+}
+
+// isAtLeastTrue returns true unless the configured flag is set and the live one isn't.
+func isAtLeastTrue(live, desired interface{}) bool {
+	return live == true || desired != true
+}
+
+// isAtMostTrue returns true unless the live flag is set and the configured one isn't.
+func isAtMostTrue(live, desired interface{}) bool {
+	return live != true || desired == true
+}
+
+// isSupersetOf returns true when the live list contains every configured item.
+func isSupersetOf(live, desired interface{}) bool {
+	return containsAll(live, desired)
+}
+
+// isSubsetOf returns true when the configured list contains every live item.
+func isSubsetOf(live, desired interface{}) bool {
+	return containsAll(desired, live)
+}
+
+// containsAll returns true when the list contains every item of the other list.
+func containsAll(list, items interface{}) bool {
+	listItems, _ := list.([]interface{})
+	otherItems, _ := items.([]interface{})
+	for _, item := range otherItems {
+		found := false
+		for _, candidate := range listItems {
+			if reflect.DeepEqual(item, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcileRuleset returns the ruleset to apply to bring the live ruleset in line with the configuration under the
+// policy, and the changes it makes. When the comparison is at least as strict, only the weakening changes are applied
+// on top of the live ruleset so the organization keeps its own restrictions. The organization's allowed local
+// modifications are kept.
+func reconcileRuleset(policy RulesetPolicy, live *github.Ruleset, desired *DesiredRuleset) (*github.Ruleset, []FieldChange, error) {
+	merged, err := desired.withLocalModifications(live)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes, err := diffRulesets(live, merged)
+	if err != nil || len(changes) == 0 || policy.Comparison != ComparisonAtLeastAsStrict {
+		return merged, changes, err
+	}
+
+	changes = weakeningChanges(changes)
+	if len(changes) == 0 {
+		return merged, nil, nil
+	}
+
+	target, err := applyChanges(live, changes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return target, changes, nil
+}
+
+// applyChanges returns a copy of the ruleset with the changes, as computed by diffRulesets, applied to it.
+func applyChanges(ruleset *github.Ruleset, changes []FieldChange) (*github.Ruleset, error) {
+	normalized, err := normalizeRuleset(ruleset)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		setPath(normalized, strings.Split(change.Path, "."), change.To)
+	}
+
+	return denormalizeRuleset(ruleset, normalized)
+}
+
+// setPath sets the value at a path of a normalized ruleset, creating the objects along the way. A nil value removes
+// the field.
+func setPath(object map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := object[key].(map[string]interface{})
+		if !ok {
+			if value == nil {
+				return
+			}
+			child = make(map[string]interface{})
+			object[key] = child
+		}
+		object = child
+	}
+
+	key := path[len(path)-1]
+	if value == nil {
+		delete(object, key)
+		return
+	}
+	object[key] = value
+}
+
+// denormalizeRuleset converts a ruleset normalized by normalizeRuleset back to a ruleset. The fields set by GitHub
+// are taken from the original ruleset.
+func denormalizeRuleset(original *github.Ruleset, normalized map[string]interface{}) (*github.Ruleset, error) {
+	if rules, ok := normalized["rules"].(map[string]interface{}); ok {
+		normalized["rules"] = sortedValues(rules)
+	}
+	if actors, ok := normalized["bypass_actors"].(map[string]interface{}); ok {
+		normalized["bypass_actors"] = sortedValues(actors)
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal ruleset")
+	}
+
+	var ruleset github.Ruleset
+	if err := json.Unmarshal(data, &ruleset); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal ruleset")
+	}
+
+	if original != nil {
+		ruleset.ID = original.ID
+		ruleset.NodeID = original.NodeID
+		ruleset.Source = original.Source
+		ruleset.SourceType = original.SourceType
+	}
+	return &ruleset, nil
+}
+
+// sortedValues returns the values of a map sorted by key.
+func sortedValues(m map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, m[k])
+	}
+	return values
+}
@@ -0,0 +1,126 @@
+package reporulesetbot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const strictnessBaseline = `{
+	"name": "Default Ruleset",
+	"enforcement": "evaluate",
+	"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"], "exclude": []}},
+	"rules": [
+		{"type": "deletion"},
+		{"type": "pull_request", "parameters": {"required_approving_review_count": 1, "dismiss_stale_reviews_on_push": false, "require_code_owner_review": false, "require_last_push_approval": false, "required_review_thread_resolution": false}},
+		{"type": "required_status_checks", "parameters": {"strict_required_status_checks_policy": false, "required_status_checks": [{"context": "build"}]}}
+	],
+	"bypass_actors": [{"actor_id": 7, "actor_type": "Team", "bypass_mode": "always"}]
+}`
+
+func TestReconcileRuleset_AtLeastAsStrict(t *testing.T) {
+	policy := RulesetPolicy{Mode: ModeEnforce, Comparison: ComparisonAtLeastAsStrict}
+	desired := &DesiredRuleset{Ruleset: newTestRuleset(t, strictnessBaseline)}
+
+	t.Run("stricter ruleset is accepted", func(t *testing.T) {
+		live := newTestRuleset(t, `{
+			"id": 42,
+			"name": "Default Ruleset",
+			"enforcement": "active",
+			"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH", "refs/heads/release/*"], "exclude": []}},
+			"rules": [
+				{"type": "deletion"},
+				{"type": "non_fast_forward"},
+				{"type": "pull_request", "parameters": {"required_approving_review_count": 3, "dismiss_stale_reviews_on_push": true, "require_code_owner_review": true, "require_last_push_approval": false, "required_review_thread_resolution": false}},
+				{"type": "required_status_checks", "parameters": {"strict_required_status_checks_policy": true, "required_status_checks": [{"context": "build"}, {"context": "lint"}]}}
+			],
+			"bypass_actors": []
+		}`)
+
+		_, changes, err := reconcileRuleset(policy, live, desired)
+		assert.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("only weakening changes are reverted", func(t *testing.T) {
+		live := newTestRuleset(t, `{
+			"id": 42,
+			"name": "Default Ruleset",
+			"source": "target-org",
+			"enforcement": "active",
+			"conditions": {"ref_name": {"include": ["~DEFAULT_BRANCH"], "exclude": []}},
+			"rules": [
+				{"type": "non_fast_forward"},
+				{"type": "pull_request", "parameters": {"required_approving_review_count": 0, "dismiss_stale_reviews_on_push": true, "require_code_owner_review": false, "require_last_push_approval": false, "required_review_thread_resolution": false}},
+				{"type": "required_status_checks", "parameters": {"strict_required_status_checks_policy": false, "required_status_checks": [{"context": "lint"}]}}
+			],
+			"bypass_actors": [
+				{"actor_id": 7, "actor_type": "Team", "bypass_mode": "always"},
+				{"actor_id": 1, "actor_type": "OrganizationAdmin", "bypass_mode": "always"}
+			]
+		}`)
+
+		target, changes, err := reconcileRuleset(policy, live, desired)
+		assert.NoError(t, err)
+
+		var paths []string
+		for _, change := range changes {
+			paths = append(paths, change.Path)
+		}
+		assert.Equal(t, []string{
+			"bypass_actors.OrganizationAdmin:1",
+			"rules.deletion",
+			"rules.pull_request.parameters.required_approving_review_count",
+			"rules.required_status_checks.parameters.required_status_checks",
+		}, paths)
+
+		// The target keeps the organization's stricter settings and restores the baseline for the rest.
+		remaining, err := diffRulesets(live, target)
+		assert.NoError(t, err)
+		assert.Equal(t, changes, remaining)
+		assert.Equal(t, "active", target.Enforcement)
+		assert.Equal(t, int64(42), target.GetID())
+		assert.Equal(t, "target-org", target.Source)
+		assert.Len(t, target.BypassActors, 1)
+		assert.Len(t, target.Rules, 4)
+
+		changes, err = diffRulesets(target, desired.Ruleset)
+		assert.NoError(t, err)
+		assert.Empty(t, weakeningChanges(changes))
+	})
+
+	t.Run("exact comparison reverts everything", func(t *testing.T) {
+		live := newTestRuleset(t, `{"name": "Default Ruleset", "enforcement": "active", "rules": [{"type": "deletion"}]}`)
+
+		target, changes, err := reconcileRuleset(RulesetPolicy{Mode: ModeEnforce, Comparison: ComparisonExact}, live, desired)
+		assert.NoError(t, err)
+		assert.Same(t, desired.Ruleset, target)
+		assert.Contains(t, changes, FieldChange{Path: "enforcement", From: "active", To: "evaluate"})
+	})
+}
+
+func TestIsAtLeastAsStrict(t *testing.T) {
+	tests := []struct {
+		change FieldChange
+		want   bool
+	}{
+		{FieldChange{Path: "enforcement", From: "active", To: "evaluate"}, true},
+		{FieldChange{Path: "enforcement", From: "disabled", To: "evaluate"}, false},
+		{FieldChange{Path: "enforcement", From: nil, To: "active"}, false},
+		{FieldChange{Path: "rules.non_fast_forward", From: map[string]interface{}{"type": "non_fast_forward"}}, true},
+		{FieldChange{Path: "rules.deletion", To: map[string]interface{}{"type": "deletion"}}, false},
+		{FieldChange{Path: "bypass_actors.Team:7", To: map[string]interface{}{"actor_type": "Team"}}, true},
+		{FieldChange{Path: "bypass_actors.Team:7", From: map[string]interface{}{"actor_type": "Team"}}, false},
+		{FieldChange{Path: "bypass_actors.Team:7.bypass_mode", From: "pull_request", To: "always"}, true},
+		{FieldChange{Path: "bypass_actors.Team:7.bypass_mode", From: "always", To: "pull_request"}, false},
+		{FieldChange{Path: "conditions.ref_name.exclude", From: nil, To: []interface{}{"refs/heads/sandbox"}}, true},
+		{FieldChange{Path: "conditions.ref_name.exclude", From: []interface{}{"refs/heads/sandbox"}, To: nil}, false},
+		{FieldChange{Path: "rules.pull_request.parameters.required_approving_review_count", From: 2.0, To: 1.0}, true},
+		{FieldChange{Path: "rules.pull_request.parameters.require_code_owner_review", From: false, To: true}, false},
+		{FieldChange{Path: "name", From: "Renamed", To: "Default Ruleset"}, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isAtLeastAsStrict(tt.change), tt.change.String())
+	}
+}
@@ -0,0 +1,181 @@
+package reporulesetbot
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the name of the tracer of the app.
+const tracerName = "github.com/kuhlman-labs/repo-ruleset-bot/reporulesetbot"
+
+// defaultServiceName is the service name of the traces when none is configured.
+const defaultServiceName = "repo-ruleset-bot"
+
+// Constants for the exporters of traces.
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+// Attribute keys of the spans of the app.
+const (
+	AttributeDeliveryID     = attribute.Key("github.delivery_id")
+	AttributeEventType      = attribute.Key("github.event")
+	AttributeEventAction    = attribute.Key("github.action")
+	AttributeDuplicate      = attribute.Key("github.duplicate")
+	AttributeInstallationID = attribute.Key("github.installation_id")
+	AttributeOrg            = attribute.Key("github.org")
+	AttributeRuleset        = attribute.Key("ruleset.name")
+	AttributeRulesetFile    = attribute.Key("ruleset.file")
+	AttributeRulesetAction  = attribute.Key("ruleset.action")
+	AttributeRelease        = attribute.Key("release.tag")
+)
+
+// TracingConfig represents the configuration of the OpenTelemetry traces. Traces are only recorded when an exporter is
+// set. Without an endpoint, the OTLP exporter uses the OTEL_EXPORTER_OTLP_ENDPOINT environment variable or
+// localhost:4318.
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name"`
+}
+
+// validate validates the tracing configuration.
+func (c TracingConfig) validate() error {
+	switch c.Exporter {
+	case "", TracingExporterOTLP, TracingExporterStdout:
+	default:
+		return errors.Errorf("Invalid tracing exporter %s, expected %s or %s", c.Exporter, TracingExporterOTLP, TracingExporterStdout)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return errors.Errorf("Invalid tracing sample ratio %v, expected a value between 0 and 1", c.SampleRatio)
+	}
+	return nil
+}
+
+// NewTracerProvider returns the tracer provider for the configuration, and a function that flushes the spans left and
+// stops the exporter. Without an exporter, the provider records nothing.
+func NewTracerProvider(ctx context.Context, config TracingConfig) (trace.TracerProvider, func(context.Context) error, error) {
+	if err := config.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "":
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	case TracingExporterOTLP:
+		var options []otlptracehttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to create the %s trace exporter", config.Exporter)
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to create the trace resource")
+	}
+
+	ratio := config.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	return provider, provider.Shutdown, nil
+}
+
+// tracer returns the tracer the spans of the handler are recorded with.
+func (h *RulesetHandler) tracer() trace.Tracer {
+	if h.TracerProvider == nil {
+		return otel.GetTracerProvider().Tracer(tracerName)
+	}
+	return h.TracerProvider.Tracer(tracerName)
+}
+
+// startSpan starts a span as a child of the span in the context, if any.
+func (h *RulesetHandler) startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return h.tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan records the error, if any, in a span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TracingMiddleware returns a client middleware that records a span for every GitHub API call, as a child of the span
+// in the context of the request.
+func TracingMiddleware(provider trace.TracerProvider) githubapp.ClientMiddleware {
+	tracer := provider.Tracer(tracerName)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &tracingTransport{next: next, tracer: tracer}
+	}
+}
+
+// tracingTransport is the http.RoundTripper returned by TracingMiddleware.
+type tracingTransport struct {
+	next   http.RoundTripper
+	tracer trace.Tracer
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "GitHub API "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.String()),
+		),
+	)
+
+	res, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		endSpan(span, err)
+		return res, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+	if res.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	span.End()
+	return res, nil
+}
@@ -0,0 +1,134 @@
+package reporulesetbot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestTracerProvider returns a tracer provider that keeps the ended spans in a recorder.
+func newTestTracerProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	return provider, recorder
+}
+
+// spanNamed returns the ended span with the given name, or nil.
+func spanNamed(recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// spanAttribute returns the value of an attribute of a span as a string.
+func spanAttribute(span sdktrace.ReadOnlySpan, key string) string {
+	for _, attribute := range span.Attributes() {
+		if string(attribute.Key) == key {
+			return attribute.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracingConfigValidate(t *testing.T) {
+	assert.NoError(t, TracingConfig{}.validate())
+	assert.NoError(t, TracingConfig{Exporter: TracingExporterOTLP, SampleRatio: 0.5}.validate())
+	assert.NoError(t, TracingConfig{Exporter: TracingExporterStdout}.validate())
+	assert.Error(t, TracingConfig{Exporter: "jaeger"}.validate())
+	assert.Error(t, TracingConfig{Exporter: TracingExporterOTLP, SampleRatio: 2}.validate())
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	provider, shutdown, err := NewTracerProvider(context.Background(), TracingConfig{})
+	assert.NoError(t, err)
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "test")
+	assert.False(t, span.IsRecording())
+	assert.NoError(t, shutdown(context.Background()))
+
+	provider, shutdown, err = NewTracerProvider(context.Background(), TracingConfig{Exporter: TracingExporterOTLP, Endpoint: "http://localhost:4318", Insecure: true})
+	assert.NoError(t, err)
+	_, span = provider.Tracer(tracerName).Start(context.Background(), "test")
+	assert.True(t, span.IsRecording())
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, _, err = NewTracerProvider(context.Background(), TracingConfig{Exporter: "jaeger"})
+	assert.Error(t, err)
+}
+
+func TestHandleSpans(t *testing.T) {
+	provider, recorder := newTestTracerProvider(t)
+	h := &RulesetHandler{TracerProvider: provider}
+
+	payload := []byte(`{"action": "created", "release": {"tag_name": "v1.0.0"}, "repository": {"full_name": "octo-org/rulesets"}}`)
+	assert.NoError(t, h.Handle(context.Background(), EventTypeRelease, "delivery-1", payload))
+
+	root := spanNamed(recorder, "webhook release")
+	if assert.NotNil(t, root) {
+		assert.Equal(t, "delivery-1", spanAttribute(root, string(AttributeDeliveryID)))
+		assert.Equal(t, "created", spanAttribute(root, string(AttributeEventAction)))
+		assert.Equal(t, codes.Unset, root.Status().Code)
+	}
+
+	stage := spanNamed(recorder, "handle release created")
+	if assert.NotNil(t, stage) && root != nil {
+		assert.Equal(t, root.SpanContext().SpanID(), stage.Parent().SpanID())
+		assert.Equal(t, "v1.0.0", spanAttribute(stage, string(AttributeRelease)))
+	}
+
+	assert.Error(t, h.Handle(context.Background(), EventTypeRelease, "delivery-2", []byte(`not json`)))
+	failed := recorder.Ended()[len(recorder.Ended())-1]
+	assert.Equal(t, "webhook release", failed.Name())
+	assert.Equal(t, codes.Error, failed.Status().Code)
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	provider, recorder := newTestTracerProvider(t)
+	h := &RulesetHandler{TracerProvider: provider}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/orgs/missing-org/rulesets/1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(&http.Client{Transport: TracingMiddleware(provider)(http.DefaultTransport)})
+	baseURL, _ := url.Parse(server.URL + "/")
+	client.BaseURL = baseURL
+
+	ctx, parent := h.startSpan(context.Background(), "parent")
+	assert.NoError(t, removeBypassActors(ctx, client, "test-org", 1))
+	assert.Error(t, removeBypassActors(ctx, client, "missing-org", 1))
+	endSpan(parent, errors.New("Failed"))
+
+	var calls []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "GitHub API PUT" {
+			calls = append(calls, span)
+		}
+	}
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, parent.SpanContext().SpanID(), calls[0].Parent().SpanID())
+		assert.Equal(t, "200", spanAttribute(calls[0], "http.response.status_code"))
+		assert.Equal(t, codes.Unset, calls[0].Status().Code)
+		assert.Equal(t, "404", spanAttribute(calls[1], "http.response.status_code"))
+		assert.Equal(t, codes.Error, calls[1].Status().Code)
+	}
+
+	assert.Equal(t, codes.Error, spanNamed(recorder, "parent").Status().Code)
+}
@@ -1,29 +1,32 @@
 package reporulesetbot
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/google/go-github/v65/github"
 	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
 )
 
-// createRuleset creates a new organization ruleset.
-func createRuleset(ctx context.Context, client *github.Client, orgName string, ruleset *github.Ruleset, logger zerolog.Logger) error {
-	if _, _, err := client.Organizations.CreateOrganizationRuleset(ctx, orgName, ruleset); err != nil {
-		return errors.Wrap(err, "Failed to deploy repository ruleset")
+// createRuleset creates a new organization ruleset and returns it.
+func createRuleset(ctx context.Context, client *github.Client, orgName string, ruleset *github.Ruleset, logger zerolog.Logger) (*github.Ruleset, error) {
+	created, _, err := client.Organizations.CreateOrganizationRuleset(ctx, orgName, ruleset)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to deploy repository ruleset")
 	}
 	logger.Info().Msgf("Successfully created the %s ruleset for organization %s.", ruleset.Name, orgName)
-	return nil
+	return created, nil
 }
 
 // editRuleset updates an existing organization ruleset.
@@ -35,6 +38,46 @@ func editRuleset(ctx context.Context, client *github.Client, orgName string, rul
 	return nil
 }
 
+// deleteRuleset deletes an organization ruleset.
+func deleteRuleset(ctx context.Context, client *github.Client, orgName string, rulesetID int64, logger zerolog.Logger) error {
+	if _, err := client.Organizations.DeleteOrganizationRuleset(ctx, orgName, rulesetID); err != nil {
+		return errors.Wrap(err, "Failed to delete repository ruleset")
+	}
+	logger.Info().Msgf("Successfully deleted the ruleset with ID %d in organization %s.", rulesetID, orgName)
+	return nil
+}
+
+// disableRuleset sets the enforcement of an organization ruleset to disabled, leaving the rest of it as is.
+func disableRuleset(ctx context.Context, client *github.Client, orgName string, rulesetID int64, logger zerolog.Logger) error {
+	ruleset, err := getOrgRuleset(ctx, client, orgName, rulesetID)
+	if err != nil {
+		return err
+	}
+
+	ruleset.Enforcement = "disabled"
+	if _, _, err := client.Organizations.UpdateOrganizationRuleset(ctx, orgName, rulesetID, ruleset); err != nil {
+		return errors.Wrap(err, "Failed to disable repository ruleset")
+	}
+	logger.Info().Msgf("Successfully disabled the %s ruleset in organization %s.", ruleset.Name, orgName)
+	return nil
+}
+
+// renameRuleset renames an organization ruleset, leaving the rest of it as is.
+func renameRuleset(ctx context.Context, client *github.Client, orgName string, rulesetID int64, name string, logger zerolog.Logger) error {
+	ruleset, err := getOrgRuleset(ctx, client, orgName, rulesetID)
+	if err != nil {
+		return err
+	}
+
+	previous := ruleset.Name
+	ruleset.Name = name
+	if _, _, err := client.Organizations.UpdateOrganizationRuleset(ctx, orgName, rulesetID, ruleset); err != nil {
+		return errors.Wrap(err, "Failed to rename repository ruleset")
+	}
+	logger.Info().Msgf("Successfully renamed the %s ruleset in organization %s to %s.", previous, orgName, name)
+	return nil
+}
+
 // getRepoID returns the repository ID from a given repository name.
 func getRepoID(ctx context.Context, client *github.Client, owner, repo string) (int64, error) {
 	repository, _, err := client.Repositories.Get(ctx, owner, repo)
@@ -82,9 +125,26 @@ func getOrgID(ctx context.Context, client *github.Client, orgName string) (int64
 	return org.GetID(), nil
 }
 
-// getCustomRepoRolesForOrg returns the custom repository roles for an organization.
+// getCustomRepoRolesForOrg returns all the custom repository roles for an organization.
 func getCustomRepoRolesForOrg(ctx context.Context, client *github.Client, orgName string) (*github.OrganizationCustomRepoRoles, error) {
-	customRepoRoles, _, err := client.Organizations.ListCustomRepoRoles(ctx, orgName)
+	customRepoRoles := &github.OrganizationCustomRepoRoles{}
+
+	err := paginate(func(opts *github.ListOptions) (*github.Response, error) {
+		req, err := client.NewRequest("GET", listURL(fmt.Sprintf("orgs/%s/custom-repository-roles", orgName), opts), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		page := new(github.OrganizationCustomRepoRoles)
+		resp, err := client.Do(ctx, req, page)
+		if err != nil {
+			return nil, err
+		}
+
+		customRepoRoles.TotalCount = page.TotalCount
+		customRepoRoles.CustomRepoRoles = append(customRepoRoles.CustomRepoRoles, page.CustomRepoRoles...)
+		return resp, nil
+	})
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to get custom repository roles for organization: %s", orgName)
 	}
@@ -100,9 +160,18 @@ func getAuthenticatedApp(ctx context.Context, client *github.Client) (*github.Ap
 	return app, nil
 }
 
-// getInstallationsForAuthenticatedApp returns the installations for the authenticated app.
+// getInstallationsForAuthenticatedApp returns all the installations for the authenticated app.
 func getInstallationsForAuthenticatedApp(ctx context.Context, client *github.Client) ([]*github.Installation, error) {
-	installations, _, err := client.Apps.ListInstallations(ctx, nil)
+	var installations []*github.Installation
+
+	err := paginate(func(opts *github.ListOptions) (*github.Response, error) {
+		page, resp, err := client.Apps.ListInstallations(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		installations = append(installations, page...)
+		return resp, nil
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to list installations")
 	}
@@ -110,7 +179,7 @@ func getInstallationsForAuthenticatedApp(ctx context.Context, client *github.Cli
 }
 
 // newJWTClient creates a new client using a JSON Web Token (JWT) for authentication.
-func newJWTClient() (*github.Client, error) {
+var newJWTClient = func() (*github.Client, error) {
 	config, err := ReadConfig("config.yml")
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to read config file")
@@ -120,7 +189,8 @@ func newJWTClient() (*github.Client, error) {
 	privateKey := []byte(config.Github.App.PrivateKey)
 
 	// Create a new JWT client using the in-memory private key
-	itr, err := ghinstallation.NewAppsTransport(http.DefaultTransport, config.Github.App.IntegrationID, privateKey)
+	transport := TracingMiddleware(otel.GetTracerProvider())(appRateLimitTransport(config.RateLimit))
+	itr, err := ghinstallation.NewAppsTransport(transport, config.Github.App.IntegrationID, privateKey)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create JWT client")
 	}
@@ -129,6 +199,22 @@ func newJWTClient() (*github.Client, error) {
 	return client, nil
 }
 
+// appTransport is the rate limited transport shared by the JWT clients, so the budget of the app is remembered between
+// them.
+var (
+	appTransport     http.RoundTripper
+	appTransportOnce sync.Once
+)
+
+// appRateLimitTransport returns the rate limited transport of the JWT clients, created with the configuration of the
+// first client.
+func appRateLimitTransport(config RateLimitConfig) http.RoundTripper {
+	appTransportOnce.Do(func() {
+		appTransport = RateLimitMiddleware(config, metrics.DefaultRegistry)(http.DefaultTransport)
+	})
+	return appTransport
+}
+
 // getOrgInstallations returns a map of organization names and their corresponding installation IDs.
 func getOrgInstallations(ctx context.Context, client *github.Client) (map[string]int64, error) {
 	installations, err := getInstallationsForAuthenticatedApp(ctx, client)
@@ -156,9 +242,34 @@ func getOrgAppInstallationID(ctx context.Context, client *github.Client, orgName
 	return installation.GetID(), nil
 }
 
-// getOrgRulesets returns the rulesetID for a given organization and ruleset name.
+// getOrgRuleset returns an organization ruleset, including its rules and bypass actors.
+func getOrgRuleset(ctx context.Context, client *github.Client, orgName string, rulesetID int64) (*github.Ruleset, error) {
+	ruleset, _, err := client.Organizations.GetOrganizationRuleset(ctx, orgName, rulesetID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get organization ruleset %d", rulesetID)
+	}
+	return ruleset, nil
+}
+
+// getOrgRulesets returns all the rulesets for a given organization.
 func getOrgRulesets(ctx context.Context, client *github.Client, orgName string) ([]*github.Ruleset, error) {
-	rulesets, _, err := client.Organizations.GetAllOrganizationRulesets(ctx, orgName)
+	var rulesets []*github.Ruleset
+
+	err := paginate(func(opts *github.ListOptions) (*github.Response, error) {
+		req, err := client.NewRequest("GET", listURL(fmt.Sprintf("orgs/%s/rulesets", orgName), opts), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []*github.Ruleset
+		resp, err := client.Do(ctx, req, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		rulesets = append(rulesets, page...)
+		return resp, nil
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to get organization rulesets")
 	}
@@ -166,6 +277,39 @@ func getOrgRulesets(ctx context.Context, client *github.Client, orgName string)
 	return rulesets, nil
 }
 
+// maxPerPage is the largest page size accepted by the GitHub REST API.
+const maxPerPage = 100
+
+// paginate calls list with increasing page numbers until the response has no next page.
+func paginate(list func(opts *github.ListOptions) (*github.Response, error)) error {
+	opts := &github.ListOptions{PerPage: maxPerPage}
+	for {
+		resp, err := list(opts)
+		if err != nil {
+			return err
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listURL adds the list options to the query string of an API path.
+func listURL(path string, opts *github.ListOptions) string {
+	query := url.Values{}
+	if opts.Page != 0 {
+		query.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.PerPage != 0 {
+		query.Set("per_page", strconv.Itoa(opts.PerPage))
+	}
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
+
 // getRepoFullNameFromURL extracts the repository full name from a GitHub URL.
 func getRepoFullNameFromURL(githubURL string) (string, error) {
 	parsedURL, err := url.Parse(githubURL)
@@ -211,24 +355,17 @@ func getRulesetFiles(dir string) ([]string, error) {
 }
 
 // removeBypassActors edits the ruleset to remove the bypass actors.
-func removeBypassActors(client *github.Client, orgName string, rulesetID int64) error {
+func removeBypassActors(ctx context.Context, client *github.Client, orgName string, rulesetID int64) error {
 
 	payload := map[string]interface{}{
 		"bypass_actors": []interface{}{},
 	}
 
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return errors.Wrap(err, "Failed to marshal JSON payload")
-	}
-
-	body := bytes.NewReader(data)
-
-	req, err := http.NewRequest("PUT", fmt.Sprintf("https://api.github.com/orgs/%s/rulesets/%d", orgName, rulesetID), body)
+	req, err := client.NewRequest("PUT", fmt.Sprintf("orgs/%s/rulesets/%d", orgName, rulesetID), payload)
 	if err != nil {
 		return errors.Wrap(err, "Failed to create new request")
 	}
-	_, err = client.BareDo(context.Background(), req)
+	_, err = client.Do(ctx, req, nil)
 	if err != nil {
 		return errors.Wrap(err, "Failed to remove bypass actors")
 	}
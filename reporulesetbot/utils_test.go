@@ -1,10 +1,18 @@
 package reporulesetbot
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 
+	"github.com/google/go-github/v65/github"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -113,3 +121,114 @@ func TestGetRepoFullNameFromURL(t *testing.T) {
 		})
 	}
 }
+
+// newPaginatedTestClient returns a client for a fake server that serves the pages of a list endpoint.
+// Every page after the first is requested with the page query parameter and the server sets the Link
+// header so the client knows there are more pages.
+func newPaginatedTestClient(t *testing.T, path string, pages []string) *github.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		assert.Equal(t, "100", r.URL.Query().Get("per_page"))
+
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+
+		if page < len(pages) {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=%d&per_page=100>; rel="next"`, r.Host, path, page+1))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(pages[page-1]))
+	}))
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	client.BaseURL = baseURL
+	return client
+}
+
+func TestGetOrgRulesets(t *testing.T) {
+	client := newPaginatedTestClient(t, "/orgs/test-org/rulesets", []string{
+		`[{"id": 1, "name": "ruleset-1"}, {"id": 2, "name": "ruleset-2"}]`,
+		`[{"id": 3, "name": "ruleset-3"}]`,
+		`[{"id": 4, "name": "ruleset-4"}]`,
+	})
+
+	rulesets, err := getOrgRulesets(context.Background(), client, "test-org")
+	assert.NoError(t, err)
+
+	var names []string
+	for _, ruleset := range rulesets {
+		names = append(names, ruleset.Name)
+	}
+	assert.Equal(t, []string{"ruleset-1", "ruleset-2", "ruleset-3", "ruleset-4"}, names)
+}
+
+func TestGetInstallationsForAuthenticatedApp(t *testing.T) {
+	client := newPaginatedTestClient(t, "/app/installations", []string{
+		`[{"id": 1, "account": {"login": "org-1"}}]`,
+		`[{"id": 2, "account": {"login": "org-2"}}]`,
+	})
+
+	installations, err := getInstallationsForAuthenticatedApp(context.Background(), client)
+	assert.NoError(t, err)
+	assert.Len(t, installations, 2)
+	assert.Equal(t, "org-2", installations[1].GetAccount().GetLogin())
+
+	orgInstallations, err := getOrgInstallations(context.Background(), client)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"org-1": 1, "org-2": 2}, orgInstallations)
+}
+
+func TestGetCustomRepoRolesForOrg(t *testing.T) {
+	client := newPaginatedTestClient(t, "/orgs/test-org/custom-repository-roles", []string{
+		`{"total_count": 3, "custom_roles": [{"id": 10, "name": "role-1"}, {"id": 11, "name": "role-2"}]}`,
+		`{"total_count": 3, "custom_roles": [{"id": 12, "name": "role-3"}]}`,
+	})
+
+	roles, err := getCustomRepoRolesForOrg(context.Background(), client, "test-org")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, roles.GetTotalCount())
+	assert.Len(t, roles.CustomRepoRoles, 3)
+	assert.Equal(t, "role-3", roles.CustomRepoRoles[2].GetName())
+}
+
+func TestPaginateError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, _ := url.Parse(server.URL + "/")
+	client.BaseURL = baseURL
+
+	_, err := getOrgRulesets(context.Background(), client, "test-org")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Failed to get organization rulesets")
+}
+
+func TestRemoveBypassActors(t *testing.T) {
+	var body string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/orgs/test-org/rulesets/42", r.URL.Path)
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		fmt.Fprint(w, `{"id": 42}`)
+	}))
+
+	assert.NoError(t, removeBypassActors(context.Background(), client, "test-org", 42))
+	assert.JSONEq(t, `{"bypass_actors": []}`, body)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, removeBypassActors(ctx, client, "test-org", 42))
+}
@@ -0,0 +1,144 @@
+package reporulesetbot
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RulesetVersion represents the release of a ruleset that was last applied to an organization.
+type RulesetVersion struct {
+	File      string    `json:"file"`
+	Name      string    `json:"name"`
+	Release   string    `json:"release,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	LastSync  time.Time `json:"last_sync,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Lagging   bool      `json:"lagging"`
+}
+
+// OrgVersion represents the release an organization is on and the outcome of its last sync.
+type OrgVersion struct {
+	Org       string           `json:"org"`
+	Release   string           `json:"release,omitempty"`
+	Hash      string           `json:"hash,omitempty"`
+	LastSync  time.Time        `json:"last_sync,omitempty"`
+	LastError string           `json:"last_error,omitempty"`
+	Lagging   bool             `json:"lagging"`
+	Failed    bool             `json:"failed"`
+	Rulesets  []RulesetVersion `json:"rulesets"`
+}
+
+// VersionReport represents the release every organization is on, compared to the latest release.
+type VersionReport struct {
+	LatestRelease string       `json:"latest_release,omitempty"`
+	Orgs          []OrgVersion `json:"orgs"`
+}
+
+// Count returns the number of organizations that lag behind the latest release and that failed their last sync.
+func (r *VersionReport) Count() (lagging, failed int) {
+	for _, org := range r.Orgs {
+		if org.Lagging {
+			lagging++
+		}
+		if org.Failed {
+			failed++
+		}
+	}
+	return lagging, failed
+}
+
+// WriteText writes the report as a table with one line per organization, marking the organizations that lag behind
+// or failed their last sync.
+func (r *VersionReport) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ORG\tRELEASE\tLAST SYNC\tSTATUS\n")
+	for _, org := range r.Orgs {
+		release := org.Release
+		if release == "" {
+			release = "-"
+		}
+		lastSync := "never"
+		if !org.LastSync.IsZero() {
+			lastSync = org.LastSync.UTC().Format(time.RFC3339)
+		}
+
+		status := "ok"
+		switch {
+		case org.Failed && org.Lagging:
+			status = "LAGGING, FAILED: " + org.lastError()
+		case org.Failed:
+			status = "FAILED: " + org.lastError()
+		case org.Lagging:
+			status = "LAGGING"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", org.Org, release, lastSync, status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	lagging, failed := r.Count()
+	_, err := fmt.Fprintf(w, "\nLatest release %s: %d organization(s), %d lagging behind, %d failed their last sync.\n", r.LatestRelease, len(r.Orgs), lagging, failed)
+	return err
+}
+
+// lastError returns the error of the last sync of the organization, or of the first ruleset that failed.
+func (o OrgVersion) lastError() string {
+	if o.LastError != "" {
+		return o.LastError
+	}
+	for _, ruleset := range o.Rulesets {
+		if ruleset.LastError != "" {
+			return fmt.Sprintf("%s: %s", ruleset.Name, ruleset.LastError)
+		}
+	}
+	return ""
+}
+
+// VersionReport returns the release every organization and ruleset was last synced to, according to the state store.
+func (h *RulesetHandler) VersionReport() (*VersionReport, error) {
+	if h.State == nil {
+		return nil, errors.New("Version reports require the state store")
+	}
+
+	latest := h.State.Release()
+	report := &VersionReport{LatestRelease: latest, Orgs: []OrgVersion{}}
+
+	for orgName, org := range h.State.Orgs() {
+		version := OrgVersion{
+			Org:       orgName,
+			Release:   org.Release,
+			Hash:      h.State.BundleHash(org.Release),
+			LastSync:  org.LastSync,
+			LastError: org.LastError,
+			Lagging:   org.Release != latest,
+			Failed:    org.hasErrors(),
+			Rulesets:  []RulesetVersion{},
+		}
+
+		for _, ruleset := range org.Rulesets {
+			lagging := ruleset.ReleaseTag != latest
+			version.Rulesets = append(version.Rulesets, RulesetVersion{
+				File:      ruleset.File,
+				Name:      ruleset.Name,
+				Release:   ruleset.ReleaseTag,
+				Hash:      ruleset.Hash,
+				LastSync:  ruleset.LastSync,
+				LastError: ruleset.LastError,
+				Lagging:   lagging,
+			})
+			version.Lagging = version.Lagging || lagging
+		}
+		sort.Slice(version.Rulesets, func(i, j int) bool { return version.Rulesets[i].File < version.Rulesets[j].File })
+
+		report.Orgs = append(report.Orgs, version)
+	}
+	sort.Slice(report.Orgs, func(i, j int) bool { return report.Orgs[i].Org < report.Orgs[j].Org })
+
+	return report, nil
+}
@@ -0,0 +1,111 @@
+package reporulesetbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionReport(t *testing.T) {
+	_, err := (&RulesetHandler{}).VersionReport()
+	assert.Error(t, err)
+
+	store := newTestStateStore(t)
+	assert.NoError(t, store.SetRelease("v1.5.0"))
+	assert.NoError(t, store.SetBundleHash("v1.5.0", "abc123"))
+	assert.NoError(t, store.RecordRulesetSync("org-b", "Default Ruleset.json", "Default Ruleset", "def456", "v1.5.0", nil))
+	assert.NoError(t, store.RecordOrgSync("org-b", 2, "v1.5.0", nil))
+	assert.NoError(t, store.RecordRulesetSync("org-a", "Default Ruleset.json", "Default Ruleset", "789abc", "v1.4.0", nil))
+	assert.NoError(t, store.RecordOrgSync("org-a", 1, "v1.4.0", nil))
+	assert.NoError(t, store.RecordOrgSync("org-a", 1, "v1.5.0", errors.New("Failed to get team")))
+
+	h := &RulesetHandler{State: store}
+	report, err := h.VersionReport()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "v1.5.0", report.LatestRelease)
+	if assert.Len(t, report.Orgs, 2) {
+		assert.Equal(t, "org-a", report.Orgs[0].Org)
+		assert.Equal(t, "v1.4.0", report.Orgs[0].Release)
+		assert.True(t, report.Orgs[0].Lagging)
+		assert.True(t, report.Orgs[0].Failed)
+		assert.Equal(t, "v1.4.0", report.Orgs[0].Rulesets[0].Release)
+		assert.True(t, report.Orgs[0].Rulesets[0].Lagging)
+
+		assert.Equal(t, "org-b", report.Orgs[1].Org)
+		assert.Equal(t, "abc123", report.Orgs[1].Hash)
+		assert.False(t, report.Orgs[1].Lagging)
+		assert.False(t, report.Orgs[1].Failed)
+		assert.Equal(t, "def456", report.Orgs[1].Rulesets[0].Hash)
+	}
+
+	lagging, failed := report.Count()
+	assert.Equal(t, 1, lagging)
+	assert.Equal(t, 1, failed)
+
+	var text bytes.Buffer
+	assert.NoError(t, report.WriteText(&text))
+	assert.Contains(t, text.String(), "LAGGING, FAILED: Failed to get team")
+	assert.Contains(t, text.String(), "Latest release v1.5.0: 2 organization(s), 1 lagging behind, 1 failed their last sync.")
+}
+
+func TestVersionReport_RemovedRuleset(t *testing.T) {
+	store := newTestStateStore(t)
+	assert.NoError(t, store.SetRelease("v1.0.0"))
+	for id, name := range map[int64]string{1: "Default Ruleset", 2: "Old Ruleset"} {
+		assert.NoError(t, store.TrackRuleset("test-org", ManagedRuleset{ID: id, Name: name, File: name + ".json"}))
+		assert.NoError(t, store.RecordRulesetSync("test-org", name+".json", name, "abc123", "v1.0.0", nil))
+	}
+	assert.NoError(t, store.RecordOrgSync("test-org", 7, "v1.0.0", nil))
+
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/orgs/test-org/rulesets/2", r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// Old Ruleset is removed from the configuration and deleted by the garbage collection.
+	h := &RulesetHandler{Config: &Config{GarbageCollection: GarbageCollectionConfig{Enabled: true, Action: AuditActionDelete}}, State: store}
+	change := PlannedChange{Action: AuditActionDelete, Ruleset: "Old Ruleset", RulesetID: 2, Reason: removedRulesetReason}
+	assert.NoError(t, h.removeRuleset(context.Background(), client, "test-org", change, zerolog.Nop()))
+
+	// The next release only syncs the rulesets that are still configured.
+	assert.NoError(t, store.SetRelease("v1.1.0"))
+	assert.NoError(t, store.RecordRulesetSync("test-org", "Default Ruleset.json", "Default Ruleset", "def456", "v1.1.0", nil))
+	assert.NoError(t, store.RecordOrgSync("test-org", 7, "v1.1.0", nil))
+
+	report, err := h.VersionReport()
+	assert.NoError(t, err)
+	if assert.Len(t, report.Orgs, 1) {
+		assert.False(t, report.Orgs[0].Lagging)
+		assert.Len(t, report.Orgs[0].Rulesets, 1)
+	}
+	lagging, _ := report.Count()
+	assert.Equal(t, 0, lagging)
+}
+
+func TestAdminHandler_Versions(t *testing.T) {
+	store := newTestStateStore(t)
+	assert.NoError(t, store.SetRelease("v1.5.0"))
+	assert.NoError(t, store.RecordOrgSync("org-a", 1, "v1.4.0", nil))
+
+	handler := NewAdminHandler(&RulesetHandler{State: store}, AdminConfig{Token: "secret"})
+
+	rec := adminRequest(t, handler, http.MethodGet, "versions", "secret", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var report VersionReport
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, "v1.5.0", report.LatestRelease)
+	assert.True(t, report.Orgs[0].Lagging)
+
+	rec = adminRequest(t, handler, http.MethodGet, "versions?format=text", "secret", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "org-a")
+	assert.Contains(t, rec.Body.String(), "LAGGING")
+}
@@ -0,0 +1,379 @@
+package reporulesetbot
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// defaultMaxRuleSuiteFailureIncrease is the number of additional failed rule suites a wave may cause before the health
+// gate stops the rollout, when not configured.
+const defaultMaxRuleSuiteFailureIncrease = 10
+
+// remainingWaveName is the name of the wave of the organizations not covered by any configured wave.
+const remainingWaveName = "remaining"
+
+// maxRuleSuitePages is the most pages of rule suites read for a single organization by the health gate.
+const maxRuleSuitePages = 10
+
+// RolloutWave represents a group of organizations that receive a release together. A wave either names its
+// organizations, or covers the organizations needed to reach a percentage of every organization, or, with neither
+// set, every organization that isn't in an earlier wave.
+type RolloutWave struct {
+	Name    string        `yaml:"name"`
+	Orgs    []string      `yaml:"orgs"`
+	Percent int           `yaml:"percent"`
+	Delay   time.Duration `yaml:"delay"`
+	Gate    bool          `yaml:"gate"`
+}
+
+// RolloutGateConfig represents the configuration of the health gate between waves.
+type RolloutGateConfig struct {
+	MaxRuleSuiteFailureIncrease *int `yaml:"max_rule_suite_failure_increase"`
+}
+
+// maxRuleSuiteFailureIncrease returns the number of additional failed rule suites allowed by the gate. A negative
+// value turns the rule suite check off.
+func (c RolloutGateConfig) maxRuleSuiteFailureIncrease() int {
+	if c.MaxRuleSuiteFailureIncrease == nil {
+		return defaultMaxRuleSuiteFailureIncrease
+	}
+	return *c.MaxRuleSuiteFailureIncrease
+}
+
+// validate checks that the waves can be planned.
+func (c ReleaseConfig) validate() error {
+	percent := 0
+	for i, wave := range c.Waves {
+		if len(wave.Orgs) > 0 && wave.Percent != 0 {
+			return errors.Errorf("Wave %d sets both orgs and percent", i+1)
+		}
+		if wave.Percent < 0 || wave.Percent > 100 {
+			return errors.Errorf("Wave %d has percent %d, expected a value between 0 and 100", i+1, wave.Percent)
+		}
+		if wave.Percent != 0 && wave.Percent < percent {
+			return errors.Errorf("Wave %d has percent %d, which is lower than the percent of an earlier wave", i+1, wave.Percent)
+		}
+		if wave.Percent != 0 {
+			percent = wave.Percent
+		}
+		if wave.Delay < 0 {
+			return errors.Errorf("Wave %d has a negative delay", i+1)
+		}
+	}
+	return nil
+}
+
+// plannedWave represents a wave and the installations it covers.
+type plannedWave struct {
+	RolloutWave
+	installations []*github.Installation
+}
+
+// planWaves assigns every installation to a wave. Percentages are applied to the installations sorted by organization
+// name, so the same organizations receive a release first every time. Installations not covered by any wave are added
+// to a final gated wave, and waves that cover no installations are left out.
+func planWaves(installations []*github.Installation, waves []RolloutWave) []plannedWave {
+	sorted := make([]*github.Installation, len(installations))
+	copy(sorted, installations)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetAccount().GetLogin() < sorted[j].GetAccount().GetLogin()
+	})
+
+	if len(waves) == 0 {
+		return []plannedWave{{installations: sorted}}
+	}
+
+	assigned := make(map[int64]bool)
+	take := func(installation *github.Installation) bool {
+		if assigned[installation.GetID()] {
+			return false
+		}
+		assigned[installation.GetID()] = true
+		return true
+	}
+
+	var planned []plannedWave
+	for i, wave := range waves {
+		if wave.Name == "" {
+			wave.Name = fmt.Sprintf("wave %d", i+1)
+		}
+		current := plannedWave{RolloutWave: wave}
+
+		switch {
+		case len(wave.Orgs) > 0:
+			for _, installation := range sorted {
+				if containsOrg(wave.Orgs, installation.GetAccount().GetLogin()) && take(installation) {
+					current.installations = append(current.installations, installation)
+				}
+			}
+		case wave.Percent > 0:
+			target := (len(sorted)*wave.Percent + 99) / 100
+			for _, installation := range sorted {
+				if len(assigned) >= target {
+					break
+				}
+				if take(installation) {
+					current.installations = append(current.installations, installation)
+				}
+			}
+		default:
+			for _, installation := range sorted {
+				if take(installation) {
+					current.installations = append(current.installations, installation)
+				}
+			}
+		}
+
+		if len(current.installations) > 0 {
+			planned = append(planned, current)
+		}
+	}
+
+	remaining := plannedWave{RolloutWave: RolloutWave{Name: remainingWaveName, Gate: true}}
+	for _, installation := range sorted {
+		if take(installation) {
+			remaining.installations = append(remaining.installations, installation)
+		}
+	}
+	if len(remaining.installations) > 0 {
+		planned = append(planned, remaining)
+	}
+	return planned
+}
+
+// containsOrg returns true when the organization is in the list, ignoring case.
+func containsOrg(orgs []string, orgName string) bool {
+	for _, org := range orgs {
+		if strings.EqualFold(org, orgName) {
+			return true
+		}
+	}
+	return false
+}
+
+// RolloutProgress represents how far the rollout in progress has got.
+type RolloutProgress struct {
+	Release   string    `json:"release"`
+	StartedAt time.Time `json:"started_at"`
+	Wave      string    `json:"wave,omitempty"`
+	WaveIndex int       `json:"wave_index"`
+	Waves     int       `json:"waves"`
+	Total     int       `json:"total"`
+	Done      int       `json:"done"`
+	Failed    int       `json:"failed"`
+}
+
+// activeRollout represents the rollout in progress.
+type activeRollout struct {
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex
+	progress RolloutProgress
+}
+
+// update changes the progress of the rollout.
+func (a *activeRollout) update(change func(*RolloutProgress)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	change(&a.progress)
+}
+
+// RolloutProgress returns the progress of the rollout in progress, or nil if there is none.
+func (h *RulesetHandler) RolloutProgress() *RolloutProgress {
+	h.rolloutMu.Lock()
+	active := h.activeRollout
+	h.rolloutMu.Unlock()
+
+	if active == nil {
+		return nil
+	}
+
+	active.mu.Lock()
+	defer active.mu.Unlock()
+	progress := active.progress
+	return &progress
+}
+
+// AbortRollout stops the rollout in progress. Organizations that are being updated finish, and the remaining ones are
+// skipped with the reason. It returns false when there is no rollout in progress.
+func (h *RulesetHandler) AbortRollout(reason string) bool {
+	h.rolloutMu.Lock()
+	defer h.rolloutMu.Unlock()
+
+	if h.activeRollout == nil {
+		return false
+	}
+	h.activeRollout.cancel(errors.New(reason))
+	h.activeRollout = nil
+	return true
+}
+
+// startRollout makes the rollout of a release abortable, aborting the rollout in progress if there is one. The
+// returned function must be called once the rollout is done.
+func (h *RulesetHandler) startRollout(ctx context.Context, release string) (context.Context, *activeRollout, func()) {
+	h.AbortRollout(fmt.Sprintf("superseded by release %s", release))
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	active := &activeRollout{cancel: cancel, progress: RolloutProgress{Release: release, StartedAt: time.Now()}}
+
+	h.rolloutMu.Lock()
+	h.activeRollout = active
+	h.rolloutMu.Unlock()
+
+	return ctx, active, func() {
+		h.rolloutMu.Lock()
+		defer h.rolloutMu.Unlock()
+		if h.activeRollout == active {
+			h.activeRollout = nil
+		}
+		cancel(nil)
+	}
+}
+
+// rolloutGate returns the configuration of the health gate between waves.
+func (h *RulesetHandler) rolloutGate() RolloutGateConfig {
+	if h.Config == nil {
+		return RolloutGateConfig{}
+	}
+	return h.Config.Release.Gate
+}
+
+// waitForWave waits for the delay before a wave, returning early with the reason when the rollout is aborted.
+func waitForWave(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return context.Cause(ctx)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-timer.C:
+		return nil
+	}
+}
+
+// skipWave returns the results of a wave that wasn't started.
+func skipWave(wave plannedWave, reason string) []OrgResult {
+	results := make([]OrgResult, 0, len(wave.installations))
+	for _, installation := range wave.installations {
+		results = append(results, OrgResult{Org: installation.GetAccount().GetLogin(), Wave: wave.Name, Status: RolloutStatusSkipped, Reason: reason})
+	}
+	return results
+}
+
+// checkWaveHealth returns an error when the previous wave failed in an organization, or when the failed rule suites in
+// its organizations since it started increased by more than the configured amount, compared to the same length of time
+// before it started.
+func (h *RulesetHandler) checkWaveHealth(ctx context.Context, wave plannedWave, results []OrgResult, started time.Time, logger zerolog.Logger) error {
+	var failed []string
+	for _, result := range results {
+		if result.Status == RolloutStatusFailed {
+			failed = append(failed, result.Org)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("wave %s failed in %d organization(s): %s", wave.Name, len(failed), strings.Join(failed, ", "))
+	}
+
+	maxIncrease := h.rolloutGate().maxRuleSuiteFailureIncrease()
+	if maxIncrease < 0 {
+		return nil
+	}
+
+	now := time.Now()
+	baseline := started.Add(-now.Sub(started))
+
+	before, after := 0, 0
+	for _, installation := range wave.installations {
+		if skipReason(installation) != "" {
+			continue
+		}
+
+		orgName := installation.GetAccount().GetLogin()
+		client, err := h.ClientCreator.NewInstallationClient(installation.GetID())
+		if err != nil {
+			return errors.Wrapf(err, "Failed to create installation client for the organization %s", orgName)
+		}
+
+		suites, err := getFailedRuleSuites(ctx, client, orgName, now.Sub(baseline))
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get the rule suites of the organization %s", orgName)
+		}
+
+		for _, suite := range suites {
+			switch {
+			case suite.PushedAt.Before(baseline):
+			case suite.PushedAt.Before(started):
+				before++
+			default:
+				after++
+			}
+		}
+	}
+
+	logger.Info().Msgf("Wave %s caused %d failed rule suites, compared to %d before it started.", wave.Name, after, before)
+
+	if after-before > maxIncrease {
+		return errors.Errorf("failed rule suites in wave %s increased from %d to %d", wave.Name, before, after)
+	}
+	return nil
+}
+
+// ruleSuite represents an evaluation of the rulesets of an organization for a push.
+type ruleSuite struct {
+	ID       int64     `json:"id"`
+	PushedAt time.Time `json:"pushed_at"`
+	Result   string    `json:"result"`
+}
+
+// getFailedRuleSuites returns the failed rule suites of an organization for at least the given length of time.
+func getFailedRuleSuites(ctx context.Context, client *github.Client, orgName string, period time.Duration) ([]ruleSuite, error) {
+	timePeriod := "hour"
+	switch {
+	case period > 7*24*time.Hour:
+		timePeriod = "month"
+	case period > 24*time.Hour:
+		timePeriod = "week"
+	case period > time.Hour:
+		timePeriod = "day"
+	}
+
+	var suites []ruleSuite
+	for page := 1; page <= maxRuleSuitePages; page++ {
+		query := url.Values{
+			"time_period":       {timePeriod},
+			"rule_suite_result": {"fail"},
+			"per_page":          {"100"},
+			"page":              {fmt.Sprint(page)},
+		}
+
+		req, err := client.NewRequest("GET", fmt.Sprintf("orgs/%s/rulesets/rule-suites?%s", orgName, query.Encode()), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []ruleSuite
+		resp, err := client.Do(ctx, req, &batch)
+		if err != nil {
+			return nil, err
+		}
+
+		suites = append(suites, batch...)
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+	return suites, nil
+}
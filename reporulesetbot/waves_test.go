@@ -0,0 +1,161 @@
+package reporulesetbot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v65/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// waveOrgs returns the organizations of every planned wave by wave name.
+func waveOrgs(waves []plannedWave) map[string][]string {
+	orgs := make(map[string][]string)
+	for _, wave := range waves {
+		for _, installation := range wave.installations {
+			orgs[wave.Name] = append(orgs[wave.Name], installation.GetAccount().GetLogin())
+		}
+	}
+	return orgs
+}
+
+func TestPlanWaves(t *testing.T) {
+	installations := []*github.Installation{
+		newTestInstallation(1, "org-e"),
+		newTestInstallation(2, "org-d"),
+		newTestInstallation(3, "org-c"),
+		newTestInstallation(4, "org-b"),
+		newTestInstallation(5, "org-a"),
+	}
+
+	t.Run("without waves", func(t *testing.T) {
+		waves := planWaves(installations, nil)
+		assert.Len(t, waves, 1)
+		assert.Equal(t, map[string][]string{"": {"org-a", "org-b", "org-c", "org-d", "org-e"}}, waveOrgs(waves))
+	})
+
+	t.Run("canary, percentage and the rest", func(t *testing.T) {
+		waves := planWaves(installations, []RolloutWave{
+			{Name: "canary", Orgs: []string{"ORG-D"}},
+			{Name: "early", Percent: 60, Gate: true},
+			{Name: "everyone", Delay: time.Hour},
+		})
+
+		assert.Equal(t, map[string][]string{
+			"canary":   {"org-d"},
+			"early":    {"org-a", "org-b"},
+			"everyone": {"org-c", "org-e"},
+		}, waveOrgs(waves))
+		assert.True(t, waves[1].Gate)
+		assert.Equal(t, time.Hour, waves[2].Delay)
+	})
+
+	t.Run("uncovered organizations go in a gated final wave", func(t *testing.T) {
+		waves := planWaves(installations, []RolloutWave{
+			{Orgs: []string{"org-a"}},
+			{Orgs: []string{"missing-org"}},
+		})
+
+		assert.Equal(t, map[string][]string{
+			"wave 1":          {"org-a"},
+			remainingWaveName: {"org-b", "org-c", "org-d", "org-e"},
+		}, waveOrgs(waves))
+		assert.True(t, waves[1].Gate)
+	})
+}
+
+func TestReleaseConfigValidate(t *testing.T) {
+	assert.NoError(t, ReleaseConfig{Waves: []RolloutWave{{Orgs: []string{"org-a"}}, {Percent: 25}, {Percent: 100}}}.validate())
+	assert.Error(t, ReleaseConfig{Waves: []RolloutWave{{Orgs: []string{"org-a"}, Percent: 10}}}.validate())
+	assert.Error(t, ReleaseConfig{Waves: []RolloutWave{{Percent: 110}}}.validate())
+	assert.Error(t, ReleaseConfig{Waves: []RolloutWave{{Percent: 50}, {Percent: 25}}}.validate())
+	assert.Error(t, ReleaseConfig{Waves: []RolloutWave{{Delay: -time.Minute}}}.validate())
+}
+
+func TestAbortRollout(t *testing.T) {
+	h := &RulesetHandler{}
+	assert.False(t, h.AbortRollout("no rollout"))
+
+	ctx, _, done := h.startRollout(context.Background(), "v1.0.0")
+	defer done()
+
+	// A new release supersedes the rollout in progress.
+	next, _, nextDone := h.startRollout(context.Background(), "v1.1.0")
+	assert.EqualError(t, waitForWave(ctx, time.Hour), "superseded by release v1.1.0")
+
+	progress := h.RolloutProgress()
+	if assert.NotNil(t, progress) {
+		assert.Equal(t, "v1.1.0", progress.Release)
+	}
+
+	assert.True(t, h.AbortRollout("bad release"))
+	assert.EqualError(t, context.Cause(next), "bad release")
+	nextDone()
+
+	// The rollout is no longer in progress once it is done.
+	_, _, done = h.startRollout(context.Background(), "v1.2.0")
+	done()
+	assert.False(t, h.AbortRollout("too late"))
+	assert.Nil(t, h.RolloutProgress())
+}
+
+func TestCheckWaveHealth(t *testing.T) {
+	logger := zerolog.Nop()
+	started := time.Now().Add(-10 * time.Minute)
+	wave := plannedWave{RolloutWave: RolloutWave{Name: "canary"}, installations: []*github.Installation{newTestInstallation(1, "org-a")}}
+
+	var failures []ruleSuite
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/orgs/org-a/rulesets/rule-suites", r.URL.Path)
+		assert.Equal(t, "fail", r.URL.Query().Get("rule_suite_result"))
+		assert.Equal(t, "hour", r.URL.Query().Get("time_period"))
+		assert.NoError(t, json.NewEncoder(w).Encode(failures))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	client.BaseURL = baseURL
+
+	mockClient := new(MockClient)
+	mockClient.On("NewInstallationClient", int64(1)).Return(client, nil)
+
+	h := &RulesetHandler{ClientCreator: mockClient, Config: &Config{Release: ReleaseConfig{Gate: RolloutGateConfig{MaxRuleSuiteFailureIncrease: github.Int(1)}}}}
+
+	t.Run("failed organizations stop the rollout", func(t *testing.T) {
+		results := []OrgResult{{Org: "org-a", Status: RolloutStatusFailed, Reason: "boom"}}
+		assert.EqualError(t, h.checkWaveHealth(context.Background(), wave, results, started, logger), "wave canary failed in 1 organization(s): org-a")
+	})
+
+	results := []OrgResult{{Org: "org-a", Status: RolloutStatusSuccess}}
+
+	t.Run("steady rule suite failures pass", func(t *testing.T) {
+		failures = []ruleSuite{
+			{ID: 1, PushedAt: started.Add(-5 * time.Minute), Result: "fail"},
+			{ID: 2, PushedAt: started.Add(5 * time.Minute), Result: "fail"},
+			{ID: 3, PushedAt: started.Add(-time.Hour), Result: "fail"},
+		}
+		assert.NoError(t, h.checkWaveHealth(context.Background(), wave, results, started, logger))
+	})
+
+	t.Run("a spike in rule suite failures stops the rollout", func(t *testing.T) {
+		failures = []ruleSuite{
+			{ID: 1, PushedAt: started.Add(1 * time.Minute), Result: "fail"},
+			{ID: 2, PushedAt: started.Add(2 * time.Minute), Result: "fail"},
+			{ID: 3, PushedAt: started.Add(3 * time.Minute), Result: "fail"},
+		}
+		assert.EqualError(t, h.checkWaveHealth(context.Background(), wave, results, started, logger), "failed rule suites in wave canary increased from 0 to 3")
+	})
+
+	t.Run("the rule suite check can be turned off", func(t *testing.T) {
+		h := &RulesetHandler{Config: &Config{Release: ReleaseConfig{Gate: RolloutGateConfig{MaxRuleSuiteFailureIncrease: github.Int(-1)}}}}
+		assert.NoError(t, h.checkWaveHealth(context.Background(), wave, results, started, logger))
+	})
+}